@@ -0,0 +1,290 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"agent-forge/internal/config"
+	"agent-forge/internal/llm"
+	"agent-forge/internal/logger"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.uber.org/zap"
+)
+
+// 批量创建结果中单个智能体的状态
+const (
+	batchItemCreated = "created"
+	batchItemFailed  = "failed"
+	// batchItemDiscarded 原子模式下因其他智能体失败而没有保存
+	batchItemDiscarded = "discarded"
+)
+
+// 批量创建的整体状态
+const (
+	batchStatusSuccess = "success"
+	batchStatusPartial = "partial"
+	batchStatusFailed  = "failed"
+)
+
+// errBatchAborted 原子模式下已有智能体失败，尚未开始的智能体不再生成
+var errBatchAborted = errors.New("skipped because another agent in the batch failed")
+
+// agentSpec 待创建智能体的名称、核心特质和标签
+type agentSpec struct {
+	Name       string
+	CoreTraits string
+	Tags       []string
+}
+
+// batchItemResult 批量创建中单个智能体的结果
+type batchItemResult struct {
+	Index   int    `json:"index"`
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	AgentID string `json:"agent_id,omitempty"`
+	Error   string `json:"error,omitempty"`
+	llmRoute
+}
+
+// batchConcurrency 返回配置的批量生成并发数
+func batchConcurrency() int {
+	if cfg := config.GetConfig(); cfg != nil && cfg.Batch.Concurrency > 0 {
+		return cfg.Batch.Concurrency
+	}
+	return 1
+}
+
+// batchMaxItems 返回配置的单次批量创建上限
+func batchMaxItems() int {
+	if cfg := config.GetConfig(); cfg != nil && cfg.Batch.MaxItems > 0 {
+		return cfg.Batch.MaxItems
+	}
+	return maxPanelSize
+}
+
+// forgeAgents 以最多 concurrency 个并发生成一批智能体，返回与 specs 一一对应的智能体、生成人格的提供方与模型和错误
+// failFast 为 true 时，任一智能体失败后不再开始生成剩余的智能体，它们的错误为 errBatchAborted
+func forgeAgents(ctx context.Context, specs []agentSpec, sampling samplingPatch, concurrency int, failFast bool) ([]Agent, []llmRoute, []error) {
+	forged := make([]Agent, len(specs))
+	routes := make([]llmRoute, len(specs))
+	errs := make([]error, len(specs))
+
+	jobs := make(chan int)
+	var aborted atomic.Bool
+	var wg sync.WaitGroup
+	for range min(max(concurrency, 1), len(specs)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				if failFast && aborted.Load() {
+					errs[i] = errBatchAborted
+					continue
+				}
+				var resp *llm.ChatResponse
+				forged[i], resp, errs[i] = forgeAgent(ctx, specs[i].Name, specs[i].CoreTraits, specs[i].Tags, sampling)
+				if errs[i] != nil {
+					aborted.Store(true)
+					continue
+				}
+				routes[i] = routeOf(resp)
+			}
+		}()
+	}
+	for i := range specs {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	return forged, routes, errs
+}
+
+// saveForgedAgents 依次保存智能体，任一保存失败时删除本批已保存的智能体，并返回保存失败的智能体序号
+func saveForgedAgents(forged []Agent) (int, error) {
+	for i, agent := range forged {
+		if err := agents.Create(agent); err != nil {
+			logger.Error("保存智能体失败", zap.Error(err))
+			for _, created := range forged[:i] {
+				if err := agents.Delete(created.ID); err != nil {
+					logger.Warn("清理已保存的智能体失败", zap.String("agent_id", created.ID), zap.Error(err))
+				}
+			}
+			return i, fmt.Errorf("save agent %s failed: %v", agent.Name, err)
+		}
+	}
+	return -1, nil
+}
+
+// parseAgentSpecs 解析批量创建参数中的智能体列表
+func parseAgentSpecs(args map[string]interface{}, maxItems int) ([]agentSpec, error) {
+	items, ok := args["agents"].([]interface{})
+	if !ok || len(items) == 0 {
+		return nil, errors.New("agents must be a non-empty array")
+	}
+	if len(items) > maxItems {
+		return nil, fmt.Errorf("at most %d agents can be created in one batch", maxItems)
+	}
+
+	specs := make([]agentSpec, 0, len(items))
+	seen := make(map[string]int, len(items))
+	for i, item := range items {
+		obj, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("agents[%d] must be an object", i)
+		}
+		name, _ := obj["agent_name"].(string)
+		coreTraits, _ := obj["core_traits"].(string)
+		name, coreTraits = strings.TrimSpace(name), strings.TrimSpace(coreTraits)
+		if name == "" || coreTraits == "" {
+			return nil, fmt.Errorf("agents[%d] requires agent_name and core_traits", i)
+		}
+		// 同一批中的名称必须唯一，导入和提示词都按名称查找智能体
+		if j, ok := seen[name]; ok {
+			return nil, fmt.Errorf("agents[%d] has the same agent_name as agents[%d]: %s", i, j, name)
+		}
+		seen[name] = i
+		tags, err := stringSliceArg(obj, "tags")
+		if err != nil {
+			return nil, fmt.Errorf("agents[%d]: %v", i, err)
+		}
+		specs = append(specs, agentSpec{Name: name, CoreTraits: coreTraits, Tags: tags})
+	}
+	return specs, nil
+}
+
+// 批量创建智能体处理函数
+func batchCreateAgentsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	log := logger.GetLogger()
+	args := request.GetArguments()
+
+	specs, err := parseAgentSpecs(args, batchMaxItems())
+	if err != nil {
+		return nil, err
+	}
+
+	atomicMode := false
+	if v, ok := args["atomic"]; ok {
+		b, ok := v.(bool)
+		if !ok {
+			return nil, errors.New("atomic must be a boolean")
+		}
+		atomicMode = b
+	}
+
+	concurrency := batchConcurrency()
+	if v, ok := args["concurrency"]; ok {
+		n, ok := v.(float64)
+		if !ok || n < 1 || n > float64(concurrency) || n != math.Trunc(n) {
+			return nil, fmt.Errorf("concurrency must be an integer between 1 and %d", concurrency)
+		}
+		concurrency = int(n)
+	}
+
+	sampling, err := parseSamplingArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, meter := withUsageMeter(ctx)
+
+	log.Info("批量创建智能体",
+		zap.Int("count", len(specs)),
+		zap.Int("concurrency", concurrency),
+		zap.Bool("atomic", atomicMode))
+
+	forged, routes, errs := forgeAgents(ctx, specs, sampling, concurrency, atomicMode)
+
+	results := make([]batchItemResult, len(specs))
+	failed := 0
+	for i, spec := range specs {
+		results[i] = batchItemResult{Index: i, Name: spec.Name, llmRoute: routes[i]}
+		if errs[i] != nil && !errors.Is(errs[i], errBatchAborted) {
+			failed++
+		}
+	}
+
+	if atomicMode {
+		// 原子模式：全部生成成功后才保存，否则本批智能体都不保存；
+		// 保存失败时已保存的智能体被删除，保存失败的智能体标记为失败
+		if failed == 0 {
+			if i, err := saveForgedAgents(forged); err != nil {
+				errs[i] = err
+				failed++
+			}
+		}
+		for i := range results {
+			switch {
+			case failed == 0:
+				results[i].Status = batchItemCreated
+				results[i].AgentID = forged[i].ID
+			case errs[i] != nil && !errors.Is(errs[i], errBatchAborted):
+				results[i].Status = batchItemFailed
+				results[i].Error = errs[i].Error()
+			default:
+				results[i].Status = batchItemDiscarded
+				if errs[i] != nil {
+					results[i].Error = errs[i].Error()
+				}
+			}
+		}
+	} else {
+		// 尽力模式：生成成功的智能体各自保存，互不影响
+		for i := range results {
+			if errs[i] == nil {
+				if err := agents.Create(forged[i]); err != nil {
+					errs[i] = fmt.Errorf("save agent failed: %v", err)
+					failed++
+				}
+			}
+			if errs[i] != nil {
+				results[i].Status = batchItemFailed
+				results[i].Error = errs[i].Error()
+				continue
+			}
+			results[i].Status = batchItemCreated
+			results[i].AgentID = forged[i].ID
+		}
+	}
+
+	created := 0
+	for _, r := range results {
+		if r.Status == batchItemCreated {
+			created++
+		}
+	}
+	status := batchStatusSuccess
+	switch {
+	case created == 0:
+		status = batchStatusFailed
+	case created < len(results):
+		status = batchStatusPartial
+	}
+	if failed > 0 {
+		log.Warn("批量创建存在失败的智能体",
+			zap.Int("created", created),
+			zap.Int("failed", failed))
+	}
+
+	result := map[string]interface{}{
+		"status":  status,
+		"atomic":  atomicMode,
+		"created": created,
+		"failed":  failed,
+		"results": results,
+		"usage":   meter.snapshot(),
+	}
+
+	jsonResponse, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("marshal response failed: %v", err)
+	}
+
+	return mcp.NewToolResultText(string(jsonResponse)), nil
+}
@@ -0,0 +1,231 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"agent-forge/internal/store"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useBatchLLM 启动记录最大并发请求数的模拟服务器，名称中包含“故障”的智能体生成无效的人格
+func useBatchLLM(t *testing.T) *atomic.Int32 {
+	t.Helper()
+	var inflight, peak atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inflight.Add(1)
+		defer inflight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+
+		var req openai.ChatCompletionRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		reply := fakePersonaJSON
+		if strings.Contains(req.Messages[len(req.Messages)-1].Content, "故障") {
+			reply = "not json"
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Model: "deepseek-chat",
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: reply},
+				FinishReason: openai.FinishReasonStop,
+			}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	useFakeProvider(t, srv.URL)
+	return &peak
+}
+
+// batchItems 构造批量创建参数，names 中的每个名称对应一个智能体
+func batchItems(names ...string) []interface{} {
+	items := make([]interface{}, 0, len(names))
+	for _, name := range names {
+		items = append(items, map[string]interface{}{"agent_name": name, "core_traits": "严谨,好奇"})
+	}
+	return items
+}
+
+func TestBatchCreateAgents(t *testing.T) {
+	peak := useBatchLLM(t)
+	agents = store.NewRegistry(store.NewMemoryStore())
+
+	names := make([]string, 6)
+	for i := range names {
+		names[i] = fmt.Sprintf("专家%d", i)
+	}
+	result, err := batchCreateAgentsHandler(context.Background(), newToolRequest("batch_create_agents", map[string]interface{}{
+		"agents":      batchItems(names...),
+		"concurrency": float64(2),
+		"temperature": 0.3,
+	}))
+	require.NoError(t, err)
+	data := toolResultJSON(t, result)
+	assert.Equal(t, batchStatusSuccess, data["status"])
+	assert.Equal(t, float64(6), data["created"])
+	assert.LessOrEqual(t, peak.Load(), int32(2))
+	assert.Greater(t, peak.Load(), int32(1))
+
+	// 结果与请求顺序一致
+	results := data["results"].([]interface{})
+	require.Len(t, results, 6)
+	item := results[3].(map[string]interface{})
+	assert.Equal(t, "专家3", item["name"])
+	agent, err := agents.Get(item["agent_id"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, "专家3", agent.Name)
+	require.NotNil(t, agent.Temperature)
+	assert.Equal(t, 0.3, *agent.Temperature)
+}
+
+func TestBatchCreateAgentsBestEffort(t *testing.T) {
+	useBatchLLM(t)
+	agents = store.NewRegistry(store.NewMemoryStore())
+
+	result, err := batchCreateAgentsHandler(context.Background(), newToolRequest("batch_create_agents", map[string]interface{}{
+		"agents": batchItems("经济学家", "故障专家", "历史学家"),
+	}))
+	require.NoError(t, err)
+	data := toolResultJSON(t, result)
+	assert.Equal(t, batchStatusPartial, data["status"])
+	assert.Equal(t, float64(2), data["created"])
+	assert.Equal(t, float64(1), data["failed"])
+
+	failed := data["results"].([]interface{})[1].(map[string]interface{})
+	assert.Equal(t, batchItemFailed, failed["status"])
+	assert.NotEmpty(t, failed["error"])
+	assert.Nil(t, failed["agent_id"])
+
+	list, err := agents.List()
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+}
+
+func TestBatchCreateAgentsAtomic(t *testing.T) {
+	useBatchLLM(t)
+	agents = store.NewRegistry(store.NewMemoryStore())
+
+	result, err := batchCreateAgentsHandler(context.Background(), newToolRequest("batch_create_agents", map[string]interface{}{
+		"agents": batchItems("经济学家", "故障专家", "历史学家"),
+		"atomic": true,
+	}))
+	require.NoError(t, err)
+	data := toolResultJSON(t, result)
+	assert.Equal(t, batchStatusFailed, data["status"])
+	assert.Equal(t, float64(0), data["created"])
+	assert.Equal(t, float64(1), data["failed"])
+
+	for i, r := range data["results"].([]interface{}) {
+		item := r.(map[string]interface{})
+		if i == 1 {
+			assert.Equal(t, batchItemFailed, item["status"])
+		} else {
+			assert.Equal(t, batchItemDiscarded, item["status"])
+		}
+		assert.Nil(t, item["agent_id"])
+	}
+
+	list, err := agents.List()
+	require.NoError(t, err)
+	assert.Empty(t, list)
+
+	// 全部成功时原子模式正常保存
+	result, err = batchCreateAgentsHandler(context.Background(), newToolRequest("batch_create_agents", map[string]interface{}{
+		"agents": batchItems("经济学家", "历史学家"),
+		"atomic": true,
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, batchStatusSuccess, toolResultJSON(t, result)["status"])
+	list, err = agents.List()
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+}
+
+// flakyAgentStore 第 failAt 次保存时失败的智能体存储
+type flakyAgentStore struct {
+	store.AgentStore
+	puts   int
+	failAt int
+}
+
+func (s *flakyAgentStore) Put(agent *Agent) error {
+	s.puts++
+	if s.puts == s.failAt {
+		return errors.New("disk full")
+	}
+	return s.AgentStore.Put(agent)
+}
+
+func TestBatchCreateAgentsAtomicSaveFailure(t *testing.T) {
+	useBatchLLM(t)
+	agents = store.NewRegistry(&flakyAgentStore{AgentStore: store.NewMemoryStore(), failAt: 2})
+
+	// 保存失败时返回逐项结果，指明保存失败的智能体，已保存的智能体被删除
+	result, err := batchCreateAgentsHandler(context.Background(), newToolRequest("batch_create_agents", map[string]interface{}{
+		"agents":      batchItems("经济学家", "历史学家", "工程师"),
+		"atomic":      true,
+		"concurrency": float64(1),
+	}))
+	require.NoError(t, err)
+	data := toolResultJSON(t, result)
+	assert.Equal(t, batchStatusFailed, data["status"])
+	assert.Equal(t, float64(0), data["created"])
+	assert.Equal(t, float64(1), data["failed"])
+	assert.NotNil(t, data["usage"])
+
+	items := data["results"].([]interface{})
+	require.Len(t, items, 3)
+	failedItem := items[1].(map[string]interface{})
+	assert.Equal(t, batchItemFailed, failedItem["status"])
+	assert.Contains(t, failedItem["error"], "历史学家")
+	for _, i := range []int{0, 2} {
+		item := items[i].(map[string]interface{})
+		assert.Equal(t, batchItemDiscarded, item["status"])
+		assert.Nil(t, item["agent_id"])
+	}
+
+	list, err := agents.List()
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
+
+func TestBatchCreateAgentsRejectsInvalidArgs(t *testing.T) {
+	useBatchLLM(t)
+	agents = store.NewRegistry(store.NewMemoryStore())
+
+	tooMany := make([]string, batchMaxItems()+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("专家%d", i)
+	}
+	for _, args := range []map[string]interface{}{
+		{},
+		{"agents": []interface{}{}},
+		{"agents": batchItems(tooMany...)},
+		{"agents": []interface{}{map[string]interface{}{"agent_name": "经济学家"}}},
+		{"agents": []interface{}{"经济学家"}},
+		{"agents": batchItems("经济学家", "历史学家", "经济学家")},
+		{"agents": batchItems("经济学家"), "atomic": "yes"},
+		{"agents": batchItems("经济学家"), "concurrency": float64(0)},
+		{"agents": batchItems("经济学家"), "concurrency": float64(batchConcurrency() + 1)},
+	} {
+		_, err := batchCreateAgentsHandler(context.Background(), newToolRequest("batch_create_agents", args))
+		assert.Error(t, err, "%v", args)
+	}
+}
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"agent-forge/internal/llm"
+	"agent-forge/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+// LLM 响应缓存，为 nil 时不缓存
+var llmCache llm.Cache
+
+// cacheMode 一次工具调用中LLM调用使用响应缓存的方式
+type cacheMode int
+
+const (
+	cacheOff       cacheMode = iota // 不读也不写缓存
+	cacheReadWrite                  // 命中时直接返回缓存结果，否则调用后写入缓存
+	cacheRefresh                    // 不读缓存，调用后用新结果覆盖缓存
+)
+
+// cacheModeKey 上下文中缓存方式的键
+type cacheModeKey struct{}
+
+// withCacheMode 返回携带缓存方式的上下文，只有显式启用缓存的工具（创建智能体、智能体回答）才会使用缓存
+func withCacheMode(ctx context.Context, mode cacheMode) context.Context {
+	return context.WithValue(ctx, cacheModeKey{}, mode)
+}
+
+// cacheModeFromContext 返回上下文中的缓存方式，未设置时不使用缓存
+func cacheModeFromContext(ctx context.Context) cacheMode {
+	if ctx == nil {
+		return cacheOff
+	}
+	mode, _ := ctx.Value(cacheModeKey{}).(cacheMode)
+	return mode
+}
+
+// parseCacheArg 根据工具参数 no_cache 返回缓存方式：跳过缓存时仍用新结果刷新缓存
+func parseCacheArg(args map[string]interface{}) (cacheMode, error) {
+	v, ok := args["no_cache"]
+	if !ok || v == nil {
+		return cacheReadWrite, nil
+	}
+	noCache, ok := v.(bool)
+	if !ok {
+		return cacheOff, errors.New("no_cache must be a boolean")
+	}
+	if noCache {
+		return cacheRefresh, nil
+	}
+	return cacheReadWrite, nil
+}
+
+// cachedResponse 按上下文中的缓存方式查找缓存，返回计算出的缓存键（不使用缓存时为空）
+// 只缓存可复现的请求（指定了种子或温度为 0），其余请求每次都重新生成
+// 命中时 onDelta 不为空则一次性回调完整内容，流式调用方同样能收到进度通知
+func cachedResponse(ctx context.Context, req llm.ChatRequest, onDelta func(delta string)) (*llm.ChatResponse, string) {
+	mode := cacheModeFromContext(ctx)
+	if llmCache == nil || mode == cacheOff || !llmProviders.Deterministic(req) {
+		return nil, ""
+	}
+	key := llmProviders.CacheKey(req)
+	if mode != cacheReadWrite {
+		return nil, key
+	}
+	resp, ok := llmCache.Get(key)
+	if !ok {
+		return nil, key
+	}
+	if onDelta != nil && resp.Content != "" {
+		onDelta(resp.Content)
+	}
+	return resp, key
+}
+
+// storeResponse 写入响应缓存，失败只记录日志
+func storeResponse(key string, resp *llm.ChatResponse) {
+	if key == "" {
+		return
+	}
+	if err := llmCache.Put(key, resp); err != nil {
+		logger.Warn("写入LLM响应缓存失败", zap.Error(err))
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"agent-forge/internal/config"
+	"agent-forge/internal/llm"
+	"agent-forge/internal/store"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useLLMCache 启用内存响应缓存，测试结束后恢复
+func useLLMCache(t *testing.T) {
+	t.Helper()
+	prev := llmCache
+	llmCache = llm.NewMemoryCache(100, 0)
+	t.Cleanup(func() { llmCache = prev })
+}
+
+func TestResponseCacheForCreateAndAnswer(t *testing.T) {
+	requests := useFakeLLM(t, "缓存的回答")
+	useLLMCache(t)
+	agents = store.NewRegistry(store.NewMemoryStore())
+	ctx := context.Background()
+
+	// 指定种子的智能体，人格和回答都可以复现
+	create := func(args map[string]interface{}) map[string]interface{} {
+		args["agent_name"] = "缓存专家"
+		args["core_traits"] = "节俭"
+		args["seed"] = float64(7)
+		result, err := createToolHandler(ctx, newToolRequest("expert_personality_generation", args))
+		require.NoError(t, err)
+		return toolResultJSON(t, result)
+	}
+	first := create(map[string]interface{}{})
+	assert.Equal(t, false, first["cached"])
+	second := create(map[string]interface{}{})
+	assert.Equal(t, true, second["cached"])
+	assert.Len(t, requests.requests, 1, "相同的人格只生成一次")
+
+	answer := func(args map[string]interface{}) map[string]interface{} {
+		args["agent_id"] = first["agent_id"]
+		args["context"] = "如何省钱"
+		result, err := answerToolHandler(ctx, newToolRequest("agent_answer", args))
+		require.NoError(t, err)
+		return toolResultJSON(t, result)
+	}
+	assert.Equal(t, false, answer(map[string]interface{}{})["cached"])
+	hit := answer(map[string]interface{}{})
+	assert.Equal(t, true, hit["cached"])
+	assert.Equal(t, "缓存的回答", hit["content"])
+	assert.Len(t, requests.requests, 2)
+
+	// no_cache 跳过缓存重新生成
+	assert.Equal(t, false, answer(map[string]interface{}{"no_cache": true})["cached"])
+	assert.Len(t, requests.requests, 3)
+
+	// 上下文不同时不命中缓存
+	result, err := answerToolHandler(ctx, newToolRequest("agent_answer", map[string]interface{}{
+		"agent_id": first["agent_id"],
+		"context":  "如何赚钱",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, false, toolResultJSON(t, result)["cached"])
+	assert.Len(t, requests.requests, 4)
+
+	_, err = answerToolHandler(ctx, newToolRequest("agent_answer", map[string]interface{}{
+		"agent_id": first["agent_id"],
+		"no_cache": "yes",
+	}))
+	assert.Error(t, err)
+}
+
+func TestInvalidCachedPersonaIsRefreshed(t *testing.T) {
+	requests := useFakeLLM(t, "回答")
+	useLLMCache(t)
+	agents = store.NewRegistry(store.NewMemoryStore())
+
+	// 缓存中的人格无效时重新生成，并用新结果覆盖缓存
+	seed := 7
+	req := llm.ChatRequest{
+		Sampling: llm.Sampling{Seed: &seed},
+		Messages: []llm.Message{
+			{Role: llm.RoleSystem, Content: personaSystemPrompt},
+			{Role: llm.RoleUser, Content: "请为名为[审计专家]的智能体生成人格，核心特质是：[严谨]"},
+		},
+		JSONMode: true,
+	}
+	key := llmProviders.CacheKey(req)
+	require.NoError(t, llmCache.Put(key, &llm.ChatResponse{Content: "not json"}))
+
+	_, err := createToolHandler(context.Background(), newToolRequest("expert_personality_generation", map[string]interface{}{
+		"agent_name":  "审计专家",
+		"core_traits": "严谨",
+		"seed":        float64(7),
+	}))
+	require.NoError(t, err)
+	assert.Len(t, requests.requests, 1)
+
+	cached, ok := llmCache.Get(key)
+	require.True(t, ok)
+	assert.Equal(t, fakePersonaJSON, cached.Content)
+}
+
+func TestNonDeterministicRequestsAreNotCached(t *testing.T) {
+	requests := useFakeLLM(t, "回答")
+	useLLMCache(t)
+	agents = store.NewRegistry(store.NewMemoryStore())
+	ctx := context.Background()
+
+	// 未指定种子、温度不为 0 的智能体每次都重新生成
+	create := func(args map[string]interface{}) map[string]interface{} {
+		args["agent_name"] = "随性专家"
+		args["core_traits"] = "灵活"
+		result, err := createToolHandler(ctx, newToolRequest("expert_personality_generation", args))
+		require.NoError(t, err)
+		return toolResultJSON(t, result)
+	}
+	agent := create(map[string]interface{}{"temperature": 0.9})
+	assert.Equal(t, false, create(map[string]interface{}{"temperature": 0.9})["cached"])
+	assert.Len(t, requests.requests, 2)
+
+	for range 2 {
+		result, err := answerToolHandler(ctx, newToolRequest("agent_answer", map[string]interface{}{
+			"agent_id": agent["agent_id"],
+			"context":  "如何省钱",
+		}))
+		require.NoError(t, err)
+		assert.Equal(t, false, toolResultJSON(t, result)["cached"])
+	}
+	assert.Len(t, requests.requests, 4)
+
+	// 温度为 0 时可以复现，第二次命中缓存
+	greedy := create(map[string]interface{}{"temperature": float64(0)})
+	assert.Equal(t, false, greedy["cached"])
+	assert.Equal(t, true, create(map[string]interface{}{"temperature": float64(0)})["cached"])
+	assert.Len(t, requests.requests, 5)
+}
+
+func TestFallbackResponseIsNotCached(t *testing.T) {
+	useFailingPrimaryLLM(t, "备用回答")
+	useLLMCache(t)
+
+	seed := 7
+	req := llm.ChatRequest{
+		Sampling: llm.Sampling{Seed: &seed},
+		Messages: []llm.Message{{Role: llm.RoleUser, Content: "你好"}},
+	}
+	ctx := withCacheMode(context.Background(), cacheReadWrite)
+	resp, err := chatLLM(ctx, req, nil)
+	require.NoError(t, err)
+	require.Equal(t, "ollama", resp.Provider)
+
+	// 缓存键按首选提供方计算，故障转移的结果不能冒充首选提供方的回答
+	_, ok := llmCache.Get(llmProviders.CacheKey(req))
+	assert.False(t, ok)
+}
+
+func TestModelFallbackResponseIsNotCached(t *testing.T) {
+	// 同一提供方的首选模型不可用，故障转移到该提供方的另一个模型
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if req.Model == "deepseek-chat" {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Model: req.Model,
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "备用模型的回答"},
+				FinishReason: openai.FinishReasonStop,
+			}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	provider, err := llm.NewOpenAICompatible(config.ProviderConfig{Name: "deepseek", BaseURL: srv.URL, APIKey: "test-key", Model: "deepseek-chat"})
+	require.NoError(t, err)
+	registry, err := llm.NewRegistry("deepseek", provider)
+	require.NoError(t, err)
+	require.NoError(t, registry.SetFallback([]string{"deepseek/deepseek-reasoner"}))
+	prev := llmProviders
+	llmProviders = registry
+	t.Cleanup(func() { llmProviders = prev })
+	useLLMCache(t)
+
+	seed := 7
+	req := llm.ChatRequest{
+		Sampling: llm.Sampling{Seed: &seed},
+		Messages: []llm.Message{{Role: llm.RoleUser, Content: "你好"}},
+	}
+	resp, err := chatLLM(withCacheMode(context.Background(), cacheReadWrite), req, nil)
+	require.NoError(t, err)
+	require.Equal(t, "deepseek", resp.Provider)
+	require.Equal(t, "deepseek-reasoner", resp.RequestedModel)
+
+	// 提供方相同但模型不同，结果同样不能写入首选模型的缓存键
+	_, ok := llmCache.Get(llmProviders.CacheKey(req))
+	assert.False(t, ok)
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"agent-forge/internal/config"
+	"agent-forge/internal/llm"
+	"agent-forge/internal/logger"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"go.uber.org/zap"
+)
+
+// cancelledNotificationMethod MCP 取消请求通知的方法名
+const cancelledNotificationMethod = "notifications/cancelled"
+
+// requestIDMetaKey 工具调用 _meta 中记录 JSON-RPC 请求ID的键，mcp-go 不会把请求ID传给工具处理函数
+const requestIDMetaKey = "agent-forge/request-id"
+
+// stdioSessionID mcp-go stdio 传输的会话ID
+const stdioSessionID = "stdio"
+
+// errCancelledByClient 客户端取消了正在执行的工具调用
+var errCancelledByClient = errors.New("request cancelled by client")
+
+// inflightCalls 正在执行的工具调用，键为会话ID与请求ID，用于响应客户端的取消通知
+var inflightCalls = struct {
+	sync.Mutex
+	cancels map[string]context.CancelCauseFunc
+}{cancels: make(map[string]context.CancelCauseFunc)}
+
+// inflightKey 返回工具调用在 inflightCalls 中的键，请求ID只在会话内唯一
+func inflightKey(sessionID string, requestID any) string {
+	return sessionID + "/" + mcp.NewRequestId(requestID).String()
+}
+
+// sessionIDFromContext 返回上下文中的会话ID
+func sessionIDFromContext(ctx context.Context) string {
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		return session.SessionID()
+	}
+	return ""
+}
+
+// recordRequestID 在调用工具前把请求ID写入 _meta，供 toolContextMiddleware 登记取消函数
+func recordRequestID(ctx context.Context, id any, request *mcp.CallToolRequest) {
+	if id == nil {
+		return
+	}
+	if request.Params.Meta == nil {
+		request.Params.Meta = &mcp.Meta{}
+	}
+	if request.Params.Meta.AdditionalFields == nil {
+		request.Params.Meta.AdditionalFields = make(map[string]any)
+	}
+	request.Params.Meta.AdditionalFields[requestIDMetaKey] = id
+}
+
+// toolTimeout 返回配置中该工具的LLM调用超时时间，未配置时为0
+func toolTimeout(name string) time.Duration {
+	cfg := config.GetConfig()
+	if cfg == nil {
+		return 0
+	}
+	return time.Duration(cfg.Server.ToolTimeouts[name]) * time.Second
+}
+
+// toolContextMiddleware 为工具调用建立上下文：客户端可以通过取消通知中止调用，
+// 配置了工具级超时时间时覆盖其中每次LLM调用的超时时间
+func toolContextMiddleware(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		ctx, cancel := context.WithCancelCause(ctx)
+		defer cancel(nil)
+
+		if request.Params.Meta != nil {
+			if id, ok := request.Params.Meta.AdditionalFields[requestIDMetaKey]; ok {
+				key := inflightKey(sessionIDFromContext(ctx), id)
+				inflightCalls.Lock()
+				inflightCalls.cancels[key] = cancel
+				inflightCalls.Unlock()
+				defer func() {
+					inflightCalls.Lock()
+					delete(inflightCalls.cancels, key)
+					inflightCalls.Unlock()
+				}()
+			}
+		}
+
+		if timeout := toolTimeout(request.Params.Name); timeout > 0 {
+			ctx = llm.WithCallTimeout(ctx, timeout)
+		}
+
+		result, err := next(ctx, request)
+		if err != nil && errors.Is(context.Cause(ctx), errCancelledByClient) {
+			return nil, errCancelledByClient
+		}
+		return result, err
+	}
+}
+
+// cancelCall 取消会话中指定请求ID的工具调用，调用不存在（已结束）时返回 false
+func cancelCall(sessionID string, requestID any) bool {
+	inflightCalls.Lock()
+	cancel, ok := inflightCalls.cancels[inflightKey(sessionID, requestID)]
+	inflightCalls.Unlock()
+	if ok {
+		cancel(errCancelledByClient)
+	}
+	return ok
+}
+
+// cancelledNotificationHandler 处理客户端的取消通知，中止对应的工具调用及其中正在进行的生成
+func cancelledNotificationHandler(ctx context.Context, notification mcp.JSONRPCNotification) {
+	requestID, ok := notification.Params.AdditionalFields["requestId"]
+	if !ok {
+		return
+	}
+	reason, _ := notification.Params.AdditionalFields["reason"].(string)
+	if cancelCall(sessionIDFromContext(ctx), requestID) {
+		logger.Info("客户端取消了工具调用",
+			zap.Any("request_id", requestID),
+			zap.String("reason", reason))
+	}
+}
+
+// interceptCancellations 返回转发 in 中消息的 Reader，并在读到取消通知时立即处理。
+// mcp-go 的 stdio 服务逐条同步处理消息，工具执行期间不会读取后续消息，取消通知只能在这里提前处理
+func interceptCancellations(in io.Reader) io.Reader {
+	pr, pw := io.Pipe()
+	lines := make(chan []byte, 256)
+
+	go func() {
+		defer close(lines)
+		reader := bufio.NewReader(in)
+		for {
+			line, err := reader.ReadBytes('\n')
+			if len(line) > 0 && !handleStdioCancellation(line) {
+				lines <- line
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	go func() {
+		for line := range lines {
+			if _, err := pw.Write(line); err != nil {
+				return
+			}
+		}
+		pw.Close()
+	}()
+	return pr
+}
+
+// handleStdioCancellation 判断一行输入是否为取消通知，是则立即取消对应的工具调用
+func handleStdioCancellation(line []byte) bool {
+	var msg struct {
+		ID     any    `json:"id"`
+		Method string `json:"method"`
+		Params struct {
+			RequestID any    `json:"requestId"`
+			Reason    string `json:"reason"`
+		} `json:"params"`
+	}
+	if err := json.Unmarshal(line, &msg); err != nil || msg.Method != cancelledNotificationMethod || msg.ID != nil {
+		return false
+	}
+	if msg.Params.RequestID != nil && cancelCall(stdioSessionID, msg.Params.RequestID) {
+		logger.Info("客户端取消了工具调用",
+			zap.Any("request_id", msg.Params.RequestID),
+			zap.String("reason", msg.Params.Reason))
+	}
+	return true
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"agent-forge/internal/config"
+	"agent-forge/internal/llm"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useHangingLLM 启动一个直到请求被取消才返回的模拟服务器，返回被中止的请求数
+func useHangingLLM(t *testing.T, timeout int) *atomic.Int32 {
+	t.Helper()
+	var aborted atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// 读完请求体后服务器才能感知客户端断开连接
+		_, _ = io.Copy(io.Discard, r.Body)
+		select {
+		case <-r.Context().Done():
+			aborted.Add(1)
+		case <-time.After(10 * time.Second):
+		}
+	}))
+	t.Cleanup(srv.Close)
+
+	provider, err := llm.NewOpenAICompatible(config.ProviderConfig{
+		Name:    "fake",
+		BaseURL: srv.URL,
+		APIKey:  "test-key",
+		Model:   "deepseek-chat",
+		Timeout: timeout,
+	})
+	require.NoError(t, err)
+	registry, err := llm.NewRegistry("fake", provider)
+	require.NoError(t, err)
+	prev := llmProviders
+	llmProviders = registry
+	t.Cleanup(func() { llmProviders = prev })
+	return &aborted
+}
+
+// newCancellableServer 创建与 main 相同方式接入取消与超时处理的 MCP 服务，并注册一个调用LLM的工具
+func newCancellableServer() *server.MCPServer {
+	hooks := &server.Hooks{}
+	hooks.AddBeforeCallTool(recordRequestID)
+	s := server.NewMCPServer("test", "1.0.0",
+		server.WithHooks(hooks),
+		server.WithToolHandlerMiddleware(toolContextMiddleware),
+	)
+	s.AddNotificationHandler(cancelledNotificationMethod, cancelledNotificationHandler)
+	s.AddTool(mcp.NewTool("slow_tool"), func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		resp, err := chatLLM(ctx, llm.ChatRequest{Messages: []llm.Message{{Role: llm.RoleUser, Content: "hi"}}}, nil)
+		if err != nil {
+			return nil, err
+		}
+		return mcp.NewToolResultText(resp.Content), nil
+	})
+	return s
+}
+
+// callSlowTool 在后台调用 slow_tool，返回接收响应的通道
+func callSlowTool(s *server.MCPServer, id int) <-chan mcp.JSONRPCMessage {
+	done := make(chan mcp.JSONRPCMessage, 1)
+	go func() {
+		msg, _ := json.Marshal(map[string]interface{}{
+			"jsonrpc": "2.0",
+			"id":      id,
+			"method":  "tools/call",
+			"params":  map[string]interface{}{"name": "slow_tool"},
+		})
+		done <- s.HandleMessage(context.Background(), msg)
+	}()
+	return done
+}
+
+// responseError 返回响应中的错误信息
+func responseError(t *testing.T, msg mcp.JSONRPCMessage) string {
+	t.Helper()
+	errResp, ok := msg.(mcp.JSONRPCError)
+	require.True(t, ok, "expected an error response, got %#v", msg)
+	return errResp.Error.Message
+}
+
+func TestClientCancellationAbortsGeneration(t *testing.T) {
+	aborted := useHangingLLM(t, 0)
+	s := newCancellableServer()
+
+	done := callSlowTool(s, 7)
+	require.Eventually(t, func() bool {
+		inflightCalls.Lock()
+		defer inflightCalls.Unlock()
+		return len(inflightCalls.cancels) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	s.HandleMessage(context.Background(), json.RawMessage(
+		`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":7,"reason":"user stopped"}}`))
+
+	select {
+	case resp := <-done:
+		assert.Contains(t, responseError(t, resp), errCancelledByClient.Error())
+	case <-time.After(5 * time.Second):
+		t.Fatal("tool call was not cancelled")
+	}
+	assert.Eventually(t, func() bool { return aborted.Load() == 1 }, 5*time.Second, 10*time.Millisecond)
+
+	inflightCalls.Lock()
+	assert.Empty(t, inflightCalls.cancels)
+	inflightCalls.Unlock()
+}
+
+func TestProviderTimeoutAppliesWithCallerContext(t *testing.T) {
+	useHangingLLM(t, 1)
+	s := newCancellableServer()
+
+	select {
+	case resp := <-callSlowTool(s, 1):
+		assert.Contains(t, responseError(t, resp), llm.ErrTimeout.Error())
+	case <-time.After(5 * time.Second):
+		t.Fatal("provider timeout did not apply")
+	}
+}
+
+func TestToolTimeoutOverridesProviderTimeout(t *testing.T) {
+	useHangingLLM(t, 30)
+	cfg := config.GetConfig()
+	prev := cfg.Server.ToolTimeouts
+	cfg.Server.ToolTimeouts = map[string]int{"slow_tool": 1}
+	t.Cleanup(func() { cfg.Server.ToolTimeouts = prev })
+	s := newCancellableServer()
+
+	start := time.Now()
+	select {
+	case resp := <-callSlowTool(s, 1):
+		assert.Contains(t, responseError(t, resp), llm.ErrTimeout.Error())
+		assert.Less(t, time.Since(start), 5*time.Second)
+	case <-time.After(5 * time.Second):
+		t.Fatal("tool timeout did not apply")
+	}
+}
+
+func TestInterceptCancellations(t *testing.T) {
+	var cancelled atomic.Bool
+	key := inflightKey(stdioSessionID, float64(3))
+	inflightCalls.Lock()
+	inflightCalls.cancels[key] = func(cause error) { cancelled.Store(true) }
+	inflightCalls.Unlock()
+	t.Cleanup(func() {
+		inflightCalls.Lock()
+		delete(inflightCalls.cancels, key)
+		inflightCalls.Unlock()
+	})
+
+	input := strings.Join([]string{
+		`{"jsonrpc":"2.0","id":3,"method":"tools/call","params":{"name":"slow_tool"}}`,
+		`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":3}}`,
+		`{"jsonrpc":"2.0","id":4,"method":"ping"}`,
+	}, "\n") + "\n"
+
+	out, err := io.ReadAll(interceptCancellations(strings.NewReader(input)))
+	require.NoError(t, err)
+	assert.True(t, cancelled.Load())
+	assert.NotContains(t, string(out), "notifications/cancelled")
+	assert.Contains(t, string(out), `"id":3`)
+	assert.Contains(t, string(out), `"id":4`)
+}
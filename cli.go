@@ -0,0 +1,123 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"agent-forge/internal/config"
+	"agent-forge/internal/store"
+)
+
+// 命令行子命令
+const (
+	cmdExport = "export"
+	cmdImport = "import"
+)
+
+// isSubcommand 判断命令行参数是否为子命令
+func isSubcommand(arg string) bool {
+	return arg == cmdExport || arg == cmdImport
+}
+
+// runSubcommand 执行子命令并返回进程退出码
+// 子命令只操作智能体存储，不需要LLM提供方
+// 文件存储由进程整体读入、整体写回，子命令不能与使用同一存储文件的服务同时运行，否则服务下次写回时会覆盖导入的结果
+func runSubcommand(name string, args []string, stdout, stderr io.Writer) int {
+	var err error
+	switch name {
+	case cmdExport:
+		err = runExport(args, stdout, stderr)
+	case cmdImport:
+		err = runImport(args, stdout, stderr)
+	default:
+		err = fmt.Errorf("未知的子命令: %s", name)
+	}
+
+	if err == flag.ErrHelp {
+		return 0
+	}
+	if err != nil {
+		fmt.Fprintf(stderr, "%s失败: %v\n", name, err)
+		return 1
+	}
+	return 0
+}
+
+// runExport 导出智能体：agent-forge export [-o 文件] [-format yaml|json] <agent_id>
+func runExport(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet(cmdExport, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	output := fs.String("o", "", "输出文件路径，为空时输出到标准输出")
+	format := fs.String("format", "", "文件格式: yaml 或 json，默认根据输出文件扩展名推断")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "用法: agent-forge export [-o 文件] [-format yaml|json] <agent_id>")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("需要指定一个智能体ID")
+	}
+
+	if *format == "" {
+		*format = store.FormatFromPath(*output)
+	}
+	data, err := exportAgent(fs.Arg(0), *format)
+	if err != nil {
+		return err
+	}
+
+	if *output == "" {
+		_, err = stdout.Write(data)
+		return err
+	}
+	if err := os.WriteFile(*output, data, 0o644); err != nil {
+		return err
+	}
+	fmt.Fprintf(stdout, "已导出智能体 %s 到 %s\n", fs.Arg(0), *output)
+	return nil
+}
+
+// runImport 导入智能体：agent-forge import [-on-conflict error|replace|copy] <文件>
+// 只支持文件存储：内存存储随命令退出而丢弃，导入不会生效
+func runImport(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet(cmdImport, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	onConflict := fs.String("on-conflict", string(store.ConflictError), "ID或名称冲突时的处理方式: error、replace 或 copy")
+	fs.Usage = func() {
+		fmt.Fprintln(stderr, "用法: agent-forge import [-on-conflict error|replace|copy] <文件>")
+		fmt.Fprintln(stderr, "需要 store.backend 为 file，并且不能有正在使用同一存储文件的服务在运行")
+		fs.PrintDefaults()
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return fmt.Errorf("需要指定一个人格文件")
+	}
+	if cfg := config.GetConfig(); cfg != nil && (cfg.Store.Backend == "" || cfg.Store.Backend == "memory") {
+		return errors.New("store.backend 为 memory 时导入的智能体会随命令退出而丢失，请改用 file 存储，或通过运行中服务的 import_agent 工具导入")
+	}
+
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	agent, replaced, err := importAgent(data, *onConflict)
+	if err != nil {
+		return err
+	}
+
+	action := "新建"
+	if replaced {
+		action = "覆盖"
+	}
+	fmt.Fprintf(stdout, "已导入智能体 %s (%s)，方式: %s\n", agent.Name, agent.ID, action)
+	return nil
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"agent-forge/internal/config"
+	"agent-forge/internal/llm"
+	"agent-forge/internal/store"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// llmRequestLog 记录模拟服务器收到的请求
+type llmRequestLog struct {
+	mu       sync.Mutex
+	requests []openai.ChatCompletionRequest
+}
+
+// last 返回最近一次请求
+func (l *llmRequestLog) last() openai.ChatCompletionRequest {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.requests) == 0 {
+		return openai.ChatCompletionRequest{}
+	}
+	return l.requests[len(l.requests)-1]
+}
+
+// fakePersonaJSON 模拟服务器在 JSON 模式下返回的结构化人格
+const fakePersonaJSON = `{
+	"expertise_domains": ["系统设计", "创新管理"],
+	"traits": ["严谨", "好奇"],
+	"speaking_style": "简洁直接，善用类比",
+	"values": ["第一性原理"],
+	"knowledge_boundaries": ["医学诊断"],
+	"taboo_topics": ["政治立场"],
+	"example_utterances": ["先回到问题的本质。"]
+}`
+
+// fakeUsage 模拟服务器每次调用返回的用量
+var fakeUsage = openai.Usage{PromptTokens: 100, CompletionTokens: 20, TotalTokens: 120}
+
+// newFakeLLMServer 启动一个模拟 OpenAI 兼容接口的测试服务器，JSON 模式下返回 fakePersonaJSON，否则固定返回 reply
+func newFakeLLMServer(t *testing.T, reply string, log *llmRequestLog) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		if log != nil {
+			log.mu.Lock()
+			log.requests = append(log.requests, req)
+			log.mu.Unlock()
+		}
+		reply := reply
+		if req.ResponseFormat != nil && req.ResponseFormat.Type == openai.ChatCompletionResponseFormatTypeJSONObject {
+			reply = fakePersonaJSON
+		}
+		// 流式请求按字符逐段返回
+		if req.Stream {
+			w.Header().Set("Content-Type", "text/event-stream")
+			for _, r := range reply {
+				chunk, _ := json.Marshal(openai.ChatCompletionStreamResponse{
+					Model: "deepseek-chat",
+					Choices: []openai.ChatCompletionStreamChoice{{
+						Delta: openai.ChatCompletionStreamChoiceDelta{Content: string(r)},
+					}},
+				})
+				fmt.Fprintf(w, "data: %s\n\n", chunk)
+			}
+			if req.StreamOptions != nil && req.StreamOptions.IncludeUsage {
+				chunk, _ := json.Marshal(openai.ChatCompletionStreamResponse{Model: "deepseek-chat", Usage: &fakeUsage})
+				fmt.Fprintf(w, "data: %s\n\n", chunk)
+			}
+			fmt.Fprint(w, "data: [DONE]\n\n")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			ID:     "chatcmpl-test",
+			Object: "chat.completion",
+			Model:  "deepseek-chat",
+			Choices: []openai.ChatCompletionChoice{{
+				Index:        0,
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: reply},
+				FinishReason: openai.FinishReasonStop,
+			}},
+			Usage: fakeUsage,
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// useFakeLLM 将LLM提供方指向模拟服务器，测试结束后恢复，返回请求记录
+func useFakeLLM(t *testing.T, reply string) *llmRequestLog {
+	t.Helper()
+	log := &llmRequestLog{}
+	srv := newFakeLLMServer(t, reply, log)
+	useFakeProvider(t, srv.URL)
+	return log
+}
+
+// useFakeLLMFunc 将LLM提供方指向由 reply 决定回复内容的模拟服务器（不支持流式），reply 在持有请求记录锁时调用
+func useFakeLLMFunc(t *testing.T, reply func(req openai.ChatCompletionRequest) string) *llmRequestLog {
+	t.Helper()
+	log := &llmRequestLog{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		log.mu.Lock()
+		log.requests = append(log.requests, req)
+		content := reply(req)
+		log.mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Model: "deepseek-chat",
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content},
+				FinishReason: openai.FinishReasonStop,
+			}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	useFakeProvider(t, srv.URL)
+	return log
+}
+
+// useFakeProvider 将LLM提供方指向指定地址，测试结束后恢复
+func useFakeProvider(t *testing.T, baseURL string) {
+	t.Helper()
+	provider, err := llm.NewOpenAICompatible(config.ProviderConfig{
+		Name:    "fake",
+		BaseURL: baseURL,
+		APIKey:  "test-key",
+		Model:   "deepseek-chat",
+	})
+	require.NoError(t, err)
+	registry, err := llm.NewRegistry("fake", provider)
+	require.NoError(t, err)
+
+	prev := llmProviders
+	llmProviders = registry
+	t.Cleanup(func() { llmProviders = prev })
+}
+
+// newToolRequest 构造工具调用请求
+func newToolRequest(name string, args map[string]interface{}) mcp.CallToolRequest {
+	var req mcp.CallToolRequest
+	req.Params.Name = name
+	req.Params.Arguments = args
+	return req
+}
+
+// toolResultText 返回工具调用结果中的文本
+func toolResultText(t *testing.T, result *mcp.CallToolResult) string {
+	t.Helper()
+	require.NotNil(t, result)
+	require.NotEmpty(t, result.Content)
+	text, ok := result.Content[0].(mcp.TextContent)
+	require.True(t, ok)
+	return text.Text
+}
+
+// toolResultJSON 解析工具调用返回的JSON文本
+func toolResultJSON(t *testing.T, result *mcp.CallToolResult) map[string]interface{} {
+	t.Helper()
+	var data map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(toolResultText(t, result)), &data))
+	return data
+}
+
+func TestConcurrentAgentHandlers(t *testing.T) {
+	useFakeLLM(t, "模拟回答")
+	agents = store.NewRegistry(store.NewMemoryStore())
+
+	ctx := context.Background()
+
+	// 预先创建一批智能体，供并发更新、回答和删除使用
+	const seedCount = 8
+	ids := make([]string, 0, seedCount)
+	for i := 0; i < seedCount; i++ {
+		result, err := createToolHandler(ctx, newToolRequest("expert_personality_generation", map[string]interface{}{
+			"agent_name":  fmt.Sprintf("专家%d", i),
+			"core_traits": "严谨,好奇",
+		}))
+		require.NoError(t, err)
+		ids = append(ids, toolResultJSON(t, result)["agent_id"].(string))
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		id := ids[i%seedCount]
+		wg.Add(4)
+
+		go func(i int) {
+			defer wg.Done()
+			_, err := createToolHandler(ctx, newToolRequest("expert_personality_generation", map[string]interface{}{
+				"agent_name":  fmt.Sprintf("并发专家%d", i),
+				"core_traits": "创新",
+			}))
+			assert.NoError(t, err)
+		}(i)
+
+		go func(i int) {
+			defer wg.Done()
+			// 智能体可能已被并发删除，此处只关心是否存在数据竞争
+			_, _ = updateAgentHandler(ctx, newToolRequest("update_agent", map[string]interface{}{
+				"agent_id":    id,
+				"name":        fmt.Sprintf("更新%d", i),
+				"core_traits": "务实",
+			}))
+		}(i)
+
+		go func() {
+			defer wg.Done()
+			_, _ = answerToolHandler(ctx, newToolRequest("agent_answer", map[string]interface{}{
+				"agent_id": id,
+				"context":  "你怎么看？",
+			}))
+		}()
+
+		go func(i int) {
+			defer wg.Done()
+			if i%10 == 9 {
+				_, _ = deleteAgentHandler(ctx, newToolRequest("delete_agent", map[string]interface{}{
+					"agent_id": id,
+				}))
+				return
+			}
+			_, _ = listAgentsHandler(ctx, newToolRequest("list_agents", nil))
+		}(i)
+	}
+	wg.Wait()
+
+	list, err := agents.List()
+	require.NoError(t, err)
+	// 50个新建的智能体都应存在，种子智能体可能已被删除
+	assert.GreaterOrEqual(t, len(list), 50)
+	for _, agent := range list {
+		assert.NotEmpty(t, agent.Personality)
+	}
+}
+
+func TestUpdateDoesNotLeakIntoSnapshots(t *testing.T) {
+	useFakeLLM(t, "新的人格")
+	agents = store.NewRegistry(store.NewMemoryStore())
+	require.NoError(t, agents.Create(Agent{ID: "a1", Name: "原名", CoreTraits: "旧特质", Personality: "旧人格"}))
+
+	snapshot, err := getStoredAgent("a1")
+	require.NoError(t, err)
+
+	_, err = updateAgentHandler(context.Background(), newToolRequest("update_agent", map[string]interface{}{
+		"agent_id":    "a1",
+		"name":        "新名",
+		"core_traits": "新特质",
+	}))
+	require.NoError(t, err)
+
+	// 更新前取得的快照保持不变
+	assert.Equal(t, "原名", snapshot.Name)
+	assert.Equal(t, "旧人格", snapshot.Personality)
+
+	updated, err := getStoredAgent("a1")
+	require.NoError(t, err)
+	assert.Equal(t, "新名", updated.Name)
+	assert.Equal(t, "新特质", updated.CoreTraits)
+	// 更新特质后重新生成结构化人格，人格描述由其渲染
+	require.NotNil(t, updated.Persona)
+	assert.Equal(t, "简洁直接，善用类比", updated.Persona.SpeakingStyle)
+	assert.Contains(t, updated.Personality, "说话风格：简洁直接，善用类比")
+	assert.Nil(t, snapshot.Persona)
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"agent-forge/internal/config"
+	"agent-forge/internal/llm"
+	"agent-forge/internal/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useFailingPrimaryLLM 配置始终返回 503 的首选提供方 deepseek 和正常的备用提供方 ollama，返回首选提供方收到的请求数
+func useFailingPrimaryLLM(t *testing.T, reply string) (*atomic.Int32, *llmRequestLog) {
+	t.Helper()
+	var primaryCalls atomic.Int32
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		primaryCalls.Add(1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	t.Cleanup(down.Close)
+	log := &llmRequestLog{}
+	backup := newFakeLLMServer(t, reply, log)
+
+	primary, err := llm.NewOpenAICompatible(config.ProviderConfig{Name: "deepseek", BaseURL: down.URL, APIKey: "test-key", Model: "deepseek-chat"})
+	require.NoError(t, err)
+	local, err := llm.NewOpenAICompatible(config.ProviderConfig{Name: "ollama", BaseURL: backup.URL, Model: "qwen2.5"})
+	require.NoError(t, err)
+	registry, err := llm.NewRegistry("deepseek", primary, local)
+	require.NoError(t, err)
+	require.NoError(t, registry.SetFallback([]string{"ollama"}))
+
+	prev := llmProviders
+	llmProviders = registry
+	t.Cleanup(func() { llmProviders = prev })
+	return &primaryCalls, log
+}
+
+func TestFallbackProviderReportedInResults(t *testing.T) {
+	primaryCalls, requests := useFailingPrimaryLLM(t, "备用模型的回答")
+	agents = store.NewRegistry(store.NewMemoryStore())
+	ctx := context.Background()
+
+	result, err := createToolHandler(ctx, newToolRequest("expert_personality_generation", map[string]interface{}{
+		"agent_name":  "运维专家",
+		"core_traits": "稳健,务实",
+	}))
+	require.NoError(t, err)
+	created := toolResultJSON(t, result)
+	assert.Equal(t, "ollama", created["provider"])
+	agentID := created["agent_id"].(string)
+
+	result, err = answerToolHandler(ctx, newToolRequest("agent_answer", map[string]interface{}{
+		"agent_id": agentID,
+		"context":  "服务挂了怎么办",
+	}))
+	require.NoError(t, err)
+	answer := toolResultJSON(t, result)
+	assert.Equal(t, "备用模型的回答", answer["content"])
+	assert.Equal(t, "ollama", answer["provider"])
+
+	// 备用提供方使用自己的默认模型
+	assert.Equal(t, "qwen2.5", requests.last().Model)
+	assert.Equal(t, int32(2), primaryCalls.Load())
+
+	result, err = updateAgentHandler(ctx, newToolRequest("update_agent", map[string]interface{}{
+		"agent_id":    agentID,
+		"core_traits": "稳健,果断",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "ollama", toolResultJSON(t, result)["provider"])
+
+	result, err = batchCreateAgentsHandler(ctx, newToolRequest("batch_create_agents", map[string]interface{}{
+		"agents": []interface{}{
+			map[string]interface{}{"agent_name": "数据库专家", "core_traits": "细致"},
+		},
+	}))
+	require.NoError(t, err)
+	items := toolResultJSON(t, result)["results"].([]interface{})
+	require.Len(t, items, 1)
+	assert.Equal(t, "ollama", items[0].(map[string]interface{})["provider"])
+
+	result, err = runRoundTableHandler(ctx, newToolRequest("run_round_table", map[string]interface{}{
+		"topic":            "如何减少故障",
+		"agent_ids":        []interface{}{agentID},
+		"resonance_rounds": float64(0),
+	}))
+	require.NoError(t, err)
+	roundTable := toolResultJSON(t, result)
+	assert.Equal(t, "ollama", roundTable["report_provider"])
+	transcript := roundTable["transcript"].([]interface{})
+	require.NotEmpty(t, transcript)
+	for _, turn := range transcript {
+		assert.Equal(t, "ollama", turn.(map[string]interface{})["provider"])
+	}
+}
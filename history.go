@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+
+	"agent-forge/internal/llm"
+	"agent-forge/internal/store"
+)
+
+// speakerContent 在内容前加上发言者名称，让模型分辨多位参与者
+func speakerContent(name, content string) string {
+	if name == "" {
+		return content
+	}
+	return fmt.Sprintf("%s：%s", name, content)
+}
+
+// sessionHistory 将会话记录转换为指定智能体视角的消息历史：
+// 智能体自己的发言为 assistant，其他智能体和主持人的发言为带名称的 user
+func sessionHistory(session Session, agentID string) []llm.Message {
+	history := make([]llm.Message, 0, len(session.Turns))
+	for _, turn := range session.Turns {
+		if turn.Speaker == store.SpeakerAgent && turn.AgentID == agentID {
+			history = append(history, llm.Message{
+				Role:    llm.RoleAssistant,
+				Content: turn.Content,
+			})
+			continue
+		}
+		history = append(history, llm.Message{
+			Role:    llm.RoleUser,
+			Name:    turn.Name,
+			Content: speakerContent(turn.Name, turn.Content),
+		})
+	}
+	return history
+}
+
+// parseHistoryArg 解析工具参数中的对话历史，每项包含 role（user/assistant）、content 和可选的 name
+func parseHistoryArg(args map[string]interface{}, key string) ([]llm.Message, error) {
+	raw, ok := args[key]
+	if !ok {
+		return nil, nil
+	}
+	items, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be an array of messages", key)
+	}
+
+	history := make([]llm.Message, 0, len(items))
+	for i, item := range items {
+		entry, ok := item.(map[string]interface{})
+		if !ok {
+			return nil, fmt.Errorf("%s[%d] must be an object", key, i)
+		}
+		role, _ := entry["role"].(string)
+		if role != llm.RoleUser && role != llm.RoleAssistant {
+			return nil, fmt.Errorf("%s[%d].role must be user or assistant", key, i)
+		}
+		content, ok := entry["content"].(string)
+		if !ok {
+			return nil, fmt.Errorf("%s[%d].content must be a string", key, i)
+		}
+		name, _ := entry["name"].(string)
+		if role == llm.RoleUser {
+			content = speakerContent(name, content)
+		}
+		history = append(history, llm.Message{Role: role, Name: name, Content: content})
+	}
+	return history, nil
+}
+
+// historyMessages 组装系统提示词、历史发言和本次问题
+func historyMessages(systemPrompt string, history []llm.Message, question string) []llm.Message {
+	messages := make([]llm.Message, 0, len(history)+2)
+	messages = append(messages, llm.Message{Role: llm.RoleSystem, Content: systemPrompt})
+	messages = append(messages, history...)
+	return append(messages, llm.Message{Role: llm.RoleUser, Content: question})
+}
@@ -10,24 +10,86 @@ import (
 
 // Config 结构体定义了所有配置项
 type Config struct {
-	Server   ServerConfig   `mapstructure:"server"`
-	DeepSeek DeepSeekConfig `mapstructure:"deepseek"`
-	Log      LogConfig      `mapstructure:"log"`
+	Server          ServerConfig     `mapstructure:"server"`
+	DeepSeek        DeepSeekConfig   `mapstructure:"deepseek"`
+	Providers       []ProviderConfig `mapstructure:"providers"`        // LLM 提供方列表，为空时使用 deepseek 配置
+	DefaultProvider string           `mapstructure:"default_provider"` // 默认使用的提供方名称
+	// Fallback 故障转移链，每项为提供方名称或 "提供方/模型"，首选提供方持续失败时按顺序尝试
+	Fallback       []string             `mapstructure:"fallback"`
+	CircuitBreaker CircuitBreakerConfig `mapstructure:"circuit_breaker"`
+	Log            LogConfig            `mapstructure:"log"`
+	Store          StoreConfig          `mapstructure:"store"`
+	Library        LibraryConfig        `mapstructure:"library"`
+	Batch          BatchConfig          `mapstructure:"batch"`
+	Cache          CacheConfig          `mapstructure:"cache"`
+	Usage          UsageConfig          `mapstructure:"usage"`
 }
 
 // ServerConfig 服务器配置
 type ServerConfig struct {
+	Transport       string `mapstructure:"transport"` // 传输方式：stdio、sse 或 http（streamable HTTP）
 	Port            int    `mapstructure:"port"`
 	Host            string `mapstructure:"host"`
+	BaseURL         string `mapstructure:"base_url"`         // 对外访问地址，SSE 模式下用于生成消息端点
 	ShutdownTimeout int    `mapstructure:"shutdown_timeout"` // 优雅关闭超时时间（秒）
+	// ToolTimeouts 按工具名称覆盖单次LLM调用的超时时间（秒），未配置的工具使用提供方的 timeout
+	ToolTimeouts map[string]int `mapstructure:"tool_timeouts"`
 }
 
 // DeepSeekConfig DeepSeek API配置
 type DeepSeekConfig struct {
-	APIKey      string  `mapstructure:"api_key"`
-	BaseURL     string  `mapstructure:"base_url"`
-	Temperature float64 `mapstructure:"temperature"`
-	Timeout     int     `mapstructure:"timeout"` // API调用超时时间（秒）
+	APIKey      string      `mapstructure:"api_key"`
+	BaseURL     string      `mapstructure:"base_url"`
+	Temperature float64     `mapstructure:"temperature"`
+	Timeout     int         `mapstructure:"timeout"` // API调用超时时间（秒）
+	Retry       RetryConfig `mapstructure:"retry"`
+}
+
+// RetryConfig LLM 调用失败时的重试配置
+// 仅重试速率限制、超时、服务不可用和空回复，响应中带有 Retry-After 时按其等待
+type RetryConfig struct {
+	MaxAttempts    int `mapstructure:"max_attempts"`    // 包含首次请求在内的最大尝试次数，1 表示不重试
+	InitialBackoff int `mapstructure:"initial_backoff"` // 首次重试前的基准等待时间（毫秒），之后每次翻倍并加入随机抖动
+	MaxBackoff     int `mapstructure:"max_backoff"`     // 单次等待时间上限（毫秒）
+	Budget         int `mapstructure:"budget"`          // 一次调用中所有重试等待时间之和的上限（毫秒），0 表示不限制
+}
+
+// ProviderConfig LLM 提供方配置，适用于任意 OpenAI 兼容接口（DeepSeek、OpenAI、Ollama、vLLM 等）
+type ProviderConfig struct {
+	Name        string      `mapstructure:"name"`
+	BaseURL     string      `mapstructure:"base_url"`
+	APIKey      string      `mapstructure:"api_key"`
+	APIKeyEnv   string      `mapstructure:"api_key_env"` // 从指定环境变量读取密钥
+	Model       string      `mapstructure:"model"`
+	Temperature *float64    `mapstructure:"temperature"` // 未配置时使用服务端默认温度，显式配置的 0 会照常生效
+	Timeout     int         `mapstructure:"timeout"`     // API调用超时时间（秒）
+	Retry       RetryConfig `mapstructure:"retry"`       // 未配置时使用 deepseek.retry
+
+	EmbeddingModel string `mapstructure:"embedding_model"` // 向量模型，为空表示该提供方不提供 embeddings 接口
+}
+
+// CircuitBreakerConfig 提供方熔断配置
+// 提供方连续多次调用以可重试的失败告终（重试用尽）后熔断，冷却期内直接跳到故障转移链中的下一个提供方
+type CircuitBreakerConfig struct {
+	FailureThreshold int `mapstructure:"failure_threshold"` // 触发熔断的连续失败次数，0 表示不熔断
+	Cooldown         int `mapstructure:"cooldown"`          // 熔断后的冷却时间（秒），之后放行一次试探调用
+}
+
+// LLMProviders 返回生效的提供方列表
+// 未配置 providers 时，根据 deepseek 配置生成默认提供方以兼容旧配置
+func (c *Config) LLMProviders() []ProviderConfig {
+	if len(c.Providers) > 0 {
+		return c.Providers
+	}
+	return []ProviderConfig{{
+		Name:        "deepseek",
+		BaseURL:     c.DeepSeek.BaseURL,
+		APIKey:      c.DeepSeek.APIKey,
+		Model:       "deepseek-chat",
+		Temperature: &c.DeepSeek.Temperature,
+		Timeout:     c.DeepSeek.Timeout,
+		Retry:       c.DeepSeek.Retry,
+	}}
 }
 
 // LogConfig 日志配置
@@ -37,6 +99,50 @@ type LogConfig struct {
 	File    string `mapstructure:"file"`    // 日志文件路径
 }
 
+// StoreConfig 智能体存储配置
+type StoreConfig struct {
+	Backend     string `mapstructure:"backend"`      // 存储后端：memory 或 file
+	Path        string `mapstructure:"path"`         // 文件存储路径（backend 为 file 时生效）
+	SessionPath string `mapstructure:"session_path"` // 讨论会话的文件存储路径（backend 为 file 时生效）
+	VersionPath string `mapstructure:"version_path"` // 智能体版本历史的文件存储路径（backend 为 file 时生效）
+}
+
+// LibraryConfig 智能体库配置
+// 启动时从目录加载预置的人格文件，不调用LLM生成人格
+type LibraryConfig struct {
+	Dir   string `mapstructure:"dir"`   // 人格文件目录，为空时不加载
+	Watch bool   `mapstructure:"watch"` // 是否监听目录变化并热加载
+}
+
+// BatchConfig 批量创建智能体配置
+type BatchConfig struct {
+	Concurrency int `mapstructure:"concurrency"` // 同时生成人格的最大并发数
+	MaxItems    int `mapstructure:"max_items"`   // 单次批量创建的最大数量
+}
+
+// CacheConfig LLM 响应缓存配置
+// 创建智能体和智能体回答时，模型、消息与采样参数完全相同的请求直接返回缓存的结果
+type CacheConfig struct {
+	Backend    string `mapstructure:"backend"`     // 缓存后端：none、memory 或 file
+	Path       string `mapstructure:"path"`        // file 后端的缓存目录
+	TTL        int    `mapstructure:"ttl"`         // 缓存有效期（秒），0 表示不过期
+	MaxEntries int    `mapstructure:"max_entries"` // 最多缓存的结果数，超出时淘汰最久未使用的，0 表示不限制
+}
+
+// UsageConfig token 用量统计与计费配置
+type UsageConfig struct {
+	Currency string       `mapstructure:"currency"` // 价格的货币单位，仅用于展示
+	Prices   []ModelPrice `mapstructure:"prices"`   // 按模型配置的价格，未配置价格的模型费用记为 0
+}
+
+// ModelPrice 模型的 token 单价（每百万 token）
+// 模型名称中可能含有 "."，因此使用列表而不是以模型为键的映射
+type ModelPrice struct {
+	Model      string  `mapstructure:"model"`      // 模型名称或 "提供方/模型"，后者优先匹配
+	Prompt     float64 `mapstructure:"prompt"`     // 每百万输入 token 的价格
+	Completion float64 `mapstructure:"completion"` // 每百万输出 token 的价格
+}
+
 var cfg *Config
 
 // LoadConfig 加载配置文件
@@ -88,16 +194,47 @@ func LoadConfig() (*Config, error) {
 		}
 	}
 
+	// 相对的存储、缓存与智能体库路径按可执行文件所在目录解析，与默认值一致，不随进程的工作目录变化
+	// stdio 模式下 MCP 客户端通常从其他目录启动服务
+	cfg.Store.Path = resolvePath(execDir, cfg.Store.Path)
+	cfg.Store.SessionPath = resolvePath(execDir, cfg.Store.SessionPath)
+	cfg.Store.VersionPath = resolvePath(execDir, cfg.Store.VersionPath)
+	cfg.Cache.Path = resolvePath(execDir, cfg.Cache.Path)
+	cfg.Library.Dir = resolvePath(execDir, cfg.Library.Dir)
+
 	// 环境变量覆盖
 	if apiKey := os.Getenv("DEEPSEEK_API_KEY"); apiKey != "" {
 		cfg.DeepSeek.APIKey = apiKey
 	}
+	for i := range cfg.Providers {
+		p := &cfg.Providers[i]
+		if p.APIKeyEnv != "" {
+			if apiKey := os.Getenv(p.APIKeyEnv); apiKey != "" {
+				p.APIKey = apiKey
+			}
+		}
+		if p.Timeout <= 0 {
+			p.Timeout = cfg.DeepSeek.Timeout
+		}
+		if p.Retry.MaxAttempts <= 0 {
+			p.Retry = cfg.DeepSeek.Retry
+		}
+	}
 
 	return cfg, nil
 }
 
+// resolvePath 将相对路径解析为 dir 下的绝对路径，空路径和绝对路径保持不变
+func resolvePath(dir, path string) string {
+	if path == "" || filepath.IsAbs(path) {
+		return path
+	}
+	return filepath.Join(dir, path)
+}
+
 // setDefaults 设置默认配置值
 func setDefaults(execDir string) {
+	viper.SetDefault("server.transport", "stdio")
 	viper.SetDefault("server.port", 8080)
 	viper.SetDefault("server.host", "localhost")
 	viper.SetDefault("server.shutdown_timeout", 30)
@@ -105,12 +242,40 @@ func setDefaults(execDir string) {
 	viper.SetDefault("deepseek.base_url", "https://api.deepseek.com")
 	viper.SetDefault("deepseek.temperature", 0.7)
 	viper.SetDefault("deepseek.timeout", 30)
+	viper.SetDefault("deepseek.retry.max_attempts", 3)
+	viper.SetDefault("deepseek.retry.initial_backoff", 500)
+	viper.SetDefault("deepseek.retry.max_backoff", 8000)
+	viper.SetDefault("deepseek.retry.budget", 20000)
+	viper.SetDefault("circuit_breaker.failure_threshold", 3)
+	viper.SetDefault("circuit_breaker.cooldown", 30)
 
 	// 使用绝对路径设置日志文件路径
 	defaultLogPath := filepath.Join(execDir, "logs", "agent-forge.log")
 	viper.SetDefault("log.enabled", false) // 默认关闭文件日志
 	viper.SetDefault("log.level", "info")
 	viper.SetDefault("log.file", defaultLogPath)
+
+	// 默认使用文件存储，智能体在进程重启后依然可用
+	viper.SetDefault("store.backend", "file")
+	viper.SetDefault("store.path", filepath.Join(execDir, "data", "agents.json"))
+	viper.SetDefault("store.session_path", filepath.Join(execDir, "data", "sessions.json"))
+	viper.SetDefault("store.version_path", filepath.Join(execDir, "data", "versions.json"))
+
+	// 默认不加载智能体库，配置目录后默认开启热加载
+	viper.SetDefault("library.dir", "")
+	viper.SetDefault("library.watch", true)
+
+	// 批量创建时限制并发，避免触发提供方的速率限制
+	viper.SetDefault("batch.concurrency", 4)
+	viper.SetDefault("batch.max_items", 20)
+
+	// 默认在内存中缓存一天内的LLM响应
+	viper.SetDefault("cache.backend", "memory")
+	viper.SetDefault("cache.path", filepath.Join(execDir, "data", "cache"))
+	viper.SetDefault("cache.ttl", 86400)
+	viper.SetDefault("cache.max_entries", 1000)
+
+	viper.SetDefault("usage.currency", "USD")
 }
 
 // GetConfig 获取配置实例
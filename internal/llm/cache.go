@@ -0,0 +1,318 @@
+package llm
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-forge/internal/config"
+)
+
+// Cache 对话补全结果的缓存，键由 Registry.CacheKey 计算
+type Cache interface {
+	// Get 返回未过期的缓存结果副本
+	Get(key string) (*ChatResponse, bool)
+	// Put 缓存结果，超出数量上限时淘汰最久未使用的条目
+	Put(key string, resp *ChatResponse) error
+}
+
+// NewCache 根据配置创建响应缓存，backend 为空或 none 时返回 nil，表示不缓存
+func NewCache(cfg config.CacheConfig) (Cache, error) {
+	ttl := time.Duration(cfg.TTL) * time.Second
+	switch cfg.Backend {
+	case "", "none":
+		return nil, nil
+	case "memory":
+		return NewMemoryCache(cfg.MaxEntries, ttl), nil
+	case "file":
+		return NewFileCache(cfg.Path, cfg.MaxEntries, ttl)
+	default:
+		return nil, fmt.Errorf("不支持的缓存后端: %s", cfg.Backend)
+	}
+}
+
+// cacheKeyFields 参与计算缓存键的请求内容，除模型、消息、温度和种子外，其他会改变输出的参数也包含在内
+type cacheKeyFields struct {
+	Route       string
+	Messages    []Message
+	Temperature *float64
+	TopP        *float64
+	MaxTokens   int
+	Seed        *int
+	JSONMode    bool
+}
+
+// CacheKey 计算请求的缓存键，模型按首选的提供方与实际模型计算，同一模型的不同写法共用缓存
+func (r *Registry) CacheKey(req ChatRequest) string {
+	provider, model := r.Resolve(req.Model)
+	data, _ := json.Marshal(cacheKeyFields{
+		Route:       routeKey(provider, model),
+		Messages:    req.Messages,
+		Temperature: req.Temperature,
+		TopP:        req.TopP,
+		MaxTokens:   req.MaxTokens,
+		Seed:        req.Seed,
+		JSONMode:    req.JSONMode,
+	})
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// temperatureProvider 可以报告默认温度的提供方
+type temperatureProvider interface {
+	Temperature() *float64
+}
+
+// Deterministic 判断请求的输出是否可复现：指定了种子，或实际使用的温度为 0
+// 只有可复现的请求才适合缓存，否则相同的请求每次都应得到新的回答
+func (r *Registry) Deterministic(req ChatRequest) bool {
+	if req.Seed != nil {
+		return true
+	}
+	temperature := req.Temperature
+	if temperature == nil {
+		provider, _ := r.Resolve(req.Model)
+		if p, ok := provider.(temperatureProvider); ok {
+			temperature = p.Temperature()
+		}
+	}
+	return temperature != nil && *temperature == 0
+}
+
+// cacheEntry 缓存条目
+type cacheEntry struct {
+	Response  ChatResponse `json:"response"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+// expired 判断条目是否已超过有效期，ttl 不大于 0 时永不过期
+func (e *cacheEntry) expired(ttl time.Duration, now time.Time) bool {
+	return ttl > 0 && now.Sub(e.CreatedAt) > ttl
+}
+
+// hit 返回标记为缓存命中的结果副本，缓存命中不消耗 token，用量为零
+func (e *cacheEntry) hit() *ChatResponse {
+	resp := e.Response
+	resp.Cached = true
+	resp.Usage = Usage{}
+	return &resp
+}
+
+// lru 最近最少使用的淘汰顺序，maxEntries 不大于 0 时不限制数量
+type lru struct {
+	maxEntries int
+	order      *list.List // 元素为键，最近使用的在前
+	elements   map[string]*list.Element
+}
+
+func newLRU(maxEntries int) *lru {
+	return &lru{maxEntries: maxEntries, order: list.New(), elements: make(map[string]*list.Element)}
+}
+
+// touch 将键标记为最近使用，不存在时加入，返回因超出数量上限被淘汰的键
+func (l *lru) touch(key string) []string {
+	if el, ok := l.elements[key]; ok {
+		l.order.MoveToFront(el)
+		return nil
+	}
+	l.elements[key] = l.order.PushFront(key)
+
+	var evicted []string
+	for l.maxEntries > 0 && l.order.Len() > l.maxEntries {
+		oldest := l.order.Back()
+		key := oldest.Value.(string)
+		l.order.Remove(oldest)
+		delete(l.elements, key)
+		evicted = append(evicted, key)
+	}
+	return evicted
+}
+
+// remove 删除键
+func (l *lru) remove(key string) {
+	if el, ok := l.elements[key]; ok {
+		l.order.Remove(el)
+		delete(l.elements, key)
+	}
+}
+
+// MemoryCache 基于内存的 LRU 缓存，进程退出后丢失
+type MemoryCache struct {
+	mu      sync.Mutex
+	ttl     time.Duration
+	lru     *lru
+	entries map[string]*cacheEntry
+	now     func() time.Time
+}
+
+// NewMemoryCache 创建内存缓存，maxEntries 不大于 0 时不限制数量，ttl 不大于 0 时永不过期
+func NewMemoryCache(maxEntries int, ttl time.Duration) *MemoryCache {
+	return &MemoryCache{
+		ttl:     ttl,
+		lru:     newLRU(maxEntries),
+		entries: make(map[string]*cacheEntry),
+		now:     time.Now,
+	}
+}
+
+// Get 返回未过期的缓存结果副本
+func (c *MemoryCache) Get(key string) (*ChatResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if entry.expired(c.ttl, c.now()) {
+		c.lru.remove(key)
+		delete(c.entries, key)
+		return nil, false
+	}
+	c.lru.touch(key)
+	return entry.hit(), true
+}
+
+// Put 缓存结果副本
+func (c *MemoryCache) Put(key string, resp *ChatResponse) error {
+	if resp == nil {
+		return errors.New("response is required")
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cacheEntry{Response: *resp, CreatedAt: c.now()}
+	entry.Response.Cached = false
+	c.entries[key] = entry
+	for _, evicted := range c.lru.touch(key) {
+		delete(c.entries, evicted)
+	}
+	return nil
+}
+
+// FileCache 基于目录的缓存，每个条目保存为一个 JSON 文件，进程重启后依然可用
+// 淘汰顺序按文件修改时间恢复，命中时更新修改时间
+type FileCache struct {
+	mu  sync.Mutex
+	dir string
+	ttl time.Duration
+	lru *lru
+	now func() time.Time
+}
+
+// NewFileCache 打开（或初始化）缓存目录，已有条目按修改时间从旧到新载入淘汰顺序
+func NewFileCache(dir string, maxEntries int, ttl time.Duration) (*FileCache, error) {
+	if dir == "" {
+		return nil, errors.New("缓存目录不能为空")
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("创建缓存目录失败: %v", err)
+	}
+
+	c := &FileCache{dir: dir, ttl: ttl, lru: newLRU(maxEntries), now: time.Now}
+
+	files, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取缓存目录失败: %v", err)
+	}
+	type existing struct {
+		key     string
+		modTime time.Time
+	}
+	var found []existing
+	for _, f := range files {
+		key, ok := strings.CutSuffix(f.Name(), ".json")
+		if !ok || f.IsDir() {
+			continue
+		}
+		info, err := f.Info()
+		if err != nil {
+			continue
+		}
+		found = append(found, existing{key: key, modTime: info.ModTime()})
+	}
+	sort.Slice(found, func(i, j int) bool { return found[i].modTime.Before(found[j].modTime) })
+	for _, e := range found {
+		for _, evicted := range c.lru.touch(e.key) {
+			_ = os.Remove(c.path(evicted))
+		}
+	}
+	return c, nil
+}
+
+// path 返回条目的文件路径
+func (c *FileCache) path(key string) string {
+	return filepath.Join(c.dir, key+".json")
+}
+
+// Get 读取未过期的缓存结果，文件损坏或已过期时删除该条目
+func (c *FileCache) Get(key string) (*ChatResponse, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.lru.elements[key]; !ok {
+		return nil, false
+	}
+	data, err := os.ReadFile(c.path(key))
+	var entry cacheEntry
+	if err == nil {
+		err = json.Unmarshal(data, &entry)
+	}
+	now := c.now()
+	if err != nil || entry.expired(c.ttl, now) {
+		c.lru.remove(key)
+		_ = os.Remove(c.path(key))
+		return nil, false
+	}
+	c.lru.touch(key)
+	_ = os.Chtimes(c.path(key), now, now)
+	return entry.hit(), true
+}
+
+// Put 写入缓存文件，先写临时文件再重命名，避免写入中断导致文件损坏
+func (c *FileCache) Put(key string, resp *ChatResponse) error {
+	if resp == nil {
+		return errors.New("response is required")
+	}
+	entry := cacheEntry{Response: *resp, CreatedAt: c.now()}
+	entry.Response.Cached = false
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("序列化缓存条目失败: %v", err)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	tmp, err := os.CreateTemp(c.dir, key+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入缓存文件失败: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入缓存文件失败: %v", err)
+	}
+	if err := os.Rename(tmpName, c.path(key)); err != nil {
+		return fmt.Errorf("写入缓存文件失败: %v", err)
+	}
+
+	for _, evicted := range c.lru.touch(key) {
+		_ = os.Remove(c.path(evicted))
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package llm
+
+import (
+	"testing"
+	"time"
+
+	"agent-forge/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMemoryCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	c := NewMemoryCache(2, 0)
+	require.NoError(t, c.Put("a", &ChatResponse{Content: "A"}))
+	require.NoError(t, c.Put("b", &ChatResponse{Content: "B"}))
+	_, ok := c.Get("a")
+	require.True(t, ok)
+	require.NoError(t, c.Put("c", &ChatResponse{Content: "C"}))
+
+	// b 最久未使用，被淘汰
+	_, ok = c.Get("b")
+	assert.False(t, ok)
+	resp, ok := c.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, "A", resp.Content)
+	assert.True(t, resp.Cached)
+
+	// 返回的是副本，修改不影响缓存
+	resp.Content = "changed"
+	resp, _ = c.Get("a")
+	assert.Equal(t, "A", resp.Content)
+}
+
+func TestMemoryCacheTTL(t *testing.T) {
+	now := time.Now()
+	c := NewMemoryCache(0, time.Minute)
+	c.now = func() time.Time { return now }
+	require.NoError(t, c.Put("a", &ChatResponse{Content: "A"}))
+
+	now = now.Add(30 * time.Second)
+	_, ok := c.Get("a")
+	assert.True(t, ok)
+	now = now.Add(time.Minute)
+	_, ok = c.Get("a")
+	assert.False(t, ok)
+}
+
+func TestFileCachePersistsAndEvicts(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewFileCache(dir, 2, time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, c.Put("a", &ChatResponse{Content: "A", Provider: "deepseek", Model: "deepseek-chat"}))
+	require.NoError(t, c.Put("b", &ChatResponse{Content: "B"}))
+
+	// 重新打开后依然可用
+	reopened, err := NewFileCache(dir, 2, time.Hour)
+	require.NoError(t, err)
+	resp, ok := reopened.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, &ChatResponse{Content: "A", Provider: "deepseek", Model: "deepseek-chat", Cached: true}, resp)
+
+	require.NoError(t, reopened.Put("c", &ChatResponse{Content: "C"}))
+	_, ok = reopened.Get("b")
+	assert.False(t, ok)
+	assert.NoFileExists(t, reopened.path("b"))
+	_, ok = reopened.Get("c")
+	assert.True(t, ok)
+
+	expiring, err := NewFileCache(dir, 2, time.Hour)
+	require.NoError(t, err)
+	expiring.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+	_, ok = expiring.Get("c")
+	assert.False(t, ok)
+	assert.NoFileExists(t, expiring.path("c"))
+}
+
+func TestCacheKey(t *testing.T) {
+	p, err := NewOpenAICompatible(config.ProviderConfig{Name: "local", BaseURL: "http://localhost:11434/v1", Model: "qwen2.5"})
+	require.NoError(t, err)
+	r, err := NewRegistry("local", p)
+	require.NoError(t, err)
+
+	temperature, seed := 0.2, 1
+	base := ChatRequest{Messages: []Message{{Role: RoleUser, Content: "hi"}}}
+	withTemperature := base
+	withTemperature.Temperature = &temperature
+	withSeed := base
+	withSeed.Seed = &seed
+	otherModel := base
+	otherModel.Model = "llama3"
+	sameModel := base
+	sameModel.Model = "local"
+
+	key := r.CacheKey(base)
+	assert.Equal(t, key, r.CacheKey(sameModel), "同一模型的不同写法共用缓存")
+	for _, req := range []ChatRequest{withTemperature, withSeed, otherModel} {
+		assert.NotEqual(t, key, r.CacheKey(req))
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	zero, warm, seed := 0.0, 0.7, 1
+	greedy, err := NewOpenAICompatible(config.ProviderConfig{Name: "greedy", BaseURL: "http://localhost", Model: "m", Temperature: &zero})
+	require.NoError(t, err)
+	plain, err := NewOpenAICompatible(config.ProviderConfig{Name: "plain", BaseURL: "http://localhost", Model: "m"})
+	require.NoError(t, err)
+	r, err := NewRegistry("plain", plain, greedy)
+	require.NoError(t, err)
+
+	assert.False(t, r.Deterministic(ChatRequest{}), "服务端默认温度不可复现")
+	assert.False(t, r.Deterministic(ChatRequest{Sampling: Sampling{Temperature: &warm}}))
+	assert.True(t, r.Deterministic(ChatRequest{Sampling: Sampling{Temperature: &zero}}))
+	assert.True(t, r.Deterministic(ChatRequest{Sampling: Sampling{Temperature: &warm, Seed: &seed}}))
+	assert.True(t, r.Deterministic(ChatRequest{Sampling: Sampling{Model: "greedy"}}), "沿用提供方配置的温度 0")
+	assert.False(t, r.Deterministic(ChatRequest{Sampling: Sampling{Model: "greedy", Temperature: &warm}}))
+}
@@ -0,0 +1,137 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 调用失败的类型，可通过 errors.Is 判断
+var (
+	// ErrRateLimited 触发提供方的速率限制（HTTP 429）
+	ErrRateLimited = errors.New("rate limited")
+	// ErrAuth 密钥无效或没有权限（HTTP 401/403）
+	ErrAuth = errors.New("authentication failed")
+	// ErrTimeout 请求超时
+	ErrTimeout = errors.New("request timed out")
+	// ErrContentFiltered 请求或回复被提供方的内容审核拦截
+	ErrContentFiltered = errors.New("content filtered")
+	// ErrUnavailable 提供方暂时不可用（HTTP 5xx、网络错误或无法解析的响应）
+	ErrUnavailable = errors.New("service unavailable")
+	// ErrBadRequest 请求参数无效，重试不会成功
+	ErrBadRequest = errors.New("bad request")
+)
+
+// ErrEmptyResponse 表示模型返回结果为空
+var ErrEmptyResponse = errors.New("模型返回结果为空")
+
+// Error 提供方调用失败的详细信息
+type Error struct {
+	Provider   string
+	Kind       error // 失败类型，为上面定义的错误之一
+	StatusCode int   // HTTP 状态码，没有收到响应时为 0
+	Attempts   int   // 包含首次请求在内的尝试次数
+	Err        error // 原始错误
+}
+
+// Error 返回包含失败类型和原始错误的描述
+func (e *Error) Error() string {
+	var b strings.Builder
+	b.WriteString(e.Kind.Error())
+	if e.StatusCode > 0 {
+		fmt.Fprintf(&b, " (HTTP %d)", e.StatusCode)
+	}
+	if e.Attempts > 1 {
+		fmt.Fprintf(&b, " after %d attempts", e.Attempts)
+	}
+	if e.Err != nil && e.Err != e.Kind {
+		fmt.Fprintf(&b, ": %v", e.Err)
+	}
+	return b.String()
+}
+
+// Unwrap 同时支持按失败类型和原始错误判断
+func (e *Error) Unwrap() []error {
+	return []error{e.Kind, e.Err}
+}
+
+// Retryable 判断该类型的失败是否值得重试
+func (e *Error) Retryable() bool {
+	switch e.Kind {
+	case ErrRateLimited, ErrTimeout, ErrUnavailable, ErrEmptyResponse:
+		return true
+	default:
+		return false
+	}
+}
+
+// classifyError 将调用接口返回的错误归类，调用方取消请求时原样返回
+func classifyError(provider string, err error) error {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return err
+	}
+	var llmErr *Error
+	if errors.As(err, &llmErr) {
+		return err
+	}
+
+	e := &Error{Provider: provider, Err: err}
+	var apiErr *openai.APIError
+	var reqErr *openai.RequestError
+	var netErr net.Error
+	switch {
+	case errors.As(err, &apiErr):
+		e.StatusCode = apiErr.HTTPStatusCode
+		e.Kind = kindFromStatus(apiErr.HTTPStatusCode)
+		if isContentFilterError(apiErr) {
+			e.Kind = ErrContentFiltered
+		}
+	case errors.As(err, &reqErr):
+		e.StatusCode = reqErr.HTTPStatusCode
+		e.Kind = kindFromStatus(reqErr.HTTPStatusCode)
+	case errors.Is(err, ErrEmptyResponse):
+		e.Kind = ErrEmptyResponse
+	case errors.Is(err, ErrContentFiltered):
+		e.Kind = ErrContentFiltered
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		e.Kind = ErrTimeout
+	default:
+		e.Kind = ErrUnavailable
+	}
+	return e
+}
+
+// kindFromStatus 根据 HTTP 状态码判断失败类型
+func kindFromStatus(status int) error {
+	switch {
+	case status == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case status == http.StatusUnauthorized || status == http.StatusForbidden:
+		return ErrAuth
+	case status == http.StatusRequestTimeout || status == http.StatusGatewayTimeout:
+		return ErrTimeout
+	case status >= 500 || status == 0:
+		return ErrUnavailable
+	default:
+		return ErrBadRequest
+	}
+}
+
+// isContentFilterError 判断接口错误是否由内容审核引起
+// OpenAI 和 Azure 使用 content_filter / content_policy_violation 错误码，DeepSeek 返回 "Content Exists Risk"
+func isContentFilterError(apiErr *openai.APIError) bool {
+	code := strings.ToLower(fmt.Sprint(apiErr.Code))
+	if strings.Contains(code, "content_filter") || strings.Contains(code, "content_policy") {
+		return true
+	}
+	if apiErr.InnerError != nil && strings.Contains(strings.ToLower(apiErr.InnerError.Code), "content") {
+		return true
+	}
+	msg := strings.ToLower(apiErr.Message)
+	return strings.Contains(msg, "content exists risk") || strings.Contains(msg, "content management policy")
+}
@@ -0,0 +1,148 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrCircuitOpen 提供方的熔断器处于打开状态，本次调用被跳过
+var ErrCircuitOpen = errors.New("circuit open")
+
+// Route 调用顺序中的一个候选：提供方及实际请求的模型（为空表示使用提供方默认模型）
+type Route struct {
+	Provider LLMProvider
+	Model    string
+}
+
+// SetFallback 设置故障转移链，每一项为提供方名称或 "提供方/模型" 形式
+func (r *Registry) SetFallback(chain []string) error {
+	for _, ref := range chain {
+		name, _, _ := strings.Cut(ref, "/")
+		if _, ok := r.providers[name]; !ok {
+			return fmt.Errorf("故障转移链中的LLM提供方不存在: %s", ref)
+		}
+	}
+	r.fallback = append([]string(nil), chain...)
+	return nil
+}
+
+// SetCircuitBreaker 为所有提供方设置熔断器，连续 threshold 次可重试的失败后在 cooldown 内跳过该提供方
+// threshold 不大于 0 时不熔断
+func (r *Registry) SetCircuitBreaker(threshold int, cooldown time.Duration) {
+	for name := range r.providers {
+		r.breakers[name] = NewCircuitBreaker(threshold, cooldown)
+	}
+}
+
+// BreakerStates 返回各提供方熔断器的当前状态
+func (r *Registry) BreakerStates() map[string]string {
+	states := make(map[string]string, len(r.breakers))
+	for name, b := range r.breakers {
+		states[name] = b.State()
+	}
+	return states
+}
+
+// Routes 返回模型的调用顺序：先是 Resolve 选出的提供方，再依次是故障转移链中的各项，重复的提供方与模型只保留第一个
+func (r *Registry) Routes(model string) []Route {
+	provider, resolved := r.Resolve(model)
+	routes := []Route{{Provider: provider, Model: resolved}}
+	seen := map[string]bool{routeKey(provider, resolved): true}
+	for _, ref := range r.fallback {
+		p, m := r.Resolve(ref)
+		if key := routeKey(p, m); !seen[key] {
+			seen[key] = true
+			routes = append(routes, Route{Provider: p, Model: m})
+		}
+	}
+	return routes
+}
+
+// routeKey 以提供方名称和实际模型标识一个候选
+func routeKey(p LLMProvider, model string) string {
+	if model == "" {
+		model = p.Model()
+	}
+	return p.Name() + "/" + model
+}
+
+// Chat 按 Routes 的顺序发起对话补全，返回结果中的 Provider 和 Model 为实际处理请求的提供方与模型
+// 提供方重试用尽后仍是可重试的失败（速率限制、超时、服务不可用、空回复）或熔断器打开时，尝试下一个候选；
+// 其他失败（请求无效、鉴权失败、内容审核）换提供方也无济于事，直接返回。
+// onDelta 不为空且提供方支持流式输出时以流式方式调用，已经输出过增量内容后不再转移，避免调用方收到两段不同的回答
+func (r *Registry) Chat(ctx context.Context, req ChatRequest, onDelta func(delta string)) (*ChatResponse, error) {
+	var lastErr error
+	for _, route := range r.Routes(req.Model) {
+		name := route.Provider.Name()
+		breaker := r.breakers[name]
+		if !breaker.Allow() {
+			if lastErr == nil {
+				lastErr = &Error{Provider: name, Kind: ErrCircuitOpen}
+			}
+			continue
+		}
+
+		routeReq := req
+		routeReq.Model = route.Model
+		emitted := false
+		resp, err := chatRoute(ctx, route.Provider, routeReq, onDelta, &emitted)
+		if err == nil {
+			breaker.Success()
+			return resp, nil
+		}
+
+		var llmErr *Error
+		if !errors.As(err, &llmErr) || !llmErr.Retryable() || ctx.Err() != nil {
+			// 调用方取消或超时不代表提供方故障，不计入熔断
+			breaker.Release()
+			return nil, err
+		}
+		breaker.Failure()
+		lastErr = err
+		if emitted {
+			return nil, err
+		}
+	}
+	return nil, lastErr
+}
+
+// chatRoute 调用单个提供方，emitted 记录是否已经输出过增量内容
+func chatRoute(ctx context.Context, p LLMProvider, req ChatRequest, onDelta func(delta string), emitted *bool) (*ChatResponse, error) {
+	streamer, ok := p.(StreamingProvider)
+	if !ok || onDelta == nil {
+		return p.Chat(ctx, req)
+	}
+	return streamer.ChatStream(ctx, req, func(delta string) {
+		*emitted = true
+		onDelta(delta)
+	})
+}
+
+// Embed 通过 Embedder 选出的提供方计算文本向量，返回该提供方及本次调用的用量
+// 调用与 Chat 共用该提供方的熔断器，但不按故障转移链切换提供方：
+// 不同向量模型产生的向量不可比较，换用其他模型后无法与已计算的向量一起使用，失败时由调用方自行降级
+func (r *Registry) Embed(ctx context.Context, texts []string) ([][]float32, EmbeddingProvider, Usage, error) {
+	p, ok := r.Embedder()
+	if !ok {
+		return nil, nil, Usage{}, errors.New("no provider with an embedding model configured")
+	}
+	breaker := r.breakers[p.Name()]
+	if !breaker.Allow() {
+		return nil, p, Usage{}, &Error{Provider: p.Name(), Kind: ErrCircuitOpen}
+	}
+	vectors, usage, err := p.Embed(ctx, texts)
+	if err == nil {
+		breaker.Success()
+		return vectors, p, usage, nil
+	}
+	var llmErr *Error
+	if !errors.As(err, &llmErr) || !llmErr.Retryable() || ctx.Err() != nil {
+		breaker.Release()
+	} else {
+		breaker.Failure()
+	}
+	return nil, p, Usage{}, err
+}
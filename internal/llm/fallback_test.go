@@ -0,0 +1,143 @@
+package llm
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"agent-forge/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newFallbackRegistry 创建不重试的 primary 与 backup 两个提供方，故障转移链为 backup/backup-model
+func newFallbackRegistry(t *testing.T, primary, backup scriptedResponse) (*Registry, func() (int32, int32)) {
+	t.Helper()
+	primarySrv, primaryCount := newScriptedServer(t, primary)
+	backupSrv, backupCount := newScriptedServer(t, backup)
+	p, err := NewOpenAICompatible(config.ProviderConfig{Name: "primary", BaseURL: primarySrv.URL, Model: "m"})
+	require.NoError(t, err)
+	b, err := NewOpenAICompatible(config.ProviderConfig{Name: "backup", BaseURL: backupSrv.URL, Model: "b"})
+	require.NoError(t, err)
+	r, err := NewRegistry("primary", p, b)
+	require.NoError(t, err)
+	require.NoError(t, r.SetFallback([]string{"backup/backup-model"}))
+	return r, func() (int32, int32) { return primaryCount.Load(), backupCount.Load() }
+}
+
+func TestRegistryChatFallsBackOnRetryableFailure(t *testing.T) {
+	r, counts := newFallbackRegistry(t, apiError(http.StatusServiceUnavailable, "", "busy"), chatOK("备用回答"))
+
+	resp, err := r.Chat(context.Background(), hello, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "备用回答", resp.Content)
+	assert.Equal(t, "backup", resp.Provider)
+	primary, backup := counts()
+	assert.Equal(t, int32(1), primary)
+	assert.Equal(t, int32(1), backup)
+}
+
+func TestRegistryChatDoesNotFallBackOnPermanentFailure(t *testing.T) {
+	r, counts := newFallbackRegistry(t, apiError(http.StatusBadRequest, "invalid_request_error", "bad"), chatOK("备用回答"))
+
+	_, err := r.Chat(context.Background(), hello, nil)
+	assert.ErrorIs(t, err, ErrBadRequest)
+	_, backup := counts()
+	assert.Zero(t, backup)
+}
+
+func TestRegistryChatReturnsLastErrorWhenChainExhausted(t *testing.T) {
+	r, _ := newFallbackRegistry(t,
+		apiError(http.StatusServiceUnavailable, "", "busy"),
+		apiError(http.StatusTooManyRequests, "rate_limit_exceeded", "slow down"))
+
+	_, err := r.Chat(context.Background(), hello, nil)
+	assert.ErrorIs(t, err, ErrRateLimited)
+	var llmErr *Error
+	require.ErrorAs(t, err, &llmErr)
+	assert.Equal(t, "backup", llmErr.Provider)
+}
+
+func TestRegistryChatSkipsOpenCircuit(t *testing.T) {
+	r, counts := newFallbackRegistry(t, apiError(http.StatusServiceUnavailable, "", "busy"), chatOK("备用回答"))
+	r.SetCircuitBreaker(2, time.Minute)
+
+	for range 4 {
+		resp, err := r.Chat(context.Background(), hello, nil)
+		require.NoError(t, err)
+		assert.Equal(t, "backup", resp.Provider)
+	}
+	// 连续失败两次后熔断，之后的调用直接使用备用提供方
+	primary, backup := counts()
+	assert.Equal(t, int32(2), primary)
+	assert.Equal(t, int32(4), backup)
+	assert.Equal(t, BreakerOpen, r.BreakerStates()["primary"])
+	assert.Equal(t, BreakerClosed, r.BreakerStates()["backup"])
+}
+
+func TestRegistryEmbedUsesCircuitBreaker(t *testing.T) {
+	srv, count := newScriptedServer(t, apiError(http.StatusServiceUnavailable, "", "busy"))
+	p, err := NewOpenAICompatible(config.ProviderConfig{Name: "primary", BaseURL: srv.URL, Model: "m", EmbeddingModel: "e"})
+	require.NoError(t, err)
+	r, err := NewRegistry("primary", p)
+	require.NoError(t, err)
+	r.SetCircuitBreaker(2, time.Minute)
+
+	for range 2 {
+		_, _, _, err := r.Embed(context.Background(), []string{"你好"})
+		assert.ErrorIs(t, err, ErrUnavailable)
+	}
+	// 与对话共用熔断器，熔断后不再请求该提供方
+	_, provider, _, err := r.Embed(context.Background(), []string{"你好"})
+	assert.ErrorIs(t, err, ErrCircuitOpen)
+	assert.Equal(t, "primary", provider.Name())
+	assert.Equal(t, int32(2), count.Load())
+	assert.Equal(t, BreakerOpen, r.BreakerStates()["primary"])
+}
+
+func TestRegistryRoutes(t *testing.T) {
+	r, _ := newFallbackRegistry(t, chatOK("ok"), chatOK("ok"))
+	require.NoError(t, r.SetFallback([]string{"primary", "backup", "backup/b", "backup/other"}))
+
+	var got []string
+	for _, route := range r.Routes("") {
+		got = append(got, routeKey(route.Provider, route.Model))
+	}
+	// 与首选相同或重复的候选只保留一次
+	assert.Equal(t, []string{"primary/m", "backup/b", "backup/other"}, got)
+
+	assert.Error(t, r.SetFallback([]string{"missing/model"}))
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	now := time.Now()
+	b := NewCircuitBreaker(2, 30*time.Second)
+	b.now = func() time.Time { return now }
+
+	b.Failure()
+	assert.True(t, b.Allow())
+	b.Failure()
+	assert.Equal(t, BreakerOpen, b.State())
+	assert.False(t, b.Allow())
+
+	// 冷却期结束后只放行一次试探调用
+	now = now.Add(31 * time.Second)
+	assert.True(t, b.Allow())
+	assert.False(t, b.Allow())
+	b.Failure()
+	assert.Equal(t, BreakerOpen, b.State())
+
+	now = now.Add(31 * time.Second)
+	assert.True(t, b.Allow())
+	b.Success()
+	assert.Equal(t, BreakerClosed, b.State())
+	assert.True(t, b.Allow())
+
+	disabled := NewCircuitBreaker(0, 0)
+	for range 10 {
+		disabled.Failure()
+	}
+	assert.True(t, disabled.Allow())
+}
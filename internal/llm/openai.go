@@ -0,0 +1,336 @@
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"agent-forge/internal/config"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// validMessageName OpenAI 接口允许的消息名称格式
+var validMessageName = regexp.MustCompile(`^[a-zA-Z0-9_-]{1,64}$`)
+
+// OpenAICompatible 基于 OpenAI 兼容接口的提供方，适用于 DeepSeek、OpenAI 以及 Ollama、vLLM 等本地服务
+type OpenAICompatible struct {
+	name           string
+	model          string
+	embeddingModel string
+	temperature    *float64      // 为空时不发送，使用服务端默认温度
+	timeout        time.Duration // 单次调用（包含重试）的超时时间，0 表示不限制
+	retry          RetryPolicy
+	client         *openai.Client
+}
+
+// NewOpenAICompatible 根据配置创建提供方
+func NewOpenAICompatible(cfg config.ProviderConfig) (*OpenAICompatible, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("LLM提供方名称不能为空")
+	}
+	if cfg.Model == "" {
+		return nil, fmt.Errorf("LLM提供方 %s 未配置模型", cfg.Name)
+	}
+
+	clientConfig := openai.DefaultConfig(cfg.APIKey)
+	if cfg.BaseURL != "" {
+		clientConfig.BaseURL = cfg.BaseURL
+	}
+	clientConfig.HTTPClient = &http.Client{Transport: metaTransport{base: zeroTemperatureTransport{base: http.DefaultTransport}}}
+
+	return &OpenAICompatible{
+		name:           cfg.Name,
+		model:          cfg.Model,
+		embeddingModel: cfg.EmbeddingModel,
+		temperature:    cfg.Temperature,
+		timeout:        time.Duration(cfg.Timeout) * time.Second,
+		retry:          NewRetryPolicy(cfg.Retry),
+		client:         openai.NewClientWithConfig(clientConfig),
+	}, nil
+}
+
+// Name 提供方名称
+func (p *OpenAICompatible) Name() string {
+	return p.name
+}
+
+// Model 默认模型
+func (p *OpenAICompatible) Model() string {
+	return p.model
+}
+
+// Temperature 默认温度，为空表示使用服务端默认温度
+func (p *OpenAICompatible) Temperature() *float64 {
+	return p.temperature
+}
+
+// EmbeddingModel 向量模型
+func (p *OpenAICompatible) EmbeddingModel() string {
+	return p.embeddingModel
+}
+
+// Embed 调用 embeddings 接口计算文本向量，并返回接口报告的用量
+func (p *OpenAICompatible) Embed(ctx context.Context, texts []string) ([][]float32, Usage, error) {
+	if p.embeddingModel == "" {
+		return nil, Usage{}, fmt.Errorf("LLM提供方 %s 未配置向量模型", p.name)
+	}
+	if len(texts) == 0 {
+		return nil, Usage{}, nil
+	}
+
+	ctx, cancel := callContext(ctx, p.timeout)
+	defer cancel()
+
+	var resp openai.EmbeddingResponse
+	err := p.withRetry(ctx, func(ctx context.Context) error {
+		var err error
+		resp, err = p.client.CreateEmbeddings(ctx, openai.EmbeddingRequestStrings{
+			Input: texts,
+			Model: openai.EmbeddingModel(p.embeddingModel),
+		})
+		return err
+	}, nil)
+	if err != nil {
+		return nil, Usage{}, err
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, Usage{}, fmt.Errorf("embeddings 返回 %d 个结果，期望 %d 个", len(resp.Data), len(texts))
+	}
+
+	// 按 index 还原顺序
+	vectors := make([][]float32, len(texts))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(texts) {
+			return nil, Usage{}, fmt.Errorf("embeddings 返回了无效的 index: %d", d.Index)
+		}
+		vectors[d.Index] = d.Embedding
+	}
+	return vectors, usageFrom(&resp.Usage), nil
+}
+
+// Chat 调用 chat completions 接口，失败时按重试策略重试
+func (p *OpenAICompatible) Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error) {
+	ctx, cancel := callContext(ctx, p.timeout)
+	defer cancel()
+	ctx = p.temperatureContext(ctx, req)
+	chatReq := p.buildRequest(req)
+
+	var result *ChatResponse
+	err := p.withRetry(ctx, func(ctx context.Context) error {
+		resp, err := p.client.CreateChatCompletion(ctx, chatReq)
+		if err != nil {
+			return err
+		}
+		if len(resp.Choices) == 0 {
+			return ErrEmptyResponse
+		}
+		choice := resp.Choices[0]
+		if choice.FinishReason == openai.FinishReasonContentFilter && choice.Message.Content == "" {
+			return ErrContentFiltered
+		}
+		result = &ChatResponse{
+			Content:        choice.Message.Content,
+			Model:          resp.Model,
+			RequestedModel: chatReq.Model,
+			Provider:       p.name,
+			Usage:          usageFrom(&resp.Usage),
+		}
+		return nil
+	}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// ChatStream 以流式方式调用 chat completions 接口，逐段回调增量内容并返回完整结果
+// 只有在尚未收到任何增量内容时才会重试，避免重复输出
+func (p *OpenAICompatible) ChatStream(ctx context.Context, req ChatRequest, onDelta func(delta string)) (*ChatResponse, error) {
+	ctx, cancel := callContext(ctx, p.timeout)
+	defer cancel()
+	ctx = p.temperatureContext(ctx, req)
+	chatReq := p.buildRequest(req)
+	chatReq.Stream = true
+	// 要求在最后一段中返回用量，不支持该选项的服务会忽略它
+	chatReq.StreamOptions = &openai.StreamOptions{IncludeUsage: true}
+
+	var result *ChatResponse
+	emitted := false
+	err := p.withRetry(ctx, func(ctx context.Context) error {
+		stream, err := p.client.CreateChatCompletionStream(ctx, chatReq)
+		if err != nil {
+			return err
+		}
+		defer stream.Close()
+
+		var content strings.Builder
+		model := chatReq.Model
+		filtered := false
+		var usage Usage
+		for {
+			chunk, err := stream.Recv()
+			if errors.Is(err, io.EOF) {
+				break
+			}
+			if err != nil {
+				return err
+			}
+			if chunk.Model != "" {
+				model = chunk.Model
+			}
+			if chunk.Usage != nil {
+				usage = usageFrom(chunk.Usage)
+			}
+			if len(chunk.Choices) == 0 {
+				continue
+			}
+			if chunk.Choices[0].FinishReason == openai.FinishReasonContentFilter {
+				filtered = true
+			}
+			delta := chunk.Choices[0].Delta.Content
+			if delta == "" {
+				continue
+			}
+			content.WriteString(delta)
+			emitted = true
+			if onDelta != nil {
+				onDelta(delta)
+			}
+		}
+
+		if content.Len() == 0 {
+			if filtered {
+				return ErrContentFiltered
+			}
+			return ErrEmptyResponse
+		}
+		result = &ChatResponse{
+			Content:        content.String(),
+			Model:          model,
+			RequestedModel: chatReq.Model,
+			Provider:       p.name,
+			Usage:          usage,
+		}
+		return nil
+	}, func() bool { return !emitted })
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// zeroTemperatureKey 请求上下文中标记显式 0 温度的键
+type zeroTemperatureKey struct{}
+
+// temperatureContext 本次调用的温度显式为 0 时，在上下文中标记，由 zeroTemperatureTransport 写入请求体
+func (p *OpenAICompatible) temperatureContext(ctx context.Context, req ChatRequest) context.Context {
+	if t := p.resolveTemperature(req); t != nil && *t == 0 {
+		return context.WithValue(ctx, zeroTemperatureKey{}, true)
+	}
+	return ctx
+}
+
+// zeroTemperatureTransport 为标记了显式 0 温度的请求在请求体中写入 "temperature": 0
+// go-openai 的 Temperature 字段带有 omitempty（sashabaranov/go-openai#9），0 不会被发送，服务端会改用默认温度（通常约为 1）
+type zeroTemperatureTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip 改写请求体后转发，未标记的请求原样转发
+func (t zeroTemperatureTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if zero, _ := req.Context().Value(zeroTemperatureKey{}).(bool); !zero || req.Body == nil {
+		return t.base.RoundTrip(req)
+	}
+	data, err := io.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	var body map[string]json.RawMessage
+	if err := json.Unmarshal(data, &body); err != nil {
+		return nil, fmt.Errorf("写入请求温度失败: %v", err)
+	}
+	body["temperature"] = json.RawMessage("0")
+	if data, err = json.Marshal(body); err != nil {
+		return nil, fmt.Errorf("写入请求温度失败: %v", err)
+	}
+
+	rewritten := req.Clone(req.Context())
+	rewritten.Body = io.NopCloser(bytes.NewReader(data))
+	rewritten.ContentLength = int64(len(data))
+	rewritten.GetBody = func() (io.ReadCloser, error) {
+		return io.NopCloser(bytes.NewReader(data)), nil
+	}
+	return t.base.RoundTrip(rewritten)
+}
+
+// usageFrom 转换接口返回的用量，部分服务不返回 total_tokens，此时按输入与输出之和计算
+func usageFrom(u *openai.Usage) Usage {
+	usage := Usage{
+		PromptTokens:     u.PromptTokens,
+		CompletionTokens: u.CompletionTokens,
+		TotalTokens:      u.TotalTokens,
+	}
+	if usage.TotalTokens == 0 {
+		usage.TotalTokens = usage.PromptTokens + usage.CompletionTokens
+	}
+	return usage
+}
+
+// buildRequest 将通用请求转换为 OpenAI 请求，未指定的参数使用提供方默认值
+func (p *OpenAICompatible) buildRequest(req ChatRequest) openai.ChatCompletionRequest {
+	model := req.Model
+	if model == "" {
+		model = p.model
+	}
+	temperature := p.resolveTemperature(req)
+
+	messages := make([]openai.ChatCompletionMessage, 0, len(req.Messages))
+	for _, m := range req.Messages {
+		msg := openai.ChatCompletionMessage{
+			Role:    m.Role,
+			Content: m.Content,
+		}
+		// 接口只接受字母、数字、下划线和连字符组成的名称，其余名称只保留在内容中
+		if validMessageName.MatchString(m.Name) {
+			msg.Name = m.Name
+		}
+		messages = append(messages, msg)
+	}
+
+	chatReq := openai.ChatCompletionRequest{
+		Model:     model,
+		Messages:  messages,
+		MaxTokens: req.MaxTokens,
+		Seed:      req.Seed,
+	}
+	if temperature != nil {
+		// 为 0 时字段不会被序列化，由 zeroTemperatureTransport 补上
+		chatReq.Temperature = float32(*temperature)
+	}
+	if req.TopP != nil {
+		chatReq.TopP = float32(*req.TopP)
+	}
+	if req.JSONMode {
+		chatReq.ResponseFormat = &openai.ChatCompletionResponseFormat{
+			Type: openai.ChatCompletionResponseFormatTypeJSONObject,
+		}
+	}
+	return chatReq
+}
+
+// resolveTemperature 返回本次调用的温度，请求未指定时使用提供方默认温度，为空表示不发送
+func (p *OpenAICompatible) resolveTemperature(req ChatRequest) *float64 {
+	if req.Temperature != nil {
+		return req.Temperature
+	}
+	return p.temperature
+}
@@ -0,0 +1,197 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"agent-forge/internal/config"
+)
+
+// 消息角色
+const (
+	RoleSystem    = "system"
+	RoleUser      = "user"
+	RoleAssistant = "assistant"
+)
+
+// Message 对话消息
+type Message struct {
+	Role    string
+	Content string
+	Name    string // 可选的发言者名称，用于区分多智能体对话中的不同参与者
+}
+
+// Sampling 模型与采样参数，零值表示使用提供方默认值
+type Sampling struct {
+	Model       string   // 为空时使用提供方的默认模型
+	Temperature *float64 // 为空时使用提供方的默认温度
+	TopP        *float64
+	MaxTokens   int
+	Seed        *int
+}
+
+// ChatRequest 对话补全请求
+type ChatRequest struct {
+	Sampling
+	Messages []Message
+	JSONMode bool // 要求模型输出 JSON 对象
+}
+
+// ChatResponse 对话补全结果
+type ChatResponse struct {
+	Content        string
+	Model          string // 接口返回的模型名称，可能是带日期的快照名称
+	RequestedModel string // 实际请求的模型名称（未指定时为提供方默认模型），按配置计价时使用
+	Provider       string
+	Cached         bool  // 结果来自响应缓存，没有调用提供方
+	Usage          Usage // 本次调用消耗的 token 数，缓存命中时为零
+}
+
+// Usage 一次调用消耗的 token 数，提供方未返回用量时为零
+type Usage struct {
+	PromptTokens     int
+	CompletionTokens int
+	TotalTokens      int
+}
+
+// LLMProvider 大模型提供方接口
+type LLMProvider interface {
+	// Name 提供方名称
+	Name() string
+	// Model 提供方默认模型
+	Model() string
+	// Chat 发起一次对话补全
+	Chat(ctx context.Context, req ChatRequest) (*ChatResponse, error)
+}
+
+// StreamingProvider 支持流式输出的提供方
+type StreamingProvider interface {
+	LLMProvider
+	// ChatStream 以流式方式发起对话补全，每收到一段增量内容调用一次 onDelta，结束后返回完整结果
+	ChatStream(ctx context.Context, req ChatRequest, onDelta func(delta string)) (*ChatResponse, error)
+}
+
+// EmbeddingProvider 支持 embeddings 接口的提供方
+type EmbeddingProvider interface {
+	LLMProvider
+	// EmbeddingModel 向量模型，为空表示不支持
+	EmbeddingModel() string
+	// Embed 计算文本的向量，结果与输入一一对应，同时返回本次调用消耗的 token 数
+	Embed(ctx context.Context, texts []string) ([][]float32, Usage, error)
+}
+
+// Registry 按名称管理提供方，并记录默认提供方、故障转移链和各提供方的熔断器
+type Registry struct {
+	providers   map[string]LLMProvider
+	defaultName string
+	fallback    []string
+	breakers    map[string]*CircuitBreaker
+}
+
+// NewRegistry 创建提供方注册表，defaultName 为空时使用第一个提供方
+func NewRegistry(defaultName string, providers ...LLMProvider) (*Registry, error) {
+	if len(providers) == 0 {
+		return nil, errors.New("至少需要配置一个LLM提供方")
+	}
+
+	r := &Registry{
+		providers: make(map[string]LLMProvider, len(providers)),
+		breakers:  make(map[string]*CircuitBreaker, len(providers)),
+	}
+	for _, p := range providers {
+		if _, exists := r.providers[p.Name()]; exists {
+			return nil, fmt.Errorf("LLM提供方名称重复: %s", p.Name())
+		}
+		r.providers[p.Name()] = p
+		r.breakers[p.Name()] = NewCircuitBreaker(0, 0)
+	}
+
+	if defaultName == "" {
+		defaultName = providers[0].Name()
+	}
+	if _, ok := r.providers[defaultName]; !ok {
+		return nil, fmt.Errorf("默认LLM提供方不存在: %s", defaultName)
+	}
+	r.defaultName = defaultName
+	return r, nil
+}
+
+// NewRegistryFromConfig 根据配置创建提供方注册表
+func NewRegistryFromConfig(cfg *config.Config) (*Registry, error) {
+	providerConfigs := cfg.LLMProviders()
+	providers := make([]LLMProvider, 0, len(providerConfigs))
+	for _, pc := range providerConfigs {
+		p, err := NewOpenAICompatible(pc)
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, p)
+	}
+	r, err := NewRegistry(cfg.DefaultProvider, providers...)
+	if err != nil {
+		return nil, err
+	}
+	if err := r.SetFallback(cfg.Fallback); err != nil {
+		return nil, err
+	}
+	r.SetCircuitBreaker(cfg.CircuitBreaker.FailureThreshold, time.Duration(cfg.CircuitBreaker.Cooldown)*time.Second)
+	return r, nil
+}
+
+// Default 返回默认提供方
+func (r *Registry) Default() LLMProvider {
+	return r.providers[r.defaultName]
+}
+
+// Get 按名称获取提供方
+func (r *Registry) Get(name string) (LLMProvider, bool) {
+	p, ok := r.providers[name]
+	return p, ok
+}
+
+// Resolve 根据模型名称选择提供方，返回提供方及实际请求的模型（为空表示使用提供方默认模型）
+// 匹配顺序：提供方名称、"提供方/模型" 形式、提供方默认模型，均不匹配时由默认提供方处理该模型
+func (r *Registry) Resolve(model string) (LLMProvider, string) {
+	if model == "" {
+		return r.Default(), ""
+	}
+	if p, ok := r.providers[model]; ok {
+		return p, ""
+	}
+	if name, rest, found := strings.Cut(model, "/"); found {
+		if p, ok := r.providers[name]; ok && rest != "" {
+			return p, rest
+		}
+	}
+	for _, name := range r.Names() {
+		if p := r.providers[name]; p.Model() == model {
+			return p, model
+		}
+	}
+	return r.Default(), model
+}
+
+// Embedder 返回可用于计算向量的提供方，优先使用默认提供方，均未配置向量模型时返回 false
+func (r *Registry) Embedder() (EmbeddingProvider, bool) {
+	names := append([]string{r.defaultName}, r.Names()...)
+	for _, name := range names {
+		if p, ok := r.providers[name].(EmbeddingProvider); ok && p.EmbeddingModel() != "" {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+// Names 返回所有提供方名称（按字母排序）
+func (r *Registry) Names() []string {
+	names := make([]string, 0, len(r.providers))
+	for name := range r.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,306 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"agent-forge/internal/config"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newChatServer 启动模拟的 chat completions 接口，并记录收到的请求
+func newChatServer(t *testing.T, reply string, received *openai.ChatCompletionRequest) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if received != nil {
+			require.NoError(t, json.NewDecoder(r.Body).Decode(received))
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Model: "served-model",
+			Choices: []openai.ChatCompletionChoice{{
+				Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: reply},
+			}},
+		})
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestOpenAICompatibleChat(t *testing.T) {
+	var received openai.ChatCompletionRequest
+	srv := newChatServer(t, "你好", &received)
+
+	providerTemperature := 0.3
+	p, err := NewOpenAICompatible(config.ProviderConfig{
+		Name:        "local",
+		BaseURL:     srv.URL,
+		Model:       "qwen2.5",
+		Temperature: &providerTemperature,
+	})
+	require.NoError(t, err)
+
+	resp, err := p.Chat(context.Background(), ChatRequest{
+		Messages: []Message{
+			{Role: RoleSystem, Content: "sys"},
+			{Role: RoleUser, Name: "engineer", Content: "hi"},
+			{Role: RoleUser, Name: "工程师", Content: "hi"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "你好", resp.Content)
+	assert.Equal(t, "local", resp.Provider)
+	assert.Equal(t, "qwen2.5", received.Model)
+	assert.InDelta(t, 0.3, received.Temperature, 1e-6)
+	require.Len(t, received.Messages, 3)
+	assert.Nil(t, received.ResponseFormat)
+	assert.Equal(t, RoleSystem, received.Messages[0].Role)
+	// 不符合接口要求的名称不会发送
+	assert.Equal(t, "engineer", received.Messages[1].Name)
+	assert.Empty(t, received.Messages[2].Name)
+
+	// 请求中的模型和温度优先于提供方默认值
+	temperature, topP, seed := 0.9, 0.5, 42
+	_, err = p.Chat(context.Background(), ChatRequest{
+		Sampling: Sampling{
+			Model:       "llama3",
+			Temperature: &temperature,
+			TopP:        &topP,
+			MaxTokens:   256,
+			Seed:        &seed,
+		},
+		Messages: []Message{{Role: RoleUser, Content: "hi"}},
+		JSONMode: true,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "llama3", received.Model)
+	require.NotNil(t, received.ResponseFormat)
+	assert.Equal(t, openai.ChatCompletionResponseFormatTypeJSONObject, received.ResponseFormat.Type)
+	assert.InDelta(t, 0.9, received.Temperature, 1e-6)
+	assert.InDelta(t, 0.5, received.TopP, 1e-6)
+	assert.Equal(t, 256, received.MaxTokens)
+	require.NotNil(t, received.Seed)
+	assert.Equal(t, 42, *received.Seed)
+}
+
+func TestZeroTemperatureIsSent(t *testing.T) {
+	var body map[string]interface{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body = nil
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`))
+	}))
+	defer srv.Close()
+
+	zero, warm := 0.0, 0.8
+	tests := []struct {
+		name     string
+		provider *float64
+		request  *float64
+		sent     bool
+		want     float64
+	}{
+		{"provider zero", &zero, nil, true, 0},
+		{"agent zero overrides provider", &warm, &zero, true, 0},
+		{"provider default", nil, nil, false, 0},
+		{"agent value", nil, &warm, true, 0.8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := NewOpenAICompatible(config.ProviderConfig{Name: "local", BaseURL: srv.URL, Model: "m", Temperature: tt.provider})
+			require.NoError(t, err)
+			_, err = p.Chat(context.Background(), ChatRequest{
+				Sampling: Sampling{Temperature: tt.request},
+				Messages: []Message{{Role: RoleUser, Content: "hi"}},
+			})
+			require.NoError(t, err)
+
+			got, ok := body["temperature"].(float64)
+			require.Equal(t, tt.sent, ok, "显式的温度必须出现在请求体中，未配置时不发送")
+			if !tt.sent {
+				return
+			}
+			// 0 按原值发送，不能被 omitempty 省略，也不能以其他数值代替
+			assert.Equal(t, float32(tt.want), float32(got))
+		})
+	}
+}
+
+func TestOpenAICompatibleChatStream(t *testing.T) {
+	var received openai.ChatCompletionRequest
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, delta := range []string{"你", "好", ""} {
+			chunk, _ := json.Marshal(openai.ChatCompletionStreamResponse{
+				Model: "served-model",
+				Choices: []openai.ChatCompletionStreamChoice{{
+					Delta: openai.ChatCompletionStreamChoiceDelta{Content: delta},
+				}},
+			})
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		// 最后一段只包含用量
+		chunk, _ := json.Marshal(openai.ChatCompletionStreamResponse{
+			Usage: &openai.Usage{PromptTokens: 8, CompletionTokens: 2, TotalTokens: 10},
+		})
+		fmt.Fprintf(w, "data: %s\n\n", chunk)
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer srv.Close()
+
+	p, err := NewOpenAICompatible(config.ProviderConfig{Name: "local", BaseURL: srv.URL, Model: "qwen2.5"})
+	require.NoError(t, err)
+
+	var deltas []string
+	resp, err := p.ChatStream(context.Background(), ChatRequest{
+		Messages: []Message{{Role: RoleUser, Content: "hi"}},
+	}, func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	require.NoError(t, err)
+	assert.True(t, received.Stream)
+	require.NotNil(t, received.StreamOptions)
+	assert.True(t, received.StreamOptions.IncludeUsage)
+	assert.Equal(t, []string{"你", "好"}, deltas)
+	assert.Equal(t, "你好", resp.Content)
+	assert.Equal(t, "served-model", resp.Model)
+	assert.Equal(t, "local", resp.Provider)
+	assert.Equal(t, Usage{PromptTokens: 8, CompletionTokens: 2, TotalTokens: 10}, resp.Usage)
+}
+
+func TestOpenAICompatibleChatUsage(t *testing.T) {
+	// 部分服务不返回 total_tokens
+	srv, _ := newScriptedServer(t, scriptedResponse{
+		status: http.StatusOK,
+		body:   `{"model":"m","choices":[{"message":{"role":"assistant","content":"ok"}}],"usage":{"prompt_tokens":30,"completion_tokens":12}}`,
+	})
+	p, err := NewOpenAICompatible(config.ProviderConfig{Name: "local", BaseURL: srv.URL, Model: "m"})
+	require.NoError(t, err)
+
+	resp, err := p.Chat(context.Background(), hello)
+	require.NoError(t, err)
+	assert.Equal(t, Usage{PromptTokens: 30, CompletionTokens: 12, TotalTokens: 42}, resp.Usage)
+}
+
+func TestOpenAICompatibleEmptyChoices(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"choices":[]}`))
+	}))
+	defer srv.Close()
+
+	p, err := NewOpenAICompatible(config.ProviderConfig{Name: "empty", BaseURL: srv.URL, Model: "m"})
+	require.NoError(t, err)
+
+	_, err = p.Chat(context.Background(), ChatRequest{Messages: []Message{{Role: RoleUser, Content: "hi"}}})
+	assert.ErrorIs(t, err, ErrEmptyResponse)
+}
+
+func TestRegistryFromConfig(t *testing.T) {
+	// 未配置 providers 时回退到 deepseek 配置
+	r, err := NewRegistryFromConfig(&config.Config{
+		DeepSeek: config.DeepSeekConfig{APIKey: "k", BaseURL: "https://api.deepseek.com", Temperature: 0.7},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "deepseek", r.Default().Name())
+	assert.Equal(t, "deepseek-chat", r.Default().Model())
+
+	r, err = NewRegistryFromConfig(&config.Config{
+		DefaultProvider: "ollama",
+		Providers: []config.ProviderConfig{
+			{Name: "openai", Model: "gpt-4o-mini", APIKey: "k"},
+			{Name: "ollama", Model: "qwen2.5", BaseURL: "http://localhost:11434/v1"},
+		},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "ollama", r.Default().Name())
+	assert.Equal(t, []string{"ollama", "openai"}, r.Names())
+
+	_, err = NewRegistryFromConfig(&config.Config{
+		DefaultProvider: "missing",
+		Providers:       []config.ProviderConfig{{Name: "openai", Model: "gpt-4o-mini"}},
+	})
+	assert.Error(t, err)
+
+	_, err = NewRegistryFromConfig(&config.Config{
+		Providers: []config.ProviderConfig{{Name: "a", Model: "m"}, {Name: "a", Model: "m"}},
+	})
+	assert.Error(t, err)
+}
+
+func TestRegistryResolve(t *testing.T) {
+	r, err := NewRegistryFromConfig(&config.Config{
+		Providers: []config.ProviderConfig{
+			{Name: "deepseek", Model: "deepseek-chat"},
+			{Name: "ollama", Model: "qwen2.5"},
+		},
+	})
+	require.NoError(t, err)
+
+	tests := []struct {
+		model        string
+		wantProvider string
+		wantModel    string
+	}{
+		{"", "deepseek", ""},
+		{"ollama", "ollama", ""},
+		{"ollama/llama3", "ollama", "llama3"},
+		{"qwen2.5", "ollama", "qwen2.5"},
+		{"deepseek-reasoner", "deepseek", "deepseek-reasoner"},
+		{"Qwen/Qwen2.5-7B", "deepseek", "Qwen/Qwen2.5-7B"},
+	}
+	for _, tt := range tests {
+		p, model := r.Resolve(tt.model)
+		assert.Equal(t, tt.wantProvider, p.Name(), tt.model)
+		assert.Equal(t, tt.wantModel, model, tt.model)
+	}
+}
+
+func TestOpenAICompatibleEmbed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		// 乱序返回，验证按 index 还原顺序
+		_ = json.NewEncoder(w).Encode(openai.EmbeddingResponse{
+			Object: "list",
+			Data: []openai.Embedding{
+				{Object: "embedding", Index: 1, Embedding: []float32{0, 1}},
+				{Object: "embedding", Index: 0, Embedding: []float32{1, 0}},
+			},
+			Usage: openai.Usage{PromptTokens: 8, TotalTokens: 8},
+		})
+	}))
+	defer srv.Close()
+
+	withEmbedding, err := NewOpenAICompatible(config.ProviderConfig{Name: "openai", BaseURL: srv.URL, Model: "gpt-4o", EmbeddingModel: "text-embedding-3-small"})
+	require.NoError(t, err)
+	vectors, usage, err := withEmbedding.Embed(context.Background(), []string{"a", "b"})
+	require.NoError(t, err)
+	assert.Equal(t, [][]float32{{1, 0}, {0, 1}}, vectors)
+	assert.Equal(t, Usage{PromptTokens: 8, TotalTokens: 8}, usage)
+
+	chatOnly, err := NewOpenAICompatible(config.ProviderConfig{Name: "deepseek", BaseURL: srv.URL, Model: "deepseek-chat"})
+	require.NoError(t, err)
+	_, _, err = chatOnly.Embed(context.Background(), []string{"a"})
+	assert.Error(t, err)
+
+	// 默认提供方不支持 embeddings 时使用其他配置了向量模型的提供方
+	registry, err := NewRegistry("deepseek", chatOnly, withEmbedding)
+	require.NoError(t, err)
+	embedder, ok := registry.Embedder()
+	require.True(t, ok)
+	assert.Equal(t, "openai", embedder.Name())
+
+	registry, err = NewRegistry("deepseek", chatOnly)
+	require.NoError(t, err)
+	_, ok = registry.Embedder()
+	assert.False(t, ok)
+}
@@ -0,0 +1,133 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"agent-forge/internal/config"
+)
+
+// RetryPolicy 调用失败时的重试策略，零值表示不重试
+type RetryPolicy struct {
+	MaxAttempts    int           // 包含首次请求在内的最大尝试次数
+	InitialBackoff time.Duration // 首次重试前的基准等待时间
+	MaxBackoff     time.Duration // 单次退避等待的上限
+	Budget         time.Duration // 一次调用中所有等待时间之和的上限，0 表示不限制
+}
+
+// NewRetryPolicy 根据配置创建重试策略
+func NewRetryPolicy(cfg config.RetryConfig) RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts:    cfg.MaxAttempts,
+		InitialBackoff: time.Duration(cfg.InitialBackoff) * time.Millisecond,
+		MaxBackoff:     time.Duration(cfg.MaxBackoff) * time.Millisecond,
+		Budget:         time.Duration(cfg.Budget) * time.Millisecond,
+	}
+}
+
+// backoff 返回第 retry 次重试（从1开始）前的等待时间
+// 基准时间每次翻倍并受 MaxBackoff 限制，实际等待时间在基准时间的一半到全部之间随机，避免并发请求同时重试
+func (p RetryPolicy) backoff(retry int) time.Duration {
+	d := p.InitialBackoff
+	for i := 1; i < retry && (p.MaxBackoff <= 0 || d < p.MaxBackoff); i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	return d/2 + rand.N(d/2+1)
+}
+
+// responseMetaKey 请求上下文中记录响应信息的键
+type responseMetaKey struct{}
+
+// responseMeta 由 metaTransport 记录的响应信息，接口客户端不会暴露响应头
+type responseMeta struct {
+	retryAfter time.Duration
+}
+
+// metaTransport 记录失败响应中的 Retry-After
+type metaTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip 转发请求，并将 Retry-After 写入请求上下文中的 responseMeta
+func (t metaTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		return resp, err
+	}
+	if meta, ok := req.Context().Value(responseMetaKey{}).(*responseMeta); ok && resp.StatusCode >= 400 {
+		meta.retryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	return resp, nil
+}
+
+// parseRetryAfter 解析 Retry-After 响应头，支持秒数和 HTTP 日期两种格式，无效时返回 0
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(v); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// withRetry 调用 fn，失败时按重试策略重试，返回的错误已按类型归类
+// canRetry 不为 nil 时，只有它返回 true 才会重试（例如流式输出已经开始时不能重试）
+func (p *OpenAICompatible) withRetry(ctx context.Context, fn func(ctx context.Context) error, canRetry func() bool) error {
+	var waited time.Duration
+	for attempt := 1; ; attempt++ {
+		meta := &responseMeta{}
+		err := classifyError(p.name, fn(context.WithValue(ctx, responseMetaKey{}, meta)))
+		if err == nil {
+			return nil
+		}
+		var llmErr *Error
+		if !errors.As(err, &llmErr) {
+			return err
+		}
+		llmErr.Attempts = attempt
+		if !llmErr.Retryable() || attempt >= p.retry.MaxAttempts || ctx.Err() != nil {
+			return err
+		}
+		if canRetry != nil && !canRetry() {
+			return err
+		}
+
+		// 服务端给出 Retry-After 时按其等待，否则使用指数退避
+		wait := p.retry.backoff(attempt)
+		if meta.retryAfter > 0 {
+			wait = meta.retryAfter
+		}
+		if p.retry.Budget > 0 && waited+wait > p.retry.Budget {
+			return err
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+			return err
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		waited += wait
+	}
+}
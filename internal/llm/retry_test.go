@@ -0,0 +1,268 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"agent-forge/internal/config"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// scriptedResponse 模拟服务器按顺序返回的响应
+type scriptedResponse struct {
+	status     int
+	retryAfter string
+	body       string
+	delay      time.Duration
+}
+
+// newScriptedServer 按顺序返回 responses 中的响应，用尽后重复最后一个，返回收到的请求数
+func newScriptedServer(t *testing.T, responses ...scriptedResponse) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var count atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(count.Add(1))
+		resp := responses[min(n, len(responses))-1]
+		if resp.delay > 0 {
+			select {
+			case <-time.After(resp.delay):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if resp.retryAfter != "" {
+			w.Header().Set("Retry-After", resp.retryAfter)
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(resp.status)
+		_, _ = w.Write([]byte(resp.body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &count
+}
+
+// chatOK 成功的 chat completions 响应
+func chatOK(content string) scriptedResponse {
+	body, _ := json.Marshal(openai.ChatCompletionResponse{
+		Model: "served-model",
+		Choices: []openai.ChatCompletionChoice{{
+			Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: content},
+			FinishReason: openai.FinishReasonStop,
+		}},
+	})
+	return scriptedResponse{status: http.StatusOK, body: string(body)}
+}
+
+// apiError 接口错误响应
+func apiError(status int, code, message string) scriptedResponse {
+	return scriptedResponse{
+		status: status,
+		body:   fmt.Sprintf(`{"error":{"message":%q,"type":"error","code":%q}}`, message, code),
+	}
+}
+
+// newRetryProvider 创建指向 srv 的提供方，重试等待时间很短以便测试
+func newRetryProvider(t *testing.T, srv *httptest.Server, retry config.RetryConfig) *OpenAICompatible {
+	t.Helper()
+	p, err := NewOpenAICompatible(config.ProviderConfig{Name: "flaky", BaseURL: srv.URL, Model: "m", Retry: retry})
+	require.NoError(t, err)
+	return p
+}
+
+var fastRetry = config.RetryConfig{MaxAttempts: 3, InitialBackoff: 1, MaxBackoff: 5}
+
+var hello = ChatRequest{Messages: []Message{{Role: RoleUser, Content: "hi"}}}
+
+func TestChatRetriesTransientErrors(t *testing.T) {
+	srv, count := newScriptedServer(t,
+		apiError(http.StatusServiceUnavailable, "overloaded", "server busy"),
+		scriptedResponse{status: http.StatusBadGateway, body: "<html>bad gateway</html>"},
+		chatOK("你好"),
+	)
+	p := newRetryProvider(t, srv, fastRetry)
+
+	resp, err := p.Chat(context.Background(), hello)
+	require.NoError(t, err)
+	assert.Equal(t, "你好", resp.Content)
+	assert.Equal(t, int32(3), count.Load())
+}
+
+func TestChatGivesUpAfterMaxAttempts(t *testing.T) {
+	srv, count := newScriptedServer(t, apiError(http.StatusTooManyRequests, "rate_limit_exceeded", "slow down"))
+	p := newRetryProvider(t, srv, fastRetry)
+
+	_, err := p.Chat(context.Background(), hello)
+	require.Error(t, err)
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.Equal(t, int32(3), count.Load())
+
+	var llmErr *Error
+	require.ErrorAs(t, err, &llmErr)
+	assert.Equal(t, http.StatusTooManyRequests, llmErr.StatusCode)
+	assert.Equal(t, 3, llmErr.Attempts)
+	assert.Contains(t, err.Error(), "slow down")
+}
+
+func TestChatDoesNotRetryPermanentErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		response scriptedResponse
+		kind     error
+	}{
+		{"auth", apiError(http.StatusUnauthorized, "invalid_api_key", "bad key"), ErrAuth},
+		{"forbidden", apiError(http.StatusForbidden, "", "no access"), ErrAuth},
+		{"bad request", apiError(http.StatusBadRequest, "invalid_request_error", "bad model"), ErrBadRequest},
+		{"content filter code", apiError(http.StatusBadRequest, "content_filter", "blocked"), ErrContentFiltered},
+		{"deepseek content risk", apiError(http.StatusBadRequest, "invalid_request_error", "Content Exists Risk"), ErrContentFiltered},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, count := newScriptedServer(t, tt.response)
+			p := newRetryProvider(t, srv, fastRetry)
+
+			_, err := p.Chat(context.Background(), hello)
+			assert.ErrorIs(t, err, tt.kind)
+			assert.Equal(t, int32(1), count.Load())
+		})
+	}
+}
+
+func TestChatContentFilteredFinishReason(t *testing.T) {
+	body, _ := json.Marshal(openai.ChatCompletionResponse{
+		Choices: []openai.ChatCompletionChoice{{FinishReason: openai.FinishReasonContentFilter}},
+	})
+	srv, count := newScriptedServer(t, scriptedResponse{status: http.StatusOK, body: string(body)})
+	p := newRetryProvider(t, srv, fastRetry)
+
+	_, err := p.Chat(context.Background(), hello)
+	assert.ErrorIs(t, err, ErrContentFiltered)
+	assert.Equal(t, int32(1), count.Load())
+}
+
+func TestChatRetriesEmptyResponse(t *testing.T) {
+	srv, count := newScriptedServer(t, scriptedResponse{status: http.StatusOK, body: `{"choices":[]}`}, chatOK("ok"))
+	p := newRetryProvider(t, srv, fastRetry)
+
+	resp, err := p.Chat(context.Background(), hello)
+	require.NoError(t, err)
+	assert.Equal(t, "ok", resp.Content)
+	assert.Equal(t, int32(2), count.Load())
+}
+
+func TestChatHonorsRetryAfter(t *testing.T) {
+	limited := apiError(http.StatusTooManyRequests, "rate_limit_exceeded", "slow down")
+	limited.retryAfter = "1"
+	srv, count := newScriptedServer(t, limited, chatOK("ok"))
+	p := newRetryProvider(t, srv, fastRetry)
+
+	start := time.Now()
+	_, err := p.Chat(context.Background(), hello)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, time.Since(start), time.Second)
+	assert.Equal(t, int32(2), count.Load())
+}
+
+func TestChatRetryBudget(t *testing.T) {
+	limited := apiError(http.StatusTooManyRequests, "rate_limit_exceeded", "slow down")
+	limited.retryAfter = "60"
+	srv, count := newScriptedServer(t, limited, chatOK("ok"))
+	p := newRetryProvider(t, srv, config.RetryConfig{MaxAttempts: 3, InitialBackoff: 1, MaxBackoff: 5, Budget: 1000})
+
+	// Retry-After 超出预算时立即放弃，而不是等待一分钟
+	start := time.Now()
+	_, err := p.Chat(context.Background(), hello)
+	assert.ErrorIs(t, err, ErrRateLimited)
+	assert.Less(t, time.Since(start), 5*time.Second)
+	assert.Equal(t, int32(1), count.Load())
+}
+
+func TestChatTimeout(t *testing.T) {
+	slow := chatOK("ok")
+	slow.delay = time.Second
+	srv, _ := newScriptedServer(t, slow)
+	p := newRetryProvider(t, srv, fastRetry)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := p.Chat(ctx, hello)
+	assert.ErrorIs(t, err, ErrTimeout)
+}
+
+func TestCallTimeoutOverride(t *testing.T) {
+	slow := chatOK("ok")
+	slow.delay = time.Second
+	srv, _ := newScriptedServer(t, slow)
+	p, err := NewOpenAICompatible(config.ProviderConfig{Name: "slow", BaseURL: srv.URL, Model: "m", Timeout: 30})
+	require.NoError(t, err)
+
+	// 上下文中的超时时间覆盖提供方配置的 30 秒
+	start := time.Now()
+	_, err = p.Chat(WithCallTimeout(context.Background(), 50*time.Millisecond), hello)
+	assert.ErrorIs(t, err, ErrTimeout)
+	assert.Less(t, time.Since(start), 500*time.Millisecond)
+}
+
+func TestChatWithoutRetryPolicy(t *testing.T) {
+	srv, count := newScriptedServer(t, apiError(http.StatusServiceUnavailable, "", "busy"), chatOK("ok"))
+	p := newRetryProvider(t, srv, config.RetryConfig{})
+
+	_, err := p.Chat(context.Background(), hello)
+	assert.ErrorIs(t, err, ErrUnavailable)
+	assert.Equal(t, int32(1), count.Load())
+}
+
+func TestChatStreamRetriesBeforeFirstDelta(t *testing.T) {
+	var count atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if count.Add(1) == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		chunk, _ := json.Marshal(openai.ChatCompletionStreamResponse{
+			Choices: []openai.ChatCompletionStreamChoice{{Delta: openai.ChatCompletionStreamChoiceDelta{Content: "好"}}},
+		})
+		fmt.Fprintf(w, "data: %s\n\ndata: [DONE]\n\n", chunk)
+	}))
+	defer srv.Close()
+	p := newRetryProvider(t, srv, fastRetry)
+
+	var deltas []string
+	resp, err := p.ChatStream(context.Background(), hello, func(delta string) {
+		deltas = append(deltas, delta)
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "好", resp.Content)
+	assert.Equal(t, []string{"好"}, deltas)
+	assert.Equal(t, int32(2), count.Load())
+}
+
+func TestRetryBackoff(t *testing.T) {
+	p := RetryPolicy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+	for retry, want := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 4: 800 * time.Millisecond, 10: time.Second} {
+		for range 20 {
+			d := p.backoff(retry)
+			assert.GreaterOrEqual(t, d, want/2)
+			assert.LessOrEqual(t, d, want)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, 3*time.Second, parseRetryAfter("3", now))
+	assert.Equal(t, 90*time.Second, parseRetryAfter(now.Add(90*time.Second).Format(http.TimeFormat), now))
+	assert.Zero(t, parseRetryAfter("", now))
+	assert.Zero(t, parseRetryAfter("-1", now))
+	assert.Zero(t, parseRetryAfter("soon", now))
+	assert.Zero(t, parseRetryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now))
+}
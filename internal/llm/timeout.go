@@ -0,0 +1,27 @@
+package llm
+
+import (
+	"context"
+	"time"
+)
+
+// callTimeoutKey 上下文中单次调用超时时间的键
+type callTimeoutKey struct{}
+
+// WithCallTimeout 返回携带单次调用超时时间的上下文，覆盖提供方配置的超时时间
+// 超时时间只限制之后发起的每次调用（包含重试），上下文自身的截止时间和取消仍然生效
+func WithCallTimeout(ctx context.Context, timeout time.Duration) context.Context {
+	return context.WithValue(ctx, callTimeoutKey{}, timeout)
+}
+
+// callContext 为一次调用创建上下文：超时时间取上下文中的覆盖值，否则使用 fallback，不大于0时不限制
+func callContext(ctx context.Context, fallback time.Duration) (context.Context, context.CancelFunc) {
+	timeout := fallback
+	if v, ok := ctx.Value(callTimeoutKey{}).(time.Duration); ok {
+		timeout = v
+	}
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,79 @@
+package store
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// fileFormatVersion 文件存储格式版本
+const fileFormatVersion = 1
+
+// FileStore 基于JSON文件的智能体存储
+// 数据常驻内存，每次写操作后整体落盘，适合单进程使用
+type FileStore struct {
+	agentMap
+}
+
+// NewFileStore 打开（或初始化）指定路径的文件存储
+func NewFileStore(path string) (*FileStore, error) {
+	if path == "" {
+		return nil, errors.New("文件存储路径不能为空")
+	}
+	items, err := openMapStore(path, "agents", (*Agent).Clone)
+	if err != nil {
+		return nil, err
+	}
+	return &FileStore{agentMap{items}}, nil
+}
+
+// readJSONFile 读取JSON文件，文件不存在时返回 false
+func readJSONFile(path string, v interface{}) (bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, fmt.Errorf("读取存储文件失败: %v", err)
+	}
+	if len(data) == 0 {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return false, fmt.Errorf("解析存储文件失败: %v", err)
+	}
+	return true, nil
+}
+
+// writeJSONFile 先写临时文件再重命名，避免写入中断导致文件损坏
+func writeJSONFile(path string, v interface{}) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("创建存储目录失败: %v", err)
+	}
+
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("序列化存储数据失败: %v", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return fmt.Errorf("创建临时文件失败: %v", err)
+	}
+	tmpName := tmp.Name()
+	defer os.Remove(tmpName)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("写入存储文件失败: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("写入存储文件失败: %v", err)
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return fmt.Errorf("写入存储文件失败: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+)
+
+// mapStore 以ID为键的并发安全存储，内存存储与文件存储共用这一实现
+// path 为空时数据只保存在内存中；否则数据常驻内存，每次写操作后整体落盘，落盘失败时回滚内存状态，适合单进程使用
+type mapStore[V any] struct {
+	mu    sync.RWMutex
+	path  string
+	field string // 存储文件中保存数据的字段名
+	items map[string]V
+	clone func(V) V // 存入和读出时复制数据，调用方与存储之间不共享数据
+}
+
+// newMapStore 创建内存中的存储
+func newMapStore[V any](clone func(V) V) *mapStore[V] {
+	return &mapStore[V]{items: make(map[string]V), clone: clone}
+}
+
+// openMapStore 打开（或初始化）指定路径的文件存储
+// 文件格式为 {"version": 1, "<field>": {"<id>": ...}}
+func openMapStore[V any](path, field string, clone func(V) V) (*mapStore[V], error) {
+	s := newMapStore(clone)
+	s.path, s.field = path, field
+
+	var data map[string]json.RawMessage
+	found, err := readJSONFile(path, &data)
+	if err != nil {
+		return nil, err
+	}
+	if !found {
+		return s, nil
+	}
+	var items map[string]V
+	if raw, ok := data[field]; ok {
+		if err := json.Unmarshal(raw, &items); err != nil {
+			return nil, fmt.Errorf("解析存储文件失败: %v", err)
+		}
+	}
+	if items != nil {
+		s.items = items
+	}
+	return s, nil
+}
+
+// get 返回数据副本
+func (s *mapStore[V]) get(id string) (V, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	v, ok := s.items[id]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return s.clone(v), true
+}
+
+// list 返回所有数据的副本，顺序不固定
+func (s *mapStore[V]) list() []V {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	list := make([]V, 0, len(s.items))
+	for _, v := range s.items {
+		list = append(list, s.clone(v))
+	}
+	return list
+}
+
+// put 保存数据副本
+func (s *mapStore[V]) put(id string, v V) error {
+	return s.update(id, func(V, bool) V { return v })
+}
+
+// update 在写锁内根据原值（不存在时 ok 为 false）计算新值并保存其副本，fn 不能修改原值
+func (s *mapStore[V]) update(id string, fn func(prev V, ok bool) V) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, existed := s.items[id]
+	s.items[id] = s.clone(fn(prev, existed))
+	if err := s.flush(); err != nil {
+		if existed {
+			s.items[id] = prev
+		} else {
+			delete(s.items, id)
+		}
+		return err
+	}
+	return nil
+}
+
+// remove 删除数据，返回数据是否存在
+func (s *mapStore[V]) remove(id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev, ok := s.items[id]
+	if !ok {
+		return false, nil
+	}
+	delete(s.items, id)
+	if err := s.flush(); err != nil {
+		s.items[id] = prev
+		return true, err
+	}
+	return true, nil
+}
+
+// flush 将当前数据写入文件，内存存储不做任何事，调用方需持有写锁
+func (s *mapStore[V]) flush() error {
+	if s.path == "" {
+		return nil
+	}
+	return writeJSONFile(s.path, map[string]interface{}{
+		"version": fileFormatVersion,
+		s.field:   s.items,
+	})
+}
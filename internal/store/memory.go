@@ -0,0 +1,11 @@
+package store
+
+// MemoryStore 基于内存的智能体存储，进程退出后数据丢失
+type MemoryStore struct {
+	agentMap
+}
+
+// NewMemoryStore 创建内存存储
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{agentMap{newMapStore((*Agent).Clone)}}
+}
@@ -0,0 +1,104 @@
+package store
+
+import (
+	"errors"
+	"strings"
+)
+
+// Persona 结构化的智能体人格
+type Persona struct {
+	ExpertiseDomains    []string `json:"expertise_domains" yaml:"expertise_domains"`
+	Traits              []string `json:"traits" yaml:"traits"`
+	SpeakingStyle       string   `json:"speaking_style" yaml:"speaking_style"`
+	Values              []string `json:"values,omitempty" yaml:"values,omitempty"`
+	KnowledgeBoundaries []string `json:"knowledge_boundaries,omitempty" yaml:"knowledge_boundaries,omitempty"`
+	TabooTopics         []string `json:"taboo_topics,omitempty" yaml:"taboo_topics,omitempty"`
+	ExampleUtterances   []string `json:"example_utterances,omitempty" yaml:"example_utterances,omitempty"`
+}
+
+// Clone 返回人格的深拷贝
+func (p *Persona) Clone() *Persona {
+	if p == nil {
+		return nil
+	}
+	return &Persona{
+		ExpertiseDomains:    cloneStrings(p.ExpertiseDomains),
+		Traits:              cloneStrings(p.Traits),
+		SpeakingStyle:       p.SpeakingStyle,
+		Values:              cloneStrings(p.Values),
+		KnowledgeBoundaries: cloneStrings(p.KnowledgeBoundaries),
+		TabooTopics:         cloneStrings(p.TabooTopics),
+		ExampleUtterances:   cloneStrings(p.ExampleUtterances),
+	}
+}
+
+// Normalize 去除各字段中的空白项和重复项
+func (p *Persona) Normalize() {
+	p.ExpertiseDomains = normalizeStrings(p.ExpertiseDomains)
+	p.Traits = normalizeStrings(p.Traits)
+	p.SpeakingStyle = strings.TrimSpace(p.SpeakingStyle)
+	p.Values = normalizeStrings(p.Values)
+	p.KnowledgeBoundaries = normalizeStrings(p.KnowledgeBoundaries)
+	p.TabooTopics = normalizeStrings(p.TabooTopics)
+	p.ExampleUtterances = normalizeStrings(p.ExampleUtterances)
+}
+
+// Validate 校验人格的必填字段
+func (p *Persona) Validate() error {
+	if len(p.ExpertiseDomains) == 0 {
+		return errors.New("persona.expertise_domains must not be empty")
+	}
+	if len(p.Traits) == 0 {
+		return errors.New("persona.traits must not be empty")
+	}
+	if p.SpeakingStyle == "" {
+		return errors.New("persona.speaking_style must not be empty")
+	}
+	return nil
+}
+
+// SplitTraits 将逗号、顿号或分号分隔的核心特质字符串拆分为列表
+func SplitTraits(coreTraits string) []string {
+	fields := strings.FieldsFunc(coreTraits, func(r rune) bool {
+		switch r {
+		case ',', '，', '、', ';', '；', '\n':
+			return true
+		}
+		return false
+	})
+	return normalizeStrings(fields)
+}
+
+// NormalizeTags 去除标签中的空白项和重复项
+func NormalizeTags(tags []string) []string {
+	return normalizeStrings(tags)
+}
+
+// normalizeStrings 去除空白项与重复项，保持原有顺序，结果为空时返回 nil
+func normalizeStrings(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	seen := make(map[string]bool, len(values))
+	result := make([]string, 0, len(values))
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" || seen[v] {
+			continue
+		}
+		seen[v] = true
+		result = append(result, v)
+	}
+	if len(result) == 0 {
+		return nil
+	}
+	return result
+}
+
+// cloneStrings 复制字符串切片，nil 保持为 nil
+func cloneStrings(values []string) []string {
+	if values == nil {
+		return nil
+	}
+	return append([]string(nil), values...)
+}
@@ -0,0 +1,102 @@
+package store
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// 人格文件的格式标识与版本
+const (
+	PersonaFileKind    = "agent-forge/persona"
+	PersonaFileVersion = 1
+)
+
+// 人格文件的序列化格式
+const (
+	FormatYAML = "yaml"
+	FormatJSON = "json"
+)
+
+// PersonaFile 可在不同机器之间迁移的智能体人格文件
+type PersonaFile struct {
+	Kind    string `json:"kind" yaml:"kind"`
+	Version int    `json:"version" yaml:"version"`
+	Agent   Agent  `json:"agent" yaml:"agent"`
+}
+
+// FormatFromPath 根据文件扩展名推断序列化格式，无法识别时使用 YAML
+func FormatFromPath(path string) string {
+	if strings.EqualFold(filepath.Ext(path), ".json") {
+		return FormatJSON
+	}
+	return FormatYAML
+}
+
+// MarshalPersonaFile 将智能体序列化为指定格式的人格文件
+func MarshalPersonaFile(agent Agent, format string) ([]byte, error) {
+	file := PersonaFile{
+		Kind:    PersonaFileKind,
+		Version: PersonaFileVersion,
+		Agent:   *agent.Clone(),
+	}
+	file.Agent.Source = ""
+	file.Agent.Version = 0
+
+	switch format {
+	case FormatJSON:
+		data, err := json.MarshalIndent(file, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case FormatYAML, "":
+		var buf bytes.Buffer
+		enc := yaml.NewEncoder(&buf)
+		enc.SetIndent(2)
+		if err := enc.Encode(file); err != nil {
+			return nil, err
+		}
+		if err := enc.Close(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, fmt.Errorf("不支持的人格文件格式: %s", format)
+	}
+}
+
+// UnmarshalPersonaFile 解析 YAML 或 JSON 格式的人格文件并校验版本
+func UnmarshalPersonaFile(data []byte) (*Agent, error) {
+	var file PersonaFile
+	// JSON 是 YAML 的子集，统一按 YAML 解析
+	if err := yaml.Unmarshal(data, &file); err != nil {
+		return nil, fmt.Errorf("解析人格文件失败: %v", err)
+	}
+
+	if file.Kind != PersonaFileKind {
+		return nil, fmt.Errorf("不是有效的人格文件: kind=%q", file.Kind)
+	}
+	if file.Version < 1 || file.Version > PersonaFileVersion {
+		return nil, fmt.Errorf("不支持的人格文件版本: %d", file.Version)
+	}
+	// 来源与版本号由本机决定，不信任文件中的值
+	file.Agent.Source = ""
+	file.Agent.Version = 0
+	if strings.TrimSpace(file.Agent.Name) == "" {
+		return nil, errors.New("人格文件缺少智能体名称")
+	}
+	file.Agent.Tags = NormalizeTags(file.Agent.Tags)
+	if file.Agent.Persona != nil {
+		file.Agent.Persona.Normalize()
+		if err := file.Agent.Persona.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	return &file.Agent, nil
+}
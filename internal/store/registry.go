@@ -0,0 +1,392 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"agent-forge/internal/logger"
+
+	"go.uber.org/zap"
+)
+
+// ErrAgentExists 表示智能体ID已存在
+var ErrAgentExists = errors.New("agent already exists")
+
+// ErrAgentConflict 表示导入的智能体与已有智能体的ID或名称冲突
+var ErrAgentConflict = errors.New("agent conflict")
+
+// ConflictPolicy 导入智能体时ID或名称冲突的处理方式
+type ConflictPolicy string
+
+// 冲突处理方式
+const (
+	// ConflictError 存在冲突时放弃导入
+	ConflictError ConflictPolicy = "error"
+	// ConflictReplace 覆盖ID相同（其次是名称相同）的已有智能体，保留其ID
+	ConflictReplace ConflictPolicy = "replace"
+	// ConflictCopy 作为新的智能体导入，使用新ID，名称重复时追加序号
+	ConflictCopy ConflictPolicy = "copy"
+)
+
+// ParseConflictPolicy 解析冲突处理方式，为空时返回 ConflictError
+func ParseConflictPolicy(s string) (ConflictPolicy, error) {
+	switch policy := ConflictPolicy(s); policy {
+	case "":
+		return ConflictError, nil
+	case ConflictError, ConflictReplace, ConflictCopy:
+		return policy, nil
+	default:
+		return "", fmt.Errorf("unsupported conflict policy: %s", s)
+	}
+}
+
+// ChangeType 智能体变更类型
+type ChangeType string
+
+// 智能体变更类型
+const (
+	AgentCreated ChangeType = "created"
+	AgentUpdated ChangeType = "updated"
+	AgentDeleted ChangeType = "deleted"
+)
+
+// ChangeEvent 智能体变更事件，Agent 为变更后的快照（删除时为删除前的快照）
+type ChangeEvent struct {
+	Type  ChangeType
+	Agent Agent
+}
+
+// Registry 并发安全的智能体注册表
+// 所有写操作串行执行，保证读-改-写的原子性；读操作返回智能体快照，
+// 调用方对快照的修改不会影响存储中的数据
+type Registry struct {
+	mu        sync.Mutex
+	store     AgentStore
+	versions  VersionStore
+	listeners []func(ChangeEvent)
+}
+
+// NewRegistry 基于存储后端创建注册表，版本历史保存在内存中
+func NewRegistry(s AgentStore) *Registry {
+	return NewRegistryWithVersions(s, NewMemoryVersionStore())
+}
+
+// NewRegistryWithVersions 基于存储后端和版本历史存储创建注册表
+func NewRegistryWithVersions(s AgentStore, versions VersionStore) *Registry {
+	return &Registry{store: s, versions: versions}
+}
+
+// Subscribe 注册变更监听器
+// 监听器在写操作成功后、仍持有注册表锁时按变更顺序同步调用，
+// 因此监听器可以读取注册表，但不能调用写操作，也不应执行耗时操作
+func (r *Registry) Subscribe(fn func(ChangeEvent)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.listeners = append(r.listeners, fn)
+}
+
+// notify 通知所有监听器，调用方需持有注册表锁
+func (r *Registry) notify(changeType ChangeType, agent *Agent) {
+	for _, fn := range r.listeners {
+		fn(ChangeEvent{Type: changeType, Agent: *agent.Clone()})
+	}
+}
+
+// put 保存智能体并记录为新的历史版本，调用方需持有注册表锁
+// prev 为写入前的智能体，新建时为 nil；保存或历史版本记录失败时恢复写入前的智能体和历史
+func (r *Registry) put(agent *Agent, prev *Agent, reason string) error {
+	now := time.Now().Format(time.RFC3339)
+	orig := prev
+	baselined := false
+	agent.Version = 1
+	if prev != nil {
+		if prev.Version == 0 {
+			// 启用版本历史之前创建的智能体，先记录修改前的内容作为基线版本
+			baseline := prev.Clone()
+			baseline.Version = 1
+			if err := r.versions.Append(prev.ID, &AgentVersion{
+				Version:   1,
+				Reason:    ReasonBaseline,
+				CreatedAt: now,
+				Agent:     *baseline,
+			}); err != nil {
+				return fmt.Errorf("record agent version failed: %v", err)
+			}
+			prev = baseline
+			baselined = true
+		}
+		agent.Version = prev.Version + 1
+	}
+
+	if err := r.store.Put(agent); err != nil {
+		if undoErr := r.undoBaseline(agent.ID, baselined); undoErr != nil {
+			return fmt.Errorf("%v (remove baseline version failed: %v)", err, undoErr)
+		}
+		return err
+	}
+	if err := r.versions.Append(agent.ID, &AgentVersion{
+		Version:   agent.Version,
+		Reason:    reason,
+		CreatedAt: now,
+		Agent:     *agent,
+	}); err != nil {
+		// 智能体与历史版本保存在不同的存储中，撤销已写入的智能体，避免版本号超前于历史
+		var undoErr error
+		if orig != nil {
+			undoErr = r.store.Put(orig)
+		} else {
+			undoErr = r.store.Delete(agent.ID)
+		}
+		undoErr = errors.Join(undoErr, r.undoBaseline(agent.ID, baselined))
+		if undoErr != nil {
+			return fmt.Errorf("record agent version failed: %v (restore agent failed: %v)", err, undoErr)
+		}
+		return fmt.Errorf("record agent version failed: %v", err)
+	}
+	return nil
+}
+
+// undoBaseline 撤销本次写入的基线版本，智能体恢复为版本 0 后，下次修改会重新记录基线
+// 版本号为 0 的智能体在记录基线之前没有历史，因此删除全部历史即可
+func (r *Registry) undoBaseline(id string, baselined bool) error {
+	if !baselined {
+		return nil
+	}
+	return r.versions.Delete(id)
+}
+
+// Get 获取智能体快照
+func (r *Registry) Get(id string) (Agent, error) {
+	agent, err := r.store.Get(id)
+	if err != nil {
+		return Agent{}, err
+	}
+	return *agent.Clone(), nil
+}
+
+// List 获取所有智能体快照
+func (r *Registry) List() ([]Agent, error) {
+	list, err := r.store.List()
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make([]Agent, 0, len(list))
+	for _, agent := range list {
+		snapshots = append(snapshots, *agent.Clone())
+	}
+	return snapshots, nil
+}
+
+// Create 注册新的智能体，ID已存在时返回 ErrAgentExists
+func (r *Registry) Create(agent Agent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.store.Get(agent.ID); err == nil {
+		return fmt.Errorf("%w: %s", ErrAgentExists, agent.ID)
+	} else if !errors.Is(err, ErrAgentNotFound) {
+		return err
+	}
+	created := agent.Clone()
+	if err := r.put(created, nil, ReasonCreated); err != nil {
+		return err
+	}
+	r.notify(AgentCreated, created)
+	return nil
+}
+
+// Update 原子地修改智能体并返回修改后的快照
+// fn 在注册表锁内执行，不应包含耗时操作（如调用LLM）；fn 返回错误时放弃修改
+func (r *Registry) Update(id string, fn func(agent *Agent) error) (Agent, error) {
+	return r.UpdateWithReason(id, ReasonUpdated, fn)
+}
+
+// UpdateWithReason 与 Update 相同，并将 reason 记录为本次修改的原因
+func (r *Registry) UpdateWithReason(id, reason string, fn func(agent *Agent) error) (Agent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	agent, err := r.store.Get(id)
+	if err != nil {
+		return Agent{}, err
+	}
+	prev := agent.Clone()
+	if err := fn(agent); err != nil {
+		return Agent{}, err
+	}
+	agent.ID = id
+	if err := r.put(agent, prev, reason); err != nil {
+		return Agent{}, err
+	}
+	r.notify(AgentUpdated, agent)
+	return *agent.Clone(), nil
+}
+
+// Import 按冲突处理方式原子地导入智能体，返回最终保存的快照以及是否覆盖了已有智能体
+// newID 用于生成新的智能体ID
+func (r *Registry) Import(agent Agent, policy ConflictPolicy, newID func() string) (Agent, bool, error) {
+	return r.ImportWithReason(agent, policy, newID, ReasonImported)
+}
+
+// ImportWithReason 与 Import 相同，并将 reason 记录为本次导入的原因
+func (r *Registry) ImportWithReason(agent Agent, policy ConflictPolicy, newID func() string, reason string) (Agent, bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	list, err := r.store.List()
+	if err != nil {
+		return Agent{}, false, err
+	}
+
+	// 查找ID或名称冲突的智能体，ID冲突优先
+	var existing *Agent
+	names := make(map[string]bool, len(list))
+	for _, a := range list {
+		names[a.Name] = true
+		if agent.ID != "" && a.ID == agent.ID {
+			existing = a
+		}
+	}
+	if existing == nil {
+		for _, a := range list {
+			if a.Name == agent.Name {
+				existing = a
+				break
+			}
+		}
+	}
+
+	imported := agent.Clone()
+	replaced := false
+	var prev *Agent
+	switch {
+	case existing == nil:
+		if imported.ID == "" {
+			imported.ID = newID()
+		}
+	case policy == ConflictReplace:
+		imported.ID = existing.ID
+		replaced = true
+		prev = existing
+	case policy == ConflictCopy:
+		imported.ID = newID()
+		imported.Name = uniqueName(imported.Name, names)
+	default:
+		return Agent{}, false, fmt.Errorf("%w: %s (%s) conflicts with existing agent %s (%s)",
+			ErrAgentConflict, agent.Name, agent.ID, existing.Name, existing.ID)
+	}
+
+	if err := r.put(imported, prev, reason); err != nil {
+		return Agent{}, false, err
+	}
+	if replaced {
+		r.notify(AgentUpdated, imported)
+	} else {
+		r.notify(AgentCreated, imported)
+	}
+	return *imported.Clone(), replaced, nil
+}
+
+// uniqueName 名称已被占用时追加序号，如 "名称 (2)"
+func uniqueName(name string, taken map[string]bool) string {
+	if !taken[name] {
+		return name
+	}
+	for i := 2; ; i++ {
+		candidate := fmt.Sprintf("%s (%d)", name, i)
+		if !taken[candidate] {
+			return candidate
+		}
+	}
+}
+
+// Delete 删除智能体及其版本历史
+// 智能体删除后，版本历史删除失败只记录日志，不影响删除结果
+func (r *Registry) Delete(id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	agent, err := r.store.Get(id)
+	if err != nil {
+		return err
+	}
+	if err := r.store.Delete(id); err != nil {
+		return err
+	}
+	if err := r.versions.Delete(id); err != nil {
+		logger.Warn("删除智能体版本历史失败", zap.String("agent_id", id), zap.Error(err))
+	}
+	r.notify(AgentDeleted, agent)
+	return nil
+}
+
+// Versions 按版本号升序返回智能体的历史版本快照
+func (r *Registry) Versions(id string) ([]AgentVersion, error) {
+	if _, err := r.store.Get(id); err != nil {
+		return nil, err
+	}
+	list, err := r.versions.List(id)
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make([]AgentVersion, 0, len(list))
+	for _, v := range list {
+		snapshots = append(snapshots, *v)
+	}
+	return snapshots, nil
+}
+
+// Version 获取智能体指定版本的快照，不存在时返回 ErrVersionNotFound
+func (r *Registry) Version(id string, version int) (AgentVersion, error) {
+	list, err := r.Versions(id)
+	if err != nil {
+		return AgentVersion{}, err
+	}
+	for _, v := range list {
+		if v.Version == version {
+			return v, nil
+		}
+	}
+	return AgentVersion{}, fmt.Errorf("%w: %s v%d", ErrVersionNotFound, id, version)
+}
+
+// Rollback 将智能体恢复为指定历史版本的内容，恢复结果作为新版本记录，不会删除之后的历史
+// 版本原因记录为 "rollback to v<版本号>"，note 不为空时追加在其后
+func (r *Registry) Rollback(id string, version int, note string) (Agent, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, err := r.store.Get(id)
+	if err != nil {
+		return Agent{}, err
+	}
+	list, err := r.versions.List(id)
+	if err != nil {
+		return Agent{}, err
+	}
+	var target *AgentVersion
+	for _, v := range list {
+		if v.Version == version {
+			target = v
+			break
+		}
+	}
+	if target == nil {
+		return Agent{}, fmt.Errorf("%w: %s v%d", ErrVersionNotFound, id, version)
+	}
+
+	restored := target.Agent.Clone()
+	restored.ID = id
+	restored.CreatedAt = current.CreatedAt
+	reason := fmt.Sprintf("rollback to v%d", version)
+	if note != "" {
+		reason += ": " + note
+	}
+	if err := r.put(restored, current, reason); err != nil {
+		return Agent{}, err
+	}
+	r.notify(AgentUpdated, restored)
+	return *restored.Clone(), nil
+}
@@ -0,0 +1,222 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"agent-forge/internal/config"
+)
+
+// ErrSessionNotFound 表示讨论会话不存在
+var ErrSessionNotFound = errors.New("session not found")
+
+// 会话状态
+const (
+	SessionOpen   = "open"
+	SessionClosed = "closed"
+)
+
+// 发言者类型
+const (
+	SpeakerAgent     = "agent"
+	SpeakerModerator = "moderator"
+)
+
+// Turn 会话中的一次发言
+type Turn struct {
+	Index     int    `json:"index"`
+	Round     int    `json:"round"`
+	Speaker   string `json:"speaker"`
+	AgentID   string `json:"agent_id,omitempty"`
+	Name      string `json:"name"`
+	Content   string `json:"content"`
+	CreatedAt string `json:"created_at"`
+}
+
+// Session 讨论会话，服务端记录每位智能体的发言和轮次
+type Session struct {
+	ID            string   `json:"id"`
+	Topic         string   `json:"topic"`
+	AgentIDs      []string `json:"agent_ids"`
+	Turns         []Turn   `json:"turns"`
+	PlannedRounds int      `json:"planned_rounds"`
+	CurrentRound  int      `json:"current_round"`
+	Status        string   `json:"status"`
+	CreatedAt     string   `json:"created_at"`
+	UpdatedAt     string   `json:"updated_at"`
+	ClosedAt      string   `json:"closed_at,omitempty"`
+}
+
+// Clone 返回会话的深拷贝
+func (s *Session) Clone() *Session {
+	if s == nil {
+		return nil
+	}
+	c := *s
+	c.AgentIDs = append([]string(nil), s.AgentIDs...)
+	c.Turns = append([]Turn(nil), s.Turns...)
+	return &c
+}
+
+// HasParticipant 判断智能体是否参与该会话
+func (s *Session) HasParticipant(agentID string) bool {
+	for _, id := range s.AgentIDs {
+		if id == agentID {
+			return true
+		}
+	}
+	return false
+}
+
+// SessionStore 会话存储接口
+type SessionStore interface {
+	// Get 根据ID获取会话，不存在时返回 ErrSessionNotFound
+	Get(id string) (*Session, error)
+	// List 按创建时间顺序列出所有会话
+	List() ([]*Session, error)
+	// Put 新增或覆盖会话
+	Put(session *Session) error
+	// Delete 删除会话，不存在时返回 ErrSessionNotFound
+	Delete(id string) error
+}
+
+// NewSessionStore 根据配置创建会话存储，与智能体存储使用相同的后端
+func NewSessionStore(cfg config.StoreConfig) (SessionStore, error) {
+	switch cfg.Backend {
+	case "", "memory":
+		return NewMemorySessionStore(), nil
+	case "file":
+		return NewFileSessionStore(cfg.SessionPath)
+	default:
+		return nil, fmt.Errorf("不支持的存储后端: %s", cfg.Backend)
+	}
+}
+
+// sessionMap 基于 mapStore 的会话存储实现，内存存储与文件存储共用
+type sessionMap struct {
+	items *mapStore[*Session]
+}
+
+// Get 获取会话副本
+func (s sessionMap) Get(id string) (*Session, error) {
+	session, ok := s.items.get(id)
+	if !ok {
+		return nil, ErrSessionNotFound
+	}
+	return session, nil
+}
+
+// List 列出所有会话副本
+func (s sessionMap) List() ([]*Session, error) {
+	list := s.items.list()
+	sortSessions(list)
+	return list, nil
+}
+
+// Put 保存会话副本
+func (s sessionMap) Put(session *Session) error {
+	if session == nil || session.ID == "" {
+		return errors.New("session id is required")
+	}
+	return s.items.put(session.ID, session)
+}
+
+// Delete 删除会话
+func (s sessionMap) Delete(id string) error {
+	ok, err := s.items.remove(id)
+	if !ok {
+		return ErrSessionNotFound
+	}
+	return err
+}
+
+// MemorySessionStore 基于内存的会话存储
+type MemorySessionStore struct {
+	sessionMap
+}
+
+// NewMemorySessionStore 创建内存会话存储
+func NewMemorySessionStore() *MemorySessionStore {
+	return &MemorySessionStore{sessionMap{newMapStore((*Session).Clone)}}
+}
+
+// FileSessionStore 基于JSON文件的会话存储
+type FileSessionStore struct {
+	sessionMap
+}
+
+// NewFileSessionStore 打开（或初始化）指定路径的会话文件存储
+func NewFileSessionStore(path string) (*FileSessionStore, error) {
+	if path == "" {
+		return nil, errors.New("会话存储路径不能为空")
+	}
+	items, err := openMapStore(path, "sessions", (*Session).Clone)
+	if err != nil {
+		return nil, err
+	}
+	return &FileSessionStore{sessionMap{items}}, nil
+}
+
+// sortSessions 按创建时间和ID排序，保证列表顺序稳定
+func sortSessions(list []*Session) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].CreatedAt != list[j].CreatedAt {
+			return list[i].CreatedAt < list[j].CreatedAt
+		}
+		return list[i].ID < list[j].ID
+	})
+}
+
+// SessionRegistry 并发安全的会话注册表，写操作串行执行并返回快照
+type SessionRegistry struct {
+	mu    sync.Mutex
+	store SessionStore
+}
+
+// NewSessionRegistry 基于存储后端创建会话注册表
+func NewSessionRegistry(s SessionStore) *SessionRegistry {
+	return &SessionRegistry{store: s}
+}
+
+// Get 获取会话快照
+func (r *SessionRegistry) Get(id string) (Session, error) {
+	session, err := r.store.Get(id)
+	if err != nil {
+		return Session{}, err
+	}
+	return *session.Clone(), nil
+}
+
+// Create 注册新的会话
+func (r *SessionRegistry) Create(session Session) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, err := r.store.Get(session.ID); err == nil {
+		return fmt.Errorf("session already exists: %s", session.ID)
+	} else if !errors.Is(err, ErrSessionNotFound) {
+		return err
+	}
+	return r.store.Put(session.Clone())
+}
+
+// Update 原子地修改会话并返回修改后的快照，fn 返回错误时放弃修改
+func (r *SessionRegistry) Update(id string, fn func(session *Session) error) (Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, err := r.store.Get(id)
+	if err != nil {
+		return Session{}, err
+	}
+	if err := fn(session); err != nil {
+		return Session{}, err
+	}
+	session.ID = id
+	if err := r.store.Put(session); err != nil {
+		return Session{}, err
+	}
+	return *session.Clone(), nil
+}
@@ -0,0 +1,133 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"agent-forge/internal/config"
+)
+
+// ErrAgentNotFound 表示智能体不存在
+var ErrAgentNotFound = errors.New("agent not found")
+
+// Agent 结构体定义
+type Agent struct {
+	ID          string   `json:"id" yaml:"id"`
+	Name        string   `json:"name" yaml:"name"`
+	CoreTraits  string   `json:"core_traits" yaml:"core_traits"`
+	Personality string   `json:"personality" yaml:"personality"`
+	Tags        []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	CreatedAt   string   `json:"created_at" yaml:"created_at"`
+
+	// 当前版本号，由注册表在每次写入时递增，不随人格文件导出
+	Version int `json:"version,omitempty" yaml:"-"`
+
+	// 结构化人格，存在时作答的系统提示词由其渲染生成
+	Persona *Persona `json:"persona,omitempty" yaml:"persona,omitempty"`
+
+	// 智能体来源，由智能体库加载时为 "library:<文件名>"，不随人格文件导出
+	Source string `json:"source,omitempty" yaml:"-"`
+
+	// 可选的模型与采样参数，未设置时使用LLM提供方的默认值
+	Model       string   `json:"model,omitempty" yaml:"model,omitempty"`
+	Temperature *float64 `json:"temperature,omitempty" yaml:"temperature,omitempty"`
+	TopP        *float64 `json:"top_p,omitempty" yaml:"top_p,omitempty"`
+	MaxTokens   int      `json:"max_tokens,omitempty" yaml:"max_tokens,omitempty"`
+	Seed        *int     `json:"seed,omitempty" yaml:"seed,omitempty"`
+}
+
+// Clone 返回智能体的深拷贝
+func (a *Agent) Clone() *Agent {
+	if a == nil {
+		return nil
+	}
+	c := *a
+	c.Persona = a.Persona.Clone()
+	c.Tags = cloneStrings(a.Tags)
+	c.Temperature = clonePtr(a.Temperature)
+	c.TopP = clonePtr(a.TopP)
+	c.Seed = clonePtr(a.Seed)
+	return &c
+}
+
+// clonePtr 复制指针指向的值，避免副本之间共享数据
+func clonePtr[T any](p *T) *T {
+	if p == nil {
+		return nil
+	}
+	v := *p
+	return &v
+}
+
+// AgentStore 智能体存储接口
+type AgentStore interface {
+	// Get 根据ID获取智能体，不存在时返回 ErrAgentNotFound
+	Get(id string) (*Agent, error)
+	// List 按创建时间顺序列出所有智能体
+	List() ([]*Agent, error)
+	// Put 新增或覆盖智能体
+	Put(agent *Agent) error
+	// Delete 删除智能体，不存在时返回 ErrAgentNotFound
+	Delete(id string) error
+}
+
+// NewAgentStore 根据配置创建智能体存储
+func NewAgentStore(cfg config.StoreConfig) (AgentStore, error) {
+	switch cfg.Backend {
+	case "", "memory":
+		return NewMemoryStore(), nil
+	case "file":
+		return NewFileStore(cfg.Path)
+	default:
+		return nil, fmt.Errorf("不支持的存储后端: %s", cfg.Backend)
+	}
+}
+
+// sortAgents 按创建时间和ID排序，保证列表顺序稳定
+func sortAgents(list []*Agent) {
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].CreatedAt != list[j].CreatedAt {
+			return list[i].CreatedAt < list[j].CreatedAt
+		}
+		return list[i].ID < list[j].ID
+	})
+}
+
+// agentMap 基于 mapStore 的智能体存储实现，内存存储与文件存储共用
+type agentMap struct {
+	items *mapStore[*Agent]
+}
+
+// Get 获取智能体副本
+func (s agentMap) Get(id string) (*Agent, error) {
+	agent, ok := s.items.get(id)
+	if !ok {
+		return nil, ErrAgentNotFound
+	}
+	return agent, nil
+}
+
+// List 列出所有智能体副本
+func (s agentMap) List() ([]*Agent, error) {
+	list := s.items.list()
+	sortAgents(list)
+	return list, nil
+}
+
+// Put 保存智能体副本
+func (s agentMap) Put(agent *Agent) error {
+	if agent == nil || agent.ID == "" {
+		return errors.New("agent id is required")
+	}
+	return s.items.put(agent.ID, agent)
+}
+
+// Delete 删除智能体
+func (s agentMap) Delete(id string) error {
+	ok, err := s.items.remove(id)
+	if !ok {
+		return ErrAgentNotFound
+	}
+	return err
+}
@@ -0,0 +1,451 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"agent-forge/internal/config"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentStores(t *testing.T) {
+	fileStore, err := NewFileStore(filepath.Join(t.TempDir(), "agents.json"))
+	require.NoError(t, err)
+
+	stores := map[string]AgentStore{
+		"memory": NewMemoryStore(),
+		"file":   fileStore,
+	}
+
+	for name, s := range stores {
+		t.Run(name, func(t *testing.T) {
+			agent := &Agent{ID: "a1", Name: "测试智能体", CoreTraits: "严谨", CreatedAt: "2025-01-01T00:00:00Z"}
+			require.NoError(t, s.Put(agent))
+			require.NoError(t, s.Put(&Agent{ID: "a2", Name: "第二个", CreatedAt: "2025-01-02T00:00:00Z"}))
+
+			// 修改返回值不应影响存储内容
+			got, err := s.Get("a1")
+			require.NoError(t, err)
+			got.Name = "被修改"
+			again, err := s.Get("a1")
+			require.NoError(t, err)
+			assert.Equal(t, "测试智能体", again.Name)
+
+			list, err := s.List()
+			require.NoError(t, err)
+			require.Len(t, list, 2)
+			assert.Equal(t, "a1", list[0].ID)
+			assert.Equal(t, "a2", list[1].ID)
+
+			require.NoError(t, s.Delete("a1"))
+			_, err = s.Get("a1")
+			assert.ErrorIs(t, err, ErrAgentNotFound)
+			assert.ErrorIs(t, s.Delete("a1"), ErrAgentNotFound)
+		})
+	}
+}
+
+func TestFileStorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "agents.json")
+
+	s, err := NewFileStore(path)
+	require.NoError(t, err)
+	require.NoError(t, s.Put(&Agent{ID: "a1", Name: "持久化智能体", Personality: "冷静"}))
+
+	// 重新打开后数据依然存在
+	reopened, err := NewFileStore(path)
+	require.NoError(t, err)
+	agent, err := reopened.Get("a1")
+	require.NoError(t, err)
+	assert.Equal(t, "持久化智能体", agent.Name)
+	assert.Equal(t, "冷静", agent.Personality)
+}
+
+func TestFileStoreRollbackOnWriteFailure(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	s, err := NewFileStore(filepath.Join(dir, "agents.json"))
+	require.NoError(t, err)
+	require.NoError(t, s.Put(&Agent{ID: "a1", Name: "原名"}))
+
+	// 存储目录被普通文件占据，之后的写入都会失败
+	require.NoError(t, os.RemoveAll(dir))
+	require.NoError(t, os.WriteFile(dir, nil, 0644))
+
+	assert.Error(t, s.Put(&Agent{ID: "a1", Name: "新名"}))
+	assert.Error(t, s.Put(&Agent{ID: "a2", Name: "新智能体"}))
+	assert.Error(t, s.Delete("a1"))
+
+	// 写入失败的修改全部回滚
+	agent, err := s.Get("a1")
+	require.NoError(t, err)
+	assert.Equal(t, "原名", agent.Name)
+	_, err = s.Get("a2")
+	assert.ErrorIs(t, err, ErrAgentNotFound)
+}
+
+func TestNewAgentStore(t *testing.T) {
+	s, err := NewAgentStore(config.StoreConfig{Backend: "memory"})
+	require.NoError(t, err)
+	assert.IsType(t, &MemoryStore{}, s)
+
+	s, err = NewAgentStore(config.StoreConfig{Backend: "file", Path: filepath.Join(t.TempDir(), "agents.json")})
+	require.NoError(t, err)
+	assert.IsType(t, &FileStore{}, s)
+
+	_, err = NewAgentStore(config.StoreConfig{Backend: "redis"})
+	assert.Error(t, err)
+}
+
+func TestRegistryConcurrentUpdate(t *testing.T) {
+	r := NewRegistry(NewMemoryStore())
+	require.NoError(t, r.Create(Agent{ID: "a1", Name: "计数器"}))
+	assert.ErrorIs(t, r.Create(Agent{ID: "a1"}), ErrAgentExists)
+
+	const workers = 100
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := r.Update("a1", func(agent *Agent) error {
+				agent.Personality += "x"
+				return nil
+			})
+			assert.NoError(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			snapshot, err := r.Get("a1")
+			assert.NoError(t, err)
+			// 修改快照不影响注册表
+			snapshot.Personality = "dirty"
+		}()
+	}
+	wg.Wait()
+
+	agent, err := r.Get("a1")
+	require.NoError(t, err)
+	assert.Len(t, agent.Personality, workers)
+
+	_, err = r.Update("missing", func(agent *Agent) error { return nil })
+	assert.ErrorIs(t, err, ErrAgentNotFound)
+}
+
+func TestFileSessionStorePersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sessions.json")
+
+	s, err := NewFileSessionStore(path)
+	require.NoError(t, err)
+	registry := NewSessionRegistry(s)
+	require.NoError(t, registry.Create(Session{ID: "s1", Topic: "测试主题", AgentIDs: []string{"a1"}, CurrentRound: 1, Status: SessionOpen}))
+	assert.Error(t, registry.Create(Session{ID: "s1"}))
+
+	_, err = registry.Update("s1", func(session *Session) error {
+		session.Turns = append(session.Turns, Turn{Index: 1, Round: 1, Speaker: SpeakerAgent, AgentID: "a1", Content: "发言"})
+		return nil
+	})
+	require.NoError(t, err)
+
+	// 重新打开后会话记录依然存在
+	reopened, err := NewFileSessionStore(path)
+	require.NoError(t, err)
+	session, err := reopened.Get("s1")
+	require.NoError(t, err)
+	assert.Equal(t, "测试主题", session.Topic)
+	require.Len(t, session.Turns, 1)
+	assert.Equal(t, "发言", session.Turns[0].Content)
+
+	_, err = reopened.Get("missing")
+	assert.ErrorIs(t, err, ErrSessionNotFound)
+}
+
+func TestPersona(t *testing.T) {
+	assert.Equal(t, []string{"系统思维", "第一性原理", "工程思维"}, SplitTraits("系统思维, 第一性原理，工程思维、系统思维"))
+
+	persona := &Persona{
+		ExpertiseDomains: []string{" 物理 ", "", "物理"},
+		Traits:           []string{"严谨"},
+		SpeakingStyle:    "  ",
+	}
+	persona.Normalize()
+	assert.Equal(t, []string{"物理"}, persona.ExpertiseDomains)
+	assert.Error(t, persona.Validate())
+
+	persona.SpeakingStyle = "平实"
+	assert.NoError(t, persona.Validate())
+
+	// 克隆后修改不影响原人格
+	agent := &Agent{ID: "a1", Persona: persona}
+	clone := agent.Clone()
+	clone.Persona.Traits[0] = "被修改"
+	assert.Equal(t, "严谨", agent.Persona.Traits[0])
+}
+
+func TestRegistrySubscribe(t *testing.T) {
+	r := NewRegistry(NewMemoryStore())
+	var events []ChangeEvent
+	r.Subscribe(func(event ChangeEvent) {
+		events = append(events, event)
+	})
+
+	require.NoError(t, r.Create(Agent{ID: "a1", Name: "原名"}))
+	_, err := r.Update("a1", func(agent *Agent) error {
+		agent.Name = "新名"
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, r.Delete("a1"))
+	assert.ErrorIs(t, r.Delete("a1"), ErrAgentNotFound)
+
+	require.Len(t, events, 3)
+	assert.Equal(t, AgentCreated, events[0].Type)
+	assert.Equal(t, AgentUpdated, events[1].Type)
+	assert.Equal(t, "新名", events[1].Agent.Name)
+	assert.Equal(t, AgentDeleted, events[2].Type)
+	assert.Equal(t, "a1", events[2].Agent.ID)
+}
+
+func TestPersonaFileRoundTrip(t *testing.T) {
+	temperature := 0.4
+	agent := Agent{
+		ID:         "a1",
+		Name:       "经济学家",
+		CoreTraits: "理性,审慎",
+		Persona: &Persona{
+			ExpertiseDomains: []string{"宏观经济"},
+			Traits:           []string{"理性"},
+			SpeakingStyle:    "平实",
+		},
+		Temperature: &temperature,
+	}
+
+	for _, format := range []string{FormatYAML, FormatJSON} {
+		data, err := MarshalPersonaFile(agent, format)
+		require.NoError(t, err)
+		assert.Contains(t, string(data), PersonaFileKind)
+
+		loaded, err := UnmarshalPersonaFile(data)
+		require.NoError(t, err)
+		assert.Equal(t, agent.Name, loaded.Name)
+		assert.Equal(t, agent.Persona, loaded.Persona)
+		require.NotNil(t, loaded.Temperature)
+		assert.InDelta(t, 0.4, *loaded.Temperature, 1e-9)
+	}
+
+	assert.Equal(t, FormatJSON, FormatFromPath("expert.JSON"))
+	assert.Equal(t, FormatYAML, FormatFromPath("expert.yml"))
+
+	_, err := UnmarshalPersonaFile([]byte("kind: other\nversion: 1\n"))
+	assert.Error(t, err)
+	_, err = UnmarshalPersonaFile([]byte("kind: agent-forge/persona\nversion: 99\nagent:\n  name: x\n"))
+	assert.Error(t, err)
+}
+
+func TestRegistryImport(t *testing.T) {
+	r := NewRegistry(NewMemoryStore())
+	require.NoError(t, r.Create(Agent{ID: "a1", Name: "经济学家", CoreTraits: "旧"}))
+	ids := 0
+	newID := func() string {
+		ids++
+		return fmt.Sprintf("new-%d", ids)
+	}
+
+	// 默认策略下ID或名称冲突都会拒绝导入
+	_, _, err := r.Import(Agent{ID: "a1", Name: "另一个"}, ConflictError, newID)
+	assert.ErrorIs(t, err, ErrAgentConflict)
+	_, _, err = r.Import(Agent{ID: "a2", Name: "经济学家"}, ConflictError, newID)
+	assert.ErrorIs(t, err, ErrAgentConflict)
+
+	// 覆盖同名智能体时保留原ID
+	agent, replaced, err := r.Import(Agent{ID: "other", Name: "经济学家", CoreTraits: "新"}, ConflictReplace, newID)
+	require.NoError(t, err)
+	assert.True(t, replaced)
+	assert.Equal(t, "a1", agent.ID)
+	assert.Equal(t, "新", agent.CoreTraits)
+
+	// 复制时生成新ID并追加序号
+	agent, replaced, err = r.Import(Agent{ID: "a1", Name: "经济学家"}, ConflictCopy, newID)
+	require.NoError(t, err)
+	assert.False(t, replaced)
+	assert.Equal(t, "new-1", agent.ID)
+	assert.Equal(t, "经济学家 (2)", agent.Name)
+
+	// 无冲突时直接导入，缺少ID时生成新ID
+	agent, _, err = r.Import(Agent{Name: "历史学家"}, ConflictError, newID)
+	require.NoError(t, err)
+	assert.Equal(t, "new-2", agent.ID)
+
+	list, err := r.List()
+	require.NoError(t, err)
+	assert.Len(t, list, 3)
+
+	_, err = ParseConflictPolicy("merge")
+	assert.Error(t, err)
+}
+
+func TestRegistryVersions(t *testing.T) {
+	agentStore := NewMemoryStore()
+	// 模拟启用版本历史之前已存在的智能体
+	require.NoError(t, agentStore.Put(&Agent{ID: "a1", Name: "经济学家", CoreTraits: "理性", Personality: "旧的人格"}))
+
+	versionPath := filepath.Join(t.TempDir(), "versions.json")
+	versionStore, err := NewFileVersionStore(versionPath)
+	require.NoError(t, err)
+	registry := NewRegistryWithVersions(agentStore, versionStore)
+
+	updated, err := registry.UpdateWithReason("a1", "调整特质", func(agent *Agent) error {
+		agent.CoreTraits = "激进"
+		agent.Personality = "新的人格"
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, updated.Version)
+
+	versions, err := registry.Versions("a1")
+	require.NoError(t, err)
+	require.Len(t, versions, 2)
+	assert.Equal(t, ReasonBaseline, versions[0].Reason)
+	assert.Equal(t, "旧的人格", versions[0].Agent.Personality)
+	assert.Equal(t, "调整特质", versions[1].Reason)
+
+	restored, err := registry.Rollback("a1", 1, "生成结果不理想")
+	require.NoError(t, err)
+	assert.Equal(t, 3, restored.Version)
+	assert.Equal(t, "旧的人格", restored.Personality)
+	assert.Equal(t, "理性", restored.CoreTraits)
+
+	_, err = registry.Rollback("a1", 9, "")
+	assert.ErrorIs(t, err, ErrVersionNotFound)
+
+	// 重新打开后版本历史依然存在
+	reopened, err := NewFileVersionStore(versionPath)
+	require.NoError(t, err)
+	list, err := reopened.List("a1")
+	require.NoError(t, err)
+	require.Len(t, list, 3)
+	assert.Equal(t, "rollback to v1: 生成结果不理想", list[2].Reason)
+
+	// 新建的智能体从版本1开始，删除后历史一并删除
+	require.NoError(t, registry.Create(Agent{ID: "a2", Name: "历史学家"}))
+	created, err := registry.Get("a2")
+	require.NoError(t, err)
+	assert.Equal(t, 1, created.Version)
+	require.NoError(t, registry.Delete("a2"))
+	list, err = versionStore.List("a2")
+	require.NoError(t, err)
+	assert.Empty(t, list)
+	_, err = registry.Versions("a2")
+	assert.ErrorIs(t, err, ErrAgentNotFound)
+}
+
+func TestFileVersionStoreRollbackOnWriteFailure(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "data")
+	versions, err := NewFileVersionStore(filepath.Join(dir, "versions.json"))
+	require.NoError(t, err)
+	require.NoError(t, versions.Append("a1", &AgentVersion{Version: 1}))
+
+	// 存储目录被普通文件占据，之后的写入都会失败
+	require.NoError(t, os.RemoveAll(dir))
+	require.NoError(t, os.WriteFile(dir, nil, 0644))
+
+	assert.Error(t, versions.Append("a1", &AgentVersion{Version: 2}))
+	list, err := versions.List("a1")
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+	assert.Equal(t, 1, list[0].Version)
+}
+
+// failingVersionStore 模拟写入失败的版本历史存储
+type failingVersionStore struct {
+	VersionStore
+	err error
+}
+
+func (s failingVersionStore) Append(string, *AgentVersion) error { return s.err }
+
+func (s failingVersionStore) Delete(string) error { return s.err }
+
+func TestRegistryVersionWriteFailure(t *testing.T) {
+	agentStore := NewMemoryStore()
+	versions := NewMemoryVersionStore()
+	registry := NewRegistryWithVersions(agentStore, versions)
+	require.NoError(t, registry.Create(Agent{ID: "a1", Name: "经济学家", CoreTraits: "理性"}))
+
+	var events []ChangeEvent
+	registry.Subscribe(func(e ChangeEvent) { events = append(events, e) })
+	registry.versions = failingVersionStore{VersionStore: versions, err: errors.New("disk full")}
+
+	// 历史版本写入失败时，智能体恢复为修改前的内容
+	_, err := registry.Update("a1", func(agent *Agent) error {
+		agent.CoreTraits = "激进"
+		return nil
+	})
+	require.Error(t, err)
+	agent, err := registry.Get("a1")
+	require.NoError(t, err)
+	assert.Equal(t, "理性", agent.CoreTraits)
+	assert.Equal(t, 1, agent.Version)
+
+	// 新建失败时不留下没有历史的智能体
+	require.Error(t, registry.Create(Agent{ID: "a2", Name: "历史学家"}))
+	_, err = registry.Get("a2")
+	assert.ErrorIs(t, err, ErrAgentNotFound)
+
+	// 删除历史失败不影响删除结果，仍然发出删除通知
+	require.NoError(t, registry.Delete("a1"))
+	_, err = registry.Get("a1")
+	assert.ErrorIs(t, err, ErrAgentNotFound)
+	require.Len(t, events, 1)
+	assert.Equal(t, AgentDeleted, events[0].Type)
+	assert.Equal(t, "a1", events[0].Agent.ID)
+}
+
+// failingAgentStore 模拟写入失败的智能体存储
+type failingAgentStore struct {
+	AgentStore
+	err error
+}
+
+func (s failingAgentStore) Put(*Agent) error { return s.err }
+
+func TestRegistryBaselineUndoneOnStoreFailure(t *testing.T) {
+	agentStore := NewMemoryStore()
+	// 模拟启用版本历史之前已存在的智能体
+	require.NoError(t, agentStore.Put(&Agent{ID: "a1", Name: "经济学家", CoreTraits: "理性"}))
+	versions := NewMemoryVersionStore()
+	registry := NewRegistryWithVersions(failingAgentStore{AgentStore: agentStore, err: errors.New("disk full")}, versions)
+
+	// 智能体保存失败时撤销已记录的基线版本
+	_, err := registry.Update("a1", func(agent *Agent) error {
+		agent.CoreTraits = "激进"
+		return nil
+	})
+	require.Error(t, err)
+	list, err := versions.List("a1")
+	require.NoError(t, err)
+	assert.Empty(t, list)
+	agent, err := agentStore.Get("a1")
+	require.NoError(t, err)
+	assert.Equal(t, 0, agent.Version)
+
+	// 存储恢复后重新记录基线，版本号不重复
+	registry.store = agentStore
+	updated, err := registry.Update("a1", func(agent *Agent) error {
+		agent.CoreTraits = "激进"
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, updated.Version)
+	list, err = versions.List("a1")
+	require.NoError(t, err)
+	require.Len(t, list, 2)
+	assert.Equal(t, ReasonBaseline, list[0].Reason)
+	assert.Equal(t, 1, list[0].Version)
+	assert.Equal(t, 2, list[1].Version)
+}
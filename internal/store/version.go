@@ -0,0 +1,138 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"agent-forge/internal/config"
+)
+
+// ErrVersionNotFound 表示智能体的历史版本不存在
+var ErrVersionNotFound = errors.New("agent version not found")
+
+// ErrVersionConflict 表示调用方期望的版本与智能体的当前版本不一致
+var ErrVersionConflict = errors.New("agent version conflict")
+
+// 版本变更原因
+const (
+	ReasonCreated  = "created"
+	ReasonUpdated  = "updated"
+	ReasonImported = "imported"
+	// ReasonLibrary 由智能体库的人格文件加载或更新
+	ReasonLibrary = "library"
+	// ReasonDetached 智能体库的人格文件被删除或更换ID后，用户修改过的智能体与文件解除关联
+	ReasonDetached = "detached"
+	// ReasonBaseline 启用版本历史之前已存在的智能体，在首次修改前记录的基线版本
+	ReasonBaseline = "baseline"
+)
+
+// AgentVersion 智能体的一个历史版本，保存写入时的完整快照
+type AgentVersion struct {
+	Version   int    `json:"version"`
+	Reason    string `json:"reason"`
+	CreatedAt string `json:"created_at"`
+	Agent     Agent  `json:"agent"`
+}
+
+// Clone 返回版本的深拷贝
+func (v *AgentVersion) Clone() *AgentVersion {
+	if v == nil {
+		return nil
+	}
+	c := *v
+	c.Agent = *v.Agent.Clone()
+	return &c
+}
+
+// VersionStore 智能体版本历史存储接口
+type VersionStore interface {
+	// List 按版本号升序列出智能体的所有历史版本，没有历史时返回空列表
+	List(agentID string) ([]*AgentVersion, error)
+	// Append 追加一个历史版本
+	Append(agentID string, version *AgentVersion) error
+	// Delete 删除智能体的全部历史版本
+	Delete(agentID string) error
+}
+
+// NewVersionStore 根据配置创建版本历史存储，与智能体存储使用相同的后端
+func NewVersionStore(cfg config.StoreConfig) (VersionStore, error) {
+	switch cfg.Backend {
+	case "", "memory":
+		return NewMemoryVersionStore(), nil
+	case "file":
+		return NewFileVersionStore(cfg.VersionPath)
+	default:
+		return nil, fmt.Errorf("不支持的存储后端: %s", cfg.Backend)
+	}
+}
+
+// versionMap 基于 mapStore 的版本历史存储实现，内存存储与文件存储共用
+type versionMap struct {
+	items *mapStore[[]*AgentVersion]
+}
+
+// List 列出智能体的历史版本副本
+func (s versionMap) List(agentID string) ([]*AgentVersion, error) {
+	versions, ok := s.items.get(agentID)
+	if !ok {
+		return []*AgentVersion{}, nil
+	}
+	return versions, nil
+}
+
+// Append 追加历史版本副本
+func (s versionMap) Append(agentID string, version *AgentVersion) error {
+	if agentID == "" || version == nil {
+		return errors.New("agent id and version are required")
+	}
+	return s.items.update(agentID, func(prev []*AgentVersion, _ bool) []*AgentVersion {
+		// 限制容量，避免追加时改动存储中的原切片
+		return append(prev[:len(prev):len(prev)], version)
+	})
+}
+
+// Delete 删除智能体的全部历史版本，没有历史时不报错
+func (s versionMap) Delete(agentID string) error {
+	_, err := s.items.remove(agentID)
+	return err
+}
+
+// MemoryVersionStore 基于内存的版本历史存储
+type MemoryVersionStore struct {
+	versionMap
+}
+
+// NewMemoryVersionStore 创建内存版本历史存储
+func NewMemoryVersionStore() *MemoryVersionStore {
+	return &MemoryVersionStore{versionMap{newMapStore(cloneVersions)}}
+}
+
+// FileVersionStore 基于JSON文件的版本历史存储
+type FileVersionStore struct {
+	versionMap
+}
+
+// NewFileVersionStore 打开（或初始化）指定路径的版本历史文件存储
+func NewFileVersionStore(path string) (*FileVersionStore, error) {
+	if path == "" {
+		return nil, errors.New("版本历史存储路径不能为空")
+	}
+	items, err := openMapStore(path, "versions", cloneVersions)
+	if err != nil {
+		return nil, err
+	}
+	return &FileVersionStore{versionMap{items}}, nil
+}
+
+// cloneVersions 按版本号升序返回历史版本副本
+func cloneVersions(versions []*AgentVersion) []*AgentVersion {
+	list := make([]*AgentVersion, 0, len(versions))
+	for _, v := range versions {
+		list = append(list, v.Clone())
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Version < list[j].Version
+	})
+	return list
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+
+	"agent-forge/internal/logger"
+	"agent-forge/internal/store"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/google/uuid"
+	"go.uber.org/zap"
+)
+
+// librarySourcePrefix 由智能体库加载的智能体的来源前缀
+const librarySourcePrefix = "library:"
+
+// libraryReloadDelay 文件变化后延迟重新加载的时间，合并编辑器保存时产生的多次事件
+const libraryReloadDelay = 200 * time.Millisecond
+
+// libraryNamespace 根据文件名生成稳定智能体ID时使用的命名空间
+var libraryNamespace = uuid.NewSHA1(uuid.NameSpaceURL, []byte("agent-forge:library"))
+
+// agentLibrary 从目录加载预置的智能体人格文件，并与注册表保持同步
+// 只会覆盖由智能体库加载、且加载后没有被修改过的智能体，文件删除后对应的智能体也会被删除，
+// 加载后被修改过的智能体则保留下来并与文件解除关联；
+// 与其他来源（如用户创建）的智能体ID相同或重名时跳过该文件，不会覆盖用户的智能体
+type agentLibrary struct {
+	dir string
+	mu  sync.Mutex
+}
+
+// loadAgentLibrary 加载智能体库目录中的人格文件
+func loadAgentLibrary(dir string) (*agentLibrary, error) {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return nil, fmt.Errorf("open agent library failed: %v", err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("agent library %s is not a directory", dir)
+	}
+
+	l := &agentLibrary{dir: dir}
+	if err := l.sync(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// isLibraryFile 判断文件是否为人格文件，忽略隐藏文件（如编辑器的临时文件）
+func isLibraryFile(name string) bool {
+	base := filepath.Base(name)
+	if strings.HasPrefix(base, ".") {
+		return false
+	}
+	switch strings.ToLower(filepath.Ext(base)) {
+	case ".yaml", ".yml", ".json":
+		return true
+	}
+	return false
+}
+
+// loadLibraryFile 解析并校验单个人格文件
+// 未提供人格描述时由结构化人格渲染生成
+func loadLibraryFile(path string) (Agent, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Agent{}, err
+	}
+	agent, err := store.UnmarshalPersonaFile(data)
+	if err != nil {
+		return Agent{}, err
+	}
+
+	if agent.Persona != nil {
+		if agent.CoreTraits == "" {
+			agent.CoreTraits = strings.Join(agent.Persona.Traits, "、")
+		}
+		if agent.Personality == "" {
+			agent.Personality = renderPersona(agent.Persona)
+		}
+	}
+	if strings.TrimSpace(agent.Personality) == "" {
+		return Agent{}, fmt.Errorf("agent %s has neither persona nor personality", agent.Name)
+	}
+	agent.Source = librarySourcePrefix + filepath.Base(path)
+	return *agent, nil
+}
+
+// sync 重新加载目录中的所有人格文件并同步到注册表
+// 解析失败的文件保留上一次加载的版本，不会删除对应的智能体
+func (l *agentLibrary) sync() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	log := logger.GetLogger()
+
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		return fmt.Errorf("read agent library failed: %v", err)
+	}
+
+	loaded := make(map[string]Agent)
+	failed := make(map[string]bool)
+	ids := make(map[string]string)
+	names := make(map[string]string)
+	for _, entry := range entries {
+		if entry.IsDir() || !isLibraryFile(entry.Name()) {
+			continue
+		}
+		source := librarySourcePrefix + entry.Name()
+		agent, err := loadLibraryFile(filepath.Join(l.dir, entry.Name()))
+		if err == nil {
+			if other, ok := ids[agent.ID]; ok && agent.ID != "" {
+				err = fmt.Errorf("agent id %s is already defined in %s", agent.ID, other)
+			} else if other, ok := names[agent.Name]; ok {
+				err = fmt.Errorf("agent name %s is already defined in %s", agent.Name, other)
+			}
+		}
+		if err != nil {
+			log.Warn("跳过无效的人格文件", zap.String("file", entry.Name()), zap.Error(err))
+			failed[source] = true
+			continue
+		}
+		ids[agent.ID] = entry.Name()
+		names[agent.Name] = entry.Name()
+		loaded[source] = agent
+	}
+
+	list, err := agents.List()
+	if err != nil {
+		return fmt.Errorf("load agents failed: %v", err)
+	}
+	previous := make(map[string]Agent)
+	for _, agent := range list {
+		if strings.HasPrefix(agent.Source, librarySourcePrefix) {
+			previous[agent.Source] = agent
+		}
+	}
+
+	// 移除文件已被删除的智能体
+	released := false
+	for source, agent := range previous {
+		if _, ok := loaded[source]; ok || failed[source] {
+			continue
+		}
+		releaseLibraryAgent(agent)
+		released = true
+	}
+	if released {
+		// 解除关联的智能体成为普通智能体，后续的ID和重名检查需要以最新的注册表为准
+		if list, err = agents.List(); err != nil {
+			return fmt.Errorf("load agents failed: %v", err)
+		}
+	}
+
+	for source, agent := range loaded {
+		prev, ok := previous[source]
+		// 文件未指定ID时沿用已加载的ID，首次加载时根据文件名生成稳定的ID
+		if agent.ID == "" {
+			if ok {
+				agent.ID = prev.ID
+			} else {
+				agent.ID = uuid.NewSHA1(libraryNamespace, []byte(source)).String()
+			}
+		}
+		if ok && prev.ID != agent.ID {
+			// 文件中的ID发生变化，移除旧的智能体后按新ID重新加载
+			releaseLibraryAgent(prev)
+			if list, err = agents.List(); err != nil {
+				return fmt.Errorf("load agents failed: %v", err)
+			}
+			ok = false
+		}
+		if clash := libraryNameClash(list, agent, source); clash != nil {
+			log.Warn("人格文件中的智能体与已有智能体重名，跳过",
+				zap.String("source", source),
+				zap.String("name", agent.Name),
+				zap.String("agent_id", clash.ID))
+			continue
+		}
+		if agent.CreatedAt == "" {
+			if ok {
+				agent.CreatedAt = prev.CreatedAt
+			} else {
+				agent.CreatedAt = time.Now().Format(time.RFC3339)
+			}
+		}
+		if ok {
+			agent.Version = prev.Version
+		}
+		if ok && reflect.DeepEqual(prev, agent) {
+			continue
+		}
+		if existing, exists := findAgent(list, agent.ID); exists {
+			if !strings.HasPrefix(existing.Source, librarySourcePrefix) {
+				log.Warn("人格文件中的智能体ID属于其他来源的智能体，跳过",
+					zap.String("source", source),
+					zap.String("agent_id", agent.ID))
+				continue
+			}
+			if libraryAgentEdited(existing) {
+				log.Info("智能体库中的智能体加载后已被修改，不再由文件覆盖",
+					zap.String("source", source),
+					zap.String("agent_id", agent.ID),
+					zap.Int("version", existing.Version))
+				continue
+			}
+		}
+
+		saved, replaced, err := agents.ImportWithReason(agent, store.ConflictReplace, func() string { return uuid.New().String() }, store.ReasonLibrary)
+		if err != nil {
+			log.Warn("加载人格文件失败", zap.String("source", source), zap.Error(err))
+			continue
+		}
+		log.Info("智能体库加载智能体",
+			zap.String("agent_id", saved.ID),
+			zap.String("name", saved.Name),
+			zap.String("source", source),
+			zap.Bool("replaced", replaced))
+	}
+	return nil
+}
+
+// releaseLibraryAgent 智能体不再对应任何人格文件时调用
+// 未被修改过的智能体直接删除；用户修改过的智能体保留其内容和版本历史，清除来源后成为普通智能体
+func releaseLibraryAgent(agent Agent) {
+	log := logger.GetLogger()
+	if libraryAgentEdited(agent) {
+		if _, err := agents.UpdateWithReason(agent.ID, store.ReasonDetached, func(a *Agent) error {
+			a.Source = ""
+			return nil
+		}); err != nil {
+			log.Warn("智能体与智能体库解除关联失败", zap.String("agent_id", agent.ID), zap.Error(err))
+			return
+		}
+		log.Info("智能体库中的智能体已被修改，保留并解除与文件的关联",
+			zap.String("agent_id", agent.ID),
+			zap.String("source", agent.Source))
+		return
+	}
+	if err := agents.Delete(agent.ID); err != nil {
+		log.Warn("删除智能体库中的智能体失败", zap.String("agent_id", agent.ID), zap.Error(err))
+		return
+	}
+	log.Info("智能体库移除智能体", zap.String("agent_id", agent.ID), zap.String("source", agent.Source))
+}
+
+// findAgent 按ID查找智能体
+func findAgent(list []Agent, id string) (Agent, bool) {
+	for _, agent := range list {
+		if agent.ID == id {
+			return agent, true
+		}
+	}
+	return Agent{}, false
+}
+
+// libraryAgentEdited 判断智能体库加载的智能体是否在加载后被修改过（更新、回滚或导入）
+// 当前版本不是由智能体库写入、或无法确认时都视为已修改，避免文件覆盖用户的修改
+func libraryAgentEdited(agent Agent) bool {
+	version, err := agents.Version(agent.ID, agent.Version)
+	if err != nil {
+		return true
+	}
+	return version.Reason != store.ReasonLibrary
+}
+
+// libraryNameClash 返回与库中智能体同名、但既不由该文件加载也不是同一ID的已有智能体
+// 注册表导入时会按名称匹配冲突，不先排除这类智能体会覆盖用户创建的同名智能体
+func libraryNameClash(list []Agent, agent Agent, source string) *Agent {
+	for i, existing := range list {
+		if existing.Name == agent.Name && existing.ID != agent.ID && existing.Source != source {
+			return &list[i]
+		}
+	}
+	return nil
+}
+
+// watch 监听目录变化并在文件变化后重新加载，返回停止监听的函数
+func (l *agentLibrary) watch() (func() error, error) {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return nil, fmt.Errorf("create watcher failed: %v", err)
+	}
+	if err := watcher.Add(l.dir); err != nil {
+		watcher.Close()
+		return nil, fmt.Errorf("watch agent library failed: %v", err)
+	}
+
+	log := logger.GetLogger()
+	reload := time.AfterFunc(time.Hour, func() {
+		if err := l.sync(); err != nil {
+			log.Error("重新加载智能体库失败", zap.Error(err))
+		}
+	})
+	reload.Stop()
+
+	go func() {
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					reload.Stop()
+					return
+				}
+				if isLibraryFile(event.Name) {
+					reload.Reset(libraryReloadDelay)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				log.Warn("监听智能体库失败", zap.Error(err))
+			}
+		}
+	}()
+	return watcher.Close, nil
+}
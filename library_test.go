@@ -0,0 +1,264 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"agent-forge/internal/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const libraryEconomist = `kind: agent-forge/persona
+version: 1
+agent:
+  name: 经济学家
+  persona:
+    expertise_domains: [宏观经济]
+    traits: [理性, 审慎]
+    speaking_style: 言简意赅
+`
+
+const libraryHistorian = `{
+  "kind": "agent-forge/persona",
+  "version": 1,
+  "agent": {"id": "historian", "name": "历史学家", "core_traits": "博学", "personality": "熟悉各朝代的兴衰"}
+}
+`
+
+// findLibraryAgent 按名称查找智能体
+func findLibraryAgent(t *testing.T, name string) (Agent, bool) {
+	list, err := agents.List()
+	require.NoError(t, err)
+	for _, agent := range list {
+		if agent.Name == name {
+			return agent, true
+		}
+	}
+	return Agent{}, false
+}
+
+func TestAgentLibrary(t *testing.T) {
+	agents = store.NewRegistry(store.NewMemoryStore())
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "economist.yaml"), []byte(libraryEconomist), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "historian.json"), []byte(libraryHistorian), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "broken.yaml"), []byte("kind: other\n"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "README.md"), []byte("# 智能体库\n"), 0o644))
+
+	library, err := loadAgentLibrary(dir)
+	require.NoError(t, err)
+
+	list, err := agents.List()
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	economist, ok := findLibraryAgent(t, "经济学家")
+	require.True(t, ok)
+	assert.Equal(t, "理性、审慎", economist.CoreTraits)
+	assert.Contains(t, economist.Personality, "宏观经济")
+	assert.Equal(t, "library:economist.yaml", economist.Source)
+
+	historian, err := agents.Get("historian")
+	require.NoError(t, err)
+	assert.Equal(t, "熟悉各朝代的兴衰", historian.Personality)
+
+	// 重复加载时ID保持不变
+	require.NoError(t, library.sync())
+	reloaded, ok := findLibraryAgent(t, "经济学家")
+	require.True(t, ok)
+	assert.Equal(t, economist.ID, reloaded.ID)
+	assert.Equal(t, economist.CreatedAt, reloaded.CreatedAt)
+
+	// 文件变为无效时保留上一次加载的版本
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "economist.yaml"), []byte("kind: ["), 0o644))
+	require.NoError(t, library.sync())
+	_, ok = findLibraryAgent(t, "经济学家")
+	assert.True(t, ok)
+
+	// 删除文件后对应的智能体也被删除
+	require.NoError(t, os.Remove(filepath.Join(dir, "historian.json")))
+	require.NoError(t, library.sync())
+	_, err = agents.Get("historian")
+	assert.ErrorIs(t, err, store.ErrAgentNotFound)
+
+	// 通过工具导出的智能体不携带来源
+	data, err := exportAgent(economist.ID, store.FormatJSON)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "library:")
+}
+
+func TestAgentLibraryKeepsUserAgentWithSameName(t *testing.T) {
+	agents = store.NewRegistry(store.NewMemoryStore())
+	require.NoError(t, agents.Create(Agent{ID: "mine", Name: "经济学家", CoreTraits: "乐观", Personality: "用户自己锻造的经济学家"}))
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "economist.yaml"), []byte(libraryEconomist), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "historian.json"), []byte(libraryHistorian), 0o644))
+	library, err := loadAgentLibrary(dir)
+	require.NoError(t, err)
+
+	// 同名的用户智能体不被覆盖，库中的其他智能体照常加载
+	mine, err := agents.Get("mine")
+	require.NoError(t, err)
+	assert.Equal(t, "用户自己锻造的经济学家", mine.Personality)
+	assert.Empty(t, mine.Source)
+	list, err := agents.List()
+	require.NoError(t, err)
+	assert.Len(t, list, 2)
+
+	// 删除库文件也不会删除用户的智能体
+	require.NoError(t, os.Remove(filepath.Join(dir, "economist.yaml")))
+	require.NoError(t, library.sync())
+	_, err = agents.Get("mine")
+	require.NoError(t, err)
+	versions, err := agents.Versions("mine")
+	require.NoError(t, err)
+	assert.Len(t, versions, 1)
+}
+
+func TestAgentLibraryKeepsUserAgentWithSameID(t *testing.T) {
+	agents = store.NewRegistry(store.NewMemoryStore())
+	require.NoError(t, agents.Create(Agent{ID: "historian", Name: "我的历史学家", Personality: "用户自己锻造的历史学家"}))
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "historian.json"), []byte(libraryHistorian), 0o644))
+	_, err := loadAgentLibrary(dir)
+	require.NoError(t, err)
+
+	// 文件中的ID属于用户的智能体时跳过该文件
+	mine, err := agents.Get("historian")
+	require.NoError(t, err)
+	assert.Equal(t, "用户自己锻造的历史学家", mine.Personality)
+	assert.Empty(t, mine.Source)
+	assert.Equal(t, 1, mine.Version)
+}
+
+func TestAgentLibraryKeepsUserEdits(t *testing.T) {
+	agents = store.NewRegistry(store.NewMemoryStore())
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "economist.yaml"), []byte(libraryEconomist), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "historian.json"), []byte(libraryHistorian), 0o644))
+	library, err := loadAgentLibrary(dir)
+	require.NoError(t, err)
+
+	versions, err := agents.Versions("historian")
+	require.NoError(t, err)
+	require.Len(t, versions, 1)
+	assert.Equal(t, store.ReasonLibrary, versions[0].Reason)
+
+	_, err = agents.Update("historian", func(agent *Agent) error {
+		agent.Personality = "用户修改后的人格"
+		return nil
+	})
+	require.NoError(t, err)
+
+	// 文件变化后，未被修改的智能体照常更新，用户修改过的智能体保持不变
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "economist.yaml"), []byte(strings.Replace(libraryEconomist, "言简意赅", "娓娓道来", 1)), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "historian.json"), []byte(strings.Replace(libraryHistorian, "熟悉各朝代的兴衰", "新的人格", 1)), 0o644))
+	require.NoError(t, library.sync())
+
+	economist, ok := findLibraryAgent(t, "经济学家")
+	require.True(t, ok)
+	assert.Contains(t, economist.Personality, "娓娓道来")
+	assert.Equal(t, 2, economist.Version)
+
+	historian, err := agents.Get("historian")
+	require.NoError(t, err)
+	assert.Equal(t, "用户修改后的人格", historian.Personality)
+	assert.Equal(t, 2, historian.Version)
+
+	// 删除文件后，用户修改过的智能体及其版本历史保留下来，并与文件解除关联
+	require.NoError(t, os.Remove(filepath.Join(dir, "historian.json")))
+	require.NoError(t, library.sync())
+
+	historian, err = agents.Get("historian")
+	require.NoError(t, err)
+	assert.Equal(t, "用户修改后的人格", historian.Personality)
+	assert.Empty(t, historian.Source)
+	versions, err = agents.Versions("historian")
+	require.NoError(t, err)
+	require.Len(t, versions, 3)
+	assert.Equal(t, store.ReasonUpdated, versions[1].Reason)
+	assert.Equal(t, store.ReasonDetached, versions[2].Reason)
+
+	// 重新添加文件时，同ID的智能体已不属于智能体库，文件被跳过
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "historian.json"), []byte(libraryHistorian), 0o644))
+	require.NoError(t, library.sync())
+	historian, err = agents.Get("historian")
+	require.NoError(t, err)
+	assert.Equal(t, "用户修改后的人格", historian.Personality)
+	assert.Equal(t, 3, historian.Version)
+}
+
+func TestAgentLibraryKeepsUserEditsWhenIDChanges(t *testing.T) {
+	agents = store.NewRegistry(store.NewMemoryStore())
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "historian.json"), []byte(libraryHistorian), 0o644))
+	library, err := loadAgentLibrary(dir)
+	require.NoError(t, err)
+
+	_, err = agents.Update("historian", func(agent *Agent) error {
+		agent.Personality = "用户修改后的人格"
+		return nil
+	})
+	require.NoError(t, err)
+
+	// 文件中的ID变化后，用户修改过的旧智能体保留并解除关联，新ID作为新的智能体加载
+	renumbered := strings.Replace(libraryHistorian, `"id": "historian"`, `"id": "historian-v2"`, 1)
+	renumbered = strings.Replace(renumbered, `"name": "历史学家"`, `"name": "史学家"`, 1)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "historian.json"), []byte(renumbered), 0o644))
+	require.NoError(t, library.sync())
+
+	old, err := agents.Get("historian")
+	require.NoError(t, err)
+	assert.Equal(t, "用户修改后的人格", old.Personality)
+	assert.Empty(t, old.Source)
+	assert.Equal(t, 3, old.Version)
+
+	fresh, err := agents.Get("historian-v2")
+	require.NoError(t, err)
+	assert.Equal(t, "熟悉各朝代的兴衰", fresh.Personality)
+	assert.Equal(t, "library:historian.json", fresh.Source)
+	assert.Equal(t, 1, fresh.Version)
+
+	// 未被修改过的智能体在ID变化后直接删除
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "historian.json"), []byte(strings.Replace(renumbered, "historian-v2", "historian-v3", 1)), 0o644))
+	require.NoError(t, library.sync())
+	_, err = agents.Get("historian-v2")
+	assert.ErrorIs(t, err, store.ErrAgentNotFound)
+	_, err = agents.Get("historian-v3")
+	assert.NoError(t, err)
+}
+
+func TestAgentLibraryRejectsMissingDir(t *testing.T) {
+	_, err := loadAgentLibrary(filepath.Join(t.TempDir(), "missing"))
+	assert.Error(t, err)
+}
+
+func TestAgentLibraryWatch(t *testing.T) {
+	agents = store.NewRegistry(store.NewMemoryStore())
+	dir := t.TempDir()
+
+	library, err := loadAgentLibrary(dir)
+	require.NoError(t, err)
+	stop, err := library.watch()
+	require.NoError(t, err)
+	defer stop()
+
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "historian.json"), []byte(libraryHistorian), 0o644))
+	require.Eventually(t, func() bool {
+		_, err := agents.Get("historian")
+		return err == nil
+	}, 5*time.Second, 50*time.Millisecond)
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "historian.json")))
+	require.Eventually(t, func() bool {
+		_, err := agents.Get("historian")
+		return err != nil
+	}, 5*time.Second, 50*time.Millisecond)
+}
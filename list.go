@@ -0,0 +1,337 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// list_agents 的排序字段与顺序
+const (
+	listSortCreatedAt = "created_at"
+	listSortName      = "name"
+	listOrderAsc      = "asc"
+	listOrderDesc     = "desc"
+)
+
+// 分页大小
+const (
+	defaultListLimit = 50
+	maxListLimit     = 200
+)
+
+// summaryFields fields 中 summary 展开后的字段，也是未指定 fields 时返回的字段
+// 完整的人格描述通常很长，一次列出几十个智能体会占满宿主的上下文，需要时通过 fields 或 get_agent 获取
+var summaryFields = []string{"id", "name", "core_traits", "tags", "created_at", "version"}
+
+// listFieldsAll fields 中表示返回全部字段的取值
+const listFieldsAll = "all"
+
+// agentFields 可以通过 fields 选择的字段
+var agentFields = map[string]bool{
+	"id": true, "name": true, "core_traits": true, "personality": true, "tags": true,
+	"created_at": true, "version": true, "persona": true, "source": true,
+	"model": true, "temperature": true, "top_p": true, "max_tokens": true, "seed": true,
+}
+
+// listCursor 分页游标，记录上一页最后一个智能体的排序键，与排序方式绑定
+type listCursor struct {
+	Sort  string `json:"s"`
+	Order string `json:"o"`
+	Key   string `json:"k"`
+	ID    string `json:"id"`
+}
+
+// agentQuery list_agents 的查询条件
+type agentQuery struct {
+	name          string
+	trait         string
+	tag           string
+	createdAfter  time.Time
+	createdBefore time.Time
+	sort          string
+	order         string
+	limit         int
+	cursor        *listCursor
+	fields        []string // 为空表示返回完整的智能体
+}
+
+// parseAgentQuery 解析并校验 list_agents 的参数
+func parseAgentQuery(args map[string]interface{}) (agentQuery, error) {
+	q := agentQuery{sort: listSortCreatedAt, order: listOrderAsc, limit: defaultListLimit}
+
+	for key, dst := range map[string]*string{"name": &q.name, "trait": &q.trait, "tag": &q.tag} {
+		if v, ok := args[key]; ok {
+			s, ok := v.(string)
+			if !ok {
+				return q, fmt.Errorf("%s must be a string", key)
+			}
+			*dst = strings.TrimSpace(s)
+		}
+	}
+
+	for key, dst := range map[string]*time.Time{"created_after": &q.createdAfter, "created_before": &q.createdBefore} {
+		if v, ok := args[key]; ok {
+			s, _ := v.(string)
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				return q, fmt.Errorf("%s must be an RFC3339 timestamp", key)
+			}
+			*dst = t
+		}
+	}
+
+	if v, ok := args["sort"]; ok {
+		s, _ := v.(string)
+		if s != listSortCreatedAt && s != listSortName {
+			return q, fmt.Errorf("sort must be %s or %s", listSortCreatedAt, listSortName)
+		}
+		q.sort = s
+	}
+	if v, ok := args["order"]; ok {
+		s, _ := v.(string)
+		if s != listOrderAsc && s != listOrderDesc {
+			return q, fmt.Errorf("order must be %s or %s", listOrderAsc, listOrderDesc)
+		}
+		q.order = s
+	}
+
+	if v, ok := args["limit"]; ok {
+		n, ok := v.(float64)
+		if !ok || n < 1 || n > maxListLimit || n != math.Trunc(n) {
+			return q, fmt.Errorf("limit must be an integer between 1 and %d", maxListLimit)
+		}
+		q.limit = int(n)
+	}
+
+	if v, ok := args["cursor"]; ok {
+		s, _ := v.(string)
+		if s != "" {
+			cursor, err := decodeListCursor(s)
+			if err != nil {
+				return q, err
+			}
+			if cursor.Sort != q.sort || cursor.Order != q.order {
+				return q, errors.New("cursor does not match the requested sort and order")
+			}
+			q.cursor = cursor
+		}
+	}
+
+	fields, err := stringSliceArg(args, "fields")
+	if err != nil {
+		return q, err
+	}
+	if len(fields) == 0 {
+		q.fields = summaryFields
+		return q, nil
+	}
+	for _, field := range fields {
+		if field == listFieldsAll {
+			q.fields = nil
+			return q, nil
+		}
+		if field == "summary" {
+			q.fields = append(q.fields, summaryFields...)
+			continue
+		}
+		if !agentFields[field] {
+			return q, fmt.Errorf("unknown field: %s", field)
+		}
+		q.fields = append(q.fields, field)
+	}
+	return q, nil
+}
+
+// encodeListCursor 将游标编码为不透明的字符串
+func encodeListCursor(c listCursor) string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeListCursor 解析游标字符串
+func decodeListCursor(s string) (*listCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errors.New("invalid cursor")
+	}
+	var c listCursor
+	if err := json.Unmarshal(data, &c); err != nil || c.ID == "" {
+		return nil, errors.New("invalid cursor")
+	}
+	return &c, nil
+}
+
+// containsFold 不区分大小写的子串匹配
+func containsFold(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+// match 判断智能体是否满足筛选条件
+func (q agentQuery) match(agent Agent) bool {
+	if q.name != "" && !containsFold(agent.Name, q.name) {
+		return false
+	}
+	if q.trait != "" {
+		traits := agent.CoreTraits
+		if agent.Persona != nil {
+			traits += "\n" + strings.Join(agent.Persona.Traits, "\n")
+		}
+		if !containsFold(traits, q.trait) {
+			return false
+		}
+	}
+	if q.tag != "" {
+		found := false
+		for _, tag := range agent.Tags {
+			if strings.EqualFold(tag, q.tag) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if !q.createdAfter.IsZero() || !q.createdBefore.IsZero() {
+		created, err := time.Parse(time.RFC3339, agent.CreatedAt)
+		if err != nil {
+			return false
+		}
+		if !q.createdAfter.IsZero() && created.Before(q.createdAfter) {
+			return false
+		}
+		if !q.createdBefore.IsZero() && !created.Before(q.createdBefore) {
+			return false
+		}
+	}
+	return true
+}
+
+// sortKeyTimeLayout 创建时间排序键的格式：统一转换为 UTC 并固定宽度，字符串顺序与时间顺序一致
+const sortKeyTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+// sortKey 返回智能体在当前排序方式下的排序键
+// 导入或智能体库中的创建时间可能带有不同的时区偏移，按字符串比较会得到错误的顺序，因此先换算为 UTC
+func (q agentQuery) sortKey(agent Agent) string {
+	if q.sort == listSortName {
+		return agent.Name
+	}
+	created, err := time.Parse(time.RFC3339, agent.CreatedAt)
+	if err != nil {
+		return agent.CreatedAt
+	}
+	return created.UTC().Format(sortKeyTimeLayout)
+}
+
+// less 比较两个排序位置，排序键相同时按ID排序，保证顺序稳定
+func (q agentQuery) less(keyA, idA, keyB, idB string) bool {
+	if keyA != keyB {
+		if q.order == listOrderDesc {
+			return keyA > keyB
+		}
+		return keyA < keyB
+	}
+	if q.order == listOrderDesc {
+		return idA > idB
+	}
+	return idA < idB
+}
+
+// run 筛选、排序并分页，返回当前页、满足条件的总数以及下一页的游标
+func (q agentQuery) run(list []Agent) ([]Agent, int, string) {
+	matched := make([]Agent, 0, len(list))
+	for _, agent := range list {
+		if q.match(agent) {
+			matched = append(matched, agent)
+		}
+	}
+	sort.Slice(matched, func(i, j int) bool {
+		return q.less(q.sortKey(matched[i]), matched[i].ID, q.sortKey(matched[j]), matched[j].ID)
+	})
+
+	start := 0
+	if q.cursor != nil {
+		start = sort.Search(len(matched), func(i int) bool {
+			return q.less(q.cursor.Key, q.cursor.ID, q.sortKey(matched[i]), matched[i].ID)
+		})
+	}
+	end := min(start+q.limit, len(matched))
+	page := matched[start:end]
+
+	nextCursor := ""
+	if end < len(matched) {
+		last := page[len(page)-1]
+		nextCursor = encodeListCursor(listCursor{Sort: q.sort, Order: q.order, Key: q.sortKey(last), ID: last.ID})
+	}
+	return page, len(matched), nextCursor
+}
+
+// project 只保留 fields 中指定的字段，fields 为 all 时返回完整的智能体
+func (q agentQuery) project(page []Agent) (interface{}, error) {
+	if len(q.fields) == 0 {
+		return page, nil
+	}
+
+	projected := make([]map[string]interface{}, 0, len(page))
+	for _, agent := range page {
+		data, err := json.Marshal(agent)
+		if err != nil {
+			return nil, err
+		}
+		var full map[string]interface{}
+		if err := json.Unmarshal(data, &full); err != nil {
+			return nil, err
+		}
+		item := map[string]interface{}{"id": agent.ID}
+		for _, field := range q.fields {
+			if v, ok := full[field]; ok {
+				item[field] = v
+			}
+		}
+		projected = append(projected, item)
+	}
+	return projected, nil
+}
+
+// 查询智能体处理函数
+func listAgentsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	query, err := parseAgentQuery(request.GetArguments())
+	if err != nil {
+		return nil, err
+	}
+
+	agentList, err := agents.List()
+	if err != nil {
+		return nil, fmt.Errorf("list agents failed: %v", err)
+	}
+
+	page, total, nextCursor := query.run(agentList)
+	items, err := query.project(page)
+	if err != nil {
+		return nil, fmt.Errorf("marshal response failed: %v", err)
+	}
+
+	result := map[string]interface{}{
+		"agents": items,
+		"total":  total,
+	}
+	if nextCursor != "" {
+		result["next_cursor"] = nextCursor
+	}
+
+	jsonResponse, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("marshal response failed: %v", err)
+	}
+
+	return mcp.NewToolResultText(string(jsonResponse)), nil
+}
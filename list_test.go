@@ -0,0 +1,148 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"agent-forge/internal/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listAgentNames 调用 list_agents 并返回结果中的名称与下一页游标
+func listAgentNames(t *testing.T, args map[string]interface{}) ([]string, string) {
+	t.Helper()
+	result, err := listAgentsHandler(context.Background(), newToolRequest("list_agents", args))
+	require.NoError(t, err)
+	data := toolResultJSON(t, result)
+
+	var names []string
+	for _, item := range data["agents"].([]interface{}) {
+		names = append(names, item.(map[string]interface{})["name"].(string))
+	}
+	cursor, _ := data["next_cursor"].(string)
+	return names, cursor
+}
+
+func TestListAgentsQuery(t *testing.T) {
+	agents = store.NewRegistry(store.NewMemoryStore())
+	for _, agent := range []Agent{
+		{ID: "a1", Name: "Economist", CoreTraits: "理性", Tags: []string{"finance"}, CreatedAt: "2026-01-01T00:00:00Z"},
+		{ID: "a2", Name: "历史学家", CoreTraits: "博学", Tags: []string{"humanities"}, CreatedAt: "2026-02-01T00:00:00Z"},
+		{ID: "a3", Name: "投资人", CoreTraits: "激进", Tags: []string{"Finance"}, CreatedAt: "2026-03-01T00:00:00Z",
+			Persona: &Persona{ExpertiseDomains: []string{"投资"}, Traits: []string{"理性", "果断"}, SpeakingStyle: "直接"}},
+		{ID: "a4", Name: "社会学家", CoreTraits: "敏锐", CreatedAt: "2026-03-01T00:00:00Z"},
+	} {
+		require.NoError(t, agents.Create(agent))
+	}
+
+	names, _ := listAgentNames(t, nil)
+	assert.Equal(t, []string{"Economist", "历史学家", "投资人", "社会学家"}, names)
+
+	names, _ = listAgentNames(t, map[string]interface{}{"name": "economist"})
+	assert.Equal(t, []string{"Economist"}, names)
+
+	// 特质同时匹配核心特质与结构化人格中的特质
+	names, _ = listAgentNames(t, map[string]interface{}{"trait": "理性"})
+	assert.Equal(t, []string{"Economist", "投资人"}, names)
+
+	names, _ = listAgentNames(t, map[string]interface{}{"tag": "finance", "order": "desc"})
+	assert.Equal(t, []string{"投资人", "Economist"}, names)
+
+	names, _ = listAgentNames(t, map[string]interface{}{
+		"created_after":  "2026-02-01T00:00:00Z",
+		"created_before": "2026-03-01T00:00:00Z",
+	})
+	assert.Equal(t, []string{"历史学家"}, names)
+
+	// 游标分页覆盖所有结果且不重复，创建时间相同的智能体按ID排序
+	var all []string
+	cursor := ""
+	for {
+		args := map[string]interface{}{"limit": float64(3)}
+		if cursor != "" {
+			args["cursor"] = cursor
+		}
+		names, cursor = listAgentNames(t, args)
+		all = append(all, names...)
+		if cursor == "" {
+			break
+		}
+	}
+	assert.Equal(t, []string{"Economist", "历史学家", "投资人", "社会学家"}, all)
+
+	// 分页期间新增的智能体不会导致重复
+	names, cursor = listAgentNames(t, map[string]interface{}{"sort": "name", "limit": float64(2)})
+	assert.Equal(t, []string{"Economist", "历史学家"}, names)
+	require.NoError(t, agents.Create(Agent{ID: "a0", Name: "AAA", CreatedAt: "2026-04-01T00:00:00Z"}))
+	names, _ = listAgentNames(t, map[string]interface{}{"sort": "name", "limit": float64(2), "cursor": cursor})
+	assert.Equal(t, []string{"投资人", "社会学家"}, names)
+
+	// 游标与排序方式不一致时报错
+	_, err := listAgentsHandler(context.Background(), newToolRequest("list_agents", map[string]interface{}{"cursor": cursor}))
+	assert.Error(t, err)
+
+	result, err := listAgentsHandler(context.Background(), newToolRequest("list_agents", map[string]interface{}{
+		"fields": []interface{}{"summary"},
+		"limit":  float64(1),
+	}))
+	require.NoError(t, err)
+	data := toolResultJSON(t, result)
+	assert.Equal(t, float64(5), data["total"])
+	item := data["agents"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "a1", item["id"])
+	assert.Equal(t, []interface{}{"finance"}, item["tags"])
+	assert.NotContains(t, item, "personality")
+
+	for _, args := range []map[string]interface{}{
+		{"sort": "score"},
+		{"limit": float64(0)},
+		{"created_after": "yesterday"},
+		{"fields": []interface{}{"secret"}},
+		{"cursor": "not-a-cursor"},
+	} {
+		_, err := listAgentsHandler(context.Background(), newToolRequest("list_agents", args))
+		assert.Error(t, err, args)
+	}
+}
+
+func TestListAgentsDefaultFields(t *testing.T) {
+	agents = store.NewRegistry(store.NewMemoryStore())
+	require.NoError(t, agents.Create(Agent{ID: "a1", Name: "经济学家", CoreTraits: "理性", Personality: "很长的人格描述", CreatedAt: "2026-01-01T00:00:00Z"}))
+
+	first := func(args map[string]interface{}) map[string]interface{} {
+		result, err := listAgentsHandler(context.Background(), newToolRequest("list_agents", args))
+		require.NoError(t, err)
+		return toolResultJSON(t, result)["agents"].([]interface{})[0].(map[string]interface{})
+	}
+
+	// 未指定 fields 时只返回摘要，不包含人格描述
+	item := first(nil)
+	assert.Equal(t, "经济学家", item["name"])
+	assert.NotContains(t, item, "personality")
+
+	item = first(map[string]interface{}{"fields": []interface{}{"all"}})
+	assert.Equal(t, "很长的人格描述", item["personality"])
+}
+
+func TestListAgentsSortsCreatedAtAcrossOffsets(t *testing.T) {
+	agents = store.NewRegistry(store.NewMemoryStore())
+	for _, agent := range []Agent{
+		// 按字符串比较时顺序为伦敦、纽约、北京，换算为 UTC 后应为北京、伦敦、纽约
+		{ID: "a1", Name: "北京", CreatedAt: "2026-01-01T08:00:00+08:00"},
+		{ID: "a2", Name: "伦敦", CreatedAt: "2026-01-01T01:00:00Z"},
+		{ID: "a3", Name: "纽约", CreatedAt: "2026-01-01T06:00:00-05:00"},
+	} {
+		require.NoError(t, agents.Create(agent))
+	}
+
+	names, _ := listAgentNames(t, nil)
+	assert.Equal(t, []string{"北京", "伦敦", "纽约"}, names)
+
+	// 游标分页沿用换算后的排序键
+	names, cursor := listAgentNames(t, map[string]interface{}{"order": "desc", "limit": float64(1)})
+	assert.Equal(t, []string{"纽约"}, names)
+	names, _ = listAgentNames(t, map[string]interface{}{"order": "desc", "cursor": cursor})
+	assert.Equal(t, []string{"伦敦", "北京"}, names)
+}
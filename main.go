@@ -4,35 +4,31 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"os"
 	"strings"
 	"time"
 
 	"agent-forge/internal/config"
+	"agent-forge/internal/llm"
 	"agent-forge/internal/logger"
+	"agent-forge/internal/store"
 
 	"github.com/google/uuid"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
-	"github.com/sashabaranov/go-openai"
 	"go.uber.org/zap"
 )
 
-// OpenAI客户端
-var openaiClient *openai.Client
+// LLM 提供方注册表，处理函数只依赖 llm.LLMProvider 接口
+var llmProviders *llm.Registry
 
-// Agent 结构体定义
-type Agent struct {
-	ID          string `json:"id"`
-	Name        string `json:"name"`
-	CoreTraits  string `json:"core_traits"`
-	Personality string `json:"personality"`
-	CreatedAt   string `json:"created_at"`
-}
+// Agent 智能体定义
+type Agent = store.Agent
 
-// 存储所有生成的智能体
-var agents = make(map[string]*Agent)
+// 存储所有生成的智能体，所有处理函数均通过并发安全的注册表访问
+var agents = store.NewRegistry(store.NewMemoryStore())
 
 // 定义角色常量
 const (
@@ -57,73 +53,99 @@ func init() {
 		panic(fmt.Sprintf("初始化日志系统失败: %v", err))
 	}
 
-	// 初始化DeepSeek客户端
-	if cfg.DeepSeek.APIKey == "" {
+	// 初始化智能体存储
+	st, err := store.NewAgentStore(cfg.Store)
+	if err != nil {
+		logger.Error("初始化智能体存储失败", zap.Error(err))
+		fmt.Fprintf(os.Stderr, "初始化智能体存储失败: %v\n", err)
+		os.Exit(1)
+	}
+	versionStore, err := store.NewVersionStore(cfg.Store)
+	if err != nil {
+		logger.Error("初始化版本历史存储失败", zap.Error(err))
+		fmt.Fprintf(os.Stderr, "初始化版本历史存储失败: %v\n", err)
+		os.Exit(1)
+	}
+	agents = store.NewRegistryWithVersions(st, versionStore)
+
+	// 初始化讨论会话存储
+	sessionStore, err := store.NewSessionStore(cfg.Store)
+	if err != nil {
+		logger.Error("初始化会话存储失败", zap.Error(err))
+		fmt.Fprintf(os.Stderr, "初始化会话存储失败: %v\n", err)
+		os.Exit(1)
+	}
+	sessions = store.NewSessionRegistry(sessionStore)
+}
+
+// initLLMProviders 初始化LLM提供方，失败时退出进程
+// 导出、导入等子命令不需要调用模型，因此不在 init 中执行
+func initLLMProviders(cfg *config.Config) {
+	// 未配置 providers 时沿用 DeepSeek 配置，此时必须提供密钥
+	if len(cfg.Providers) == 0 && cfg.DeepSeek.APIKey == "" {
 		logger.Error("DEEPSEEK_API_KEY 环境变量未设置")
 		fmt.Fprintln(os.Stderr, "\n请设置 DEEPSEEK_API_KEY 环境变量后再运行程序。例如：")
 		fmt.Fprintln(os.Stderr, "export DEEPSEEK_API_KEY=your_api_key_here")
 		os.Exit(1)
 	}
 
-	openaiConfig := openai.DefaultConfig(cfg.DeepSeek.APIKey)
-	openaiConfig.BaseURL = cfg.DeepSeek.BaseURL
-	openaiClient = openai.NewClientWithConfig(openaiConfig)
+	registry, err := llm.NewRegistryFromConfig(cfg)
+	if err != nil {
+		logger.Error("初始化LLM提供方失败", zap.Error(err))
+		fmt.Fprintf(os.Stderr, "初始化LLM提供方失败: %v\n", err)
+		os.Exit(1)
+	}
+	llmProviders = registry
+
+	cache, err := llm.NewCache(cfg.Cache)
+	if err != nil {
+		logger.Error("初始化LLM响应缓存失败", zap.Error(err))
+		fmt.Fprintf(os.Stderr, "初始化LLM响应缓存失败: %v\n", err)
+		os.Exit(1)
+	}
+	llmCache = cache
 }
 
-// 调用DeepSeek API的公共方法
-func callOpenAI(ctx context.Context, systemPrompt, userQuestion, contextContent string) (string, error) {
-	messages := []openai.ChatCompletionMessage{
+// 调用LLM提供方的公共方法，返回的结果中 Provider 和 Model 为实际处理请求的提供方与模型
+// sampling 指定模型与采样参数，零值表示使用默认提供方的默认设置
+func callOpenAI(ctx context.Context, sampling llm.Sampling, systemPrompt, userQuestion, contextContent string) (*llm.ChatResponse, error) {
+	messages := []llm.Message{
 		{
-			Role:    openai.ChatMessageRoleSystem,
+			Role:    llm.RoleSystem,
 			Content: systemPrompt,
 		},
 	}
 
 	// 如果有背景信息，添加到提示中
 	if contextContent != "" {
-		messages = append(messages, openai.ChatCompletionMessage{
-			Role:    openai.ChatMessageRoleUser,
+		messages = append(messages, llm.Message{
+			Role:    llm.RoleUser,
 			Content: contextContent,
 		})
 	}
 
 	// 添加用户问题
-	messages = append(messages, openai.ChatCompletionMessage{
-		Role:    openai.ChatMessageRoleUser,
+	messages = append(messages, llm.Message{
+		Role:    llm.RoleUser,
 		Content: userQuestion,
 	})
 
-	cfg := config.GetConfig()
-
-	// 设置请求超时
-	clientCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.DeepSeek.Timeout)*time.Second)
-	defer cancel()
-
-	// 如果传入的上下文不是nil，使用传入的上下文
-	requestCtx := clientCtx
-	if ctx != nil {
-		requestCtx = ctx
-	}
-
-	resp, err := openaiClient.CreateChatCompletion(
-		requestCtx,
-		openai.ChatCompletionRequest{
-			Model:       "deepseek-chat", // 使用DeepSeek的模型
-			Messages:    messages,
-			Temperature: float32(cfg.DeepSeek.Temperature), // 转换为float32类型
-		},
-	)
+	return callLLMStream(ctx, sampling, messages, nil)
+}
 
+// callLLMStream 使用按顺序排列、带角色标记的完整消息历史调用LLM提供方，onDelta 不为空且提供方支持流式输出时逐段回调增量内容，
+// 返回的结果中 Content 为整理后的完整回答，Provider 和 Model 为实际处理请求的提供方与模型
+func callLLMStream(ctx context.Context, sampling llm.Sampling, messages []llm.Message, onDelta func(delta string)) (*llm.ChatResponse, error) {
+	resp, err := chatLLM(ctx, llm.ChatRequest{
+		Sampling: sampling,
+		Messages: messages,
+	}, onDelta)
 	if err != nil {
-		return "", fmt.Errorf("DeepSeek API调用失败: %v", err)
-	}
-
-	if len(resp.Choices) == 0 {
-		return "", errors.New("DeepSeek返回结果为空")
+		return nil, err
 	}
 
 	// 去除返回内容中可能的前后空白字符
-	content := strings.TrimSpace(resp.Choices[0].Message.Content)
+	content := strings.TrimSpace(resp.Content)
 
 	// 如果返回的内容是JSON格式，尝试提取纯文本内容
 	var jsonResponse map[string]interface{}
@@ -134,7 +156,70 @@ func callOpenAI(ctx context.Context, systemPrompt, userQuestion, contextContent
 		}
 	}
 
-	return content, nil
+	resp.Content = content
+	return resp, nil
+}
+
+// llmRoute 实际处理请求的提供方与模型，故障转移后与首选的提供方不同
+type llmRoute struct {
+	Provider string `json:"provider,omitempty"`
+	Model    string `json:"model,omitempty"`
+}
+
+// routeOf 返回调用结果的提供方与模型
+func routeOf(resp *llm.ChatResponse) llmRoute {
+	if resp == nil {
+		return llmRoute{}
+	}
+	return llmRoute{Provider: resp.Provider, Model: resp.Model}
+}
+
+// chatLLM 按请求中的模型解析提供方并发起对话补全，返回未经处理的结果
+// 首选提供方持续失败或已熔断时按配置的故障转移链改用其他提供方，结果中的 Provider 为实际使用的提供方
+func chatLLM(ctx context.Context, req llm.ChatRequest, onDelta func(delta string)) (*llm.ChatResponse, error) {
+	// 超时由提供方按配置（或工具级覆盖）设置，ctx 的取消会中止正在进行的生成
+	requestCtx := ctx
+	if requestCtx == nil {
+		requestCtx = context.Background()
+	}
+
+	// 启用缓存的工具调用中，相同请求直接返回缓存的结果
+	cached, cacheKey := cachedResponse(requestCtx, req, onDelta)
+	if cached != nil {
+		return cached, nil
+	}
+
+	primary, primaryModel := llmProviders.Resolve(req.Model)
+	if primaryModel == "" {
+		primaryModel = primary.Model()
+	}
+	resp, err := llmProviders.Chat(requestCtx, req, onDelta)
+	if err != nil {
+		// 保留错误类型，调用方可以通过 errors.Is 判断 llm.ErrRateLimited 等失败原因
+		name := primary.Name()
+		var llmErr *llm.Error
+		if errors.As(err, &llmErr) && llmErr.Provider != "" {
+			name = llmErr.Provider
+		}
+		if errors.Is(err, llm.ErrEmptyResponse) {
+			return nil, fmt.Errorf("%s返回结果为空: %w", name, err)
+		}
+		return nil, fmt.Errorf("%s API调用失败: %w", name, err)
+	}
+	// 缓存键按首选的提供方与模型计算，故障转移到其他提供方或同一提供方的其他模型时结果都不写入缓存
+	preferred := resp.Provider == primary.Name() && resp.RequestedModel == primaryModel
+	if !preferred {
+		logger.Warn("首选LLM提供方不可用，已故障转移",
+			zap.String("preferred", primary.Name()),
+			zap.String("preferred_model", primaryModel),
+			zap.String("provider", resp.Provider),
+			zap.String("model", resp.Model))
+	}
+	recordUsage(requestCtx, resp)
+	if preferred {
+		storeResponse(cacheKey, resp)
+	}
+	return resp, nil
 }
 
 // generateExpertAgentHandler 处理生成专家提示词的请求
@@ -168,6 +253,13 @@ func generateExpertAgentHandler(ctx context.Context, request mcp.GetPromptReques
 	), nil
 }
 
+// explorationFlowRules 探索流规则，圆桌讨论提示词和服务端主持人共用
+const explorationFlowRules = `1、探索流是一种交互式学习和讨论方式，旨在通过动态的对话、试验和反思，发现新观点、解决问题或突破现有局限。它强调通过"表达"、"呼应"和"看见"的过程，激发潜意识和群体智慧，创造新的认知和行为模式。探索流注重个体的自由表达和安全场域，禁止评判、建议和反馈，以实现深度的自我探索和心灵连接。作为一种创新实践方法，探索流通过组织内外的协作与同步，推动创造力和创新能力的涌现，同时探索人与人之间的交互方式，促进认知和情感的双向流动。它还涉及对流的研究和实践，通过关键词反应、生成式AI的交互模式以及集群智慧的涌现，优化复杂系统中的动态过程，发现问题的本质并寻找解决方案。探索流不仅是一种团队协作和深度讨论的方式，也是一种精神探索的过程，通过倾听和观察自然现象达到内心的平静，并通过持续探索和追问重新定义业务和产品的主题或方向。
+2、探索流分为"表达"、"呼应"、"看见"三个大的讨论阶段，表达阶段每人发言一次，呼应阶段可以自由发言，看见阶段每人发言总结一次；
+3、"表达"是一种交流方式，指个体通过语言、行为、艺术或其他形式，将内心深处的思想、情感、观点或灵魂传递给他人的过程。它既是探索流网络中的输出过程，也是探索流的第一阶段，**参与者轮流分享对主题的想法和内容物**。表达可以分为"表"和"达"两个层次，涵盖从信息传递到情感流露的多种形式，体现了个体内心真实感受的外化与分享。
+4、"呼应"是一种交流方式，强调当下的真实发生和自然反应，同时通过倾听和回应他人表达的内容来建立深层次的联系。它是一种内在反应或共鸣，通过关键词或符号触发个人内心的潜意识反应，并生成新的关联。呼应不仅是一种对他人观点或行为的回应或支持，还涉及通过动作与流建立联系，强调看见和表达的重要性。作为探索流的核心步骤和第二阶段，**呼应通过对触动自己的关键词进行反馈或回应**，唤醒个人内在的想法和潜意识，并在探索流网络的隐藏层中产生新的火花。这种交互行为在哲学和社群动态中具有重要意义，能够促进思想的流动和情感的共鸣。
+5、"看见"是一种深刻的意识和理解过程，既指对问题或现象的认知与关注，也是一种通过观察他人而发现自我并真实表达的心理体验。它超越了表面观察，达到心灵的共鸣，能够引发自我和他人的内心转变。作为探索流中的一个核心概念，"看见"涉及通过关键词发现其背后的结构或意义，并通过身心感知他人的表达来觉察内心深处的真实状态。在探索流网络中，"看见"是第三步，**通过识别关键词之间的关系生成结构，从而深化理解与觉察**。这一过程不仅是认知的深化，更是心灵的连接与转化的关键环节。`
+
 // roundTableDiscussionHandler 处理生成圆桌讨论提示词的请求
 func roundTableDiscussionHandler(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
 	// 获取并验证 topic
@@ -180,11 +272,7 @@ func roundTableDiscussionHandler(ctx context.Context, request mcp.GetPromptReque
 		mcp.NewPromptMessage(
 			RoleSystem,
 			mcp.NewTextContent(`你是探索流的主持人，请你收集资料，根据需要讨论的话题创建必要角色的智能体专家来进行一场称为**探索流**的讨论。讨论的过程中，你将作为主持人来控场。探索流的规则如下：
-1、探索流是一种交互式学习和讨论方式，旨在通过动态的对话、试验和反思，发现新观点、解决问题或突破现有局限。它强调通过"表达"、"呼应"和"看见"的过程，激发潜意识和群体智慧，创造新的认知和行为模式。探索流注重个体的自由表达和安全场域，禁止评判、建议和反馈，以实现深度的自我探索和心灵连接。作为一种创新实践方法，探索流通过组织内外的协作与同步，推动创造力和创新能力的涌现，同时探索人与人之间的交互方式，促进认知和情感的双向流动。它还涉及对流的研究和实践，通过关键词反应、生成式AI的交互模式以及集群智慧的涌现，优化复杂系统中的动态过程，发现问题的本质并寻找解决方案。探索流不仅是一种团队协作和深度讨论的方式，也是一种精神探索的过程，通过倾听和观察自然现象达到内心的平静，并通过持续探索和追问重新定义业务和产品的主题或方向。
-2、探索流分为"表达"、"呼应"、"看见"三个大的讨论阶段，表达阶段每人发言一次，呼应阶段可以自由发言，看见阶段每人发言总结一次；
-3、"表达"是一种交流方式，指个体通过语言、行为、艺术或其他形式，将内心深处的思想、情感、观点或灵魂传递给他人的过程。它既是探索流网络中的输出过程，也是探索流的第一阶段，**参与者轮流分享对主题的想法和内容物**。表达可以分为"表"和"达"两个层次，涵盖从信息传递到情感流露的多种形式，体现了个体内心真实感受的外化与分享。
-4、"呼应"是一种交流方式，强调当下的真实发生和自然反应，同时通过倾听和回应他人表达的内容来建立深层次的联系。它是一种内在反应或共鸣，通过关键词或符号触发个人内心的潜意识反应，并生成新的关联。呼应不仅是一种对他人观点或行为的回应或支持，还涉及通过动作与流建立联系，强调看见和表达的重要性。作为探索流的核心步骤和第二阶段，**呼应通过对触动自己的关键词进行反馈或回应**，唤醒个人内在的想法和潜意识，并在探索流网络的隐藏层中产生新的火花。这种交互行为在哲学和社群动态中具有重要意义，能够促进思想的流动和情感的共鸣。
-5、"看见"是一种深刻的意识和理解过程，既指对问题或现象的认知与关注，也是一种通过观察他人而发现自我并真实表达的心理体验。它超越了表面观察，达到心灵的共鸣，能够引发自我和他人的内心转变。作为探索流中的一个核心概念，"看见"涉及通过关键词发现其背后的结构或意义，并通过身心感知他人的表达来觉察内心深处的真实状态。在探索流网络中，"看见"是第三步，**通过识别关键词之间的关系生成结构，从而深化理解与觉察**。这一过程不仅是认知的深化，更是心灵的连接与转化的关键环节。
+`+explorationFlowRules+`
 6、最后你作为主持人进行最终的收敛总结，输出一篇探索流报告。
 7、每个阶段结束时，你都要通知用户，等用户的指令再进行下一阶段`),
 		),
@@ -203,12 +291,34 @@ func roundTableDiscussionHandler(ctx context.Context, request mcp.GetPromptReque
 func main() {
 	log := logger.GetLogger()
 
+	// 子命令：导出、导入智能体
+	if len(os.Args) > 1 && isSubcommand(os.Args[1]) {
+		os.Exit(runSubcommand(os.Args[1], os.Args[2:], os.Stdout, os.Stderr))
+	}
+
+	// 命令行参数优先于配置文件
+	cfg := config.GetConfig()
+	flag.StringVar(&cfg.Server.Transport, "transport", cfg.Server.Transport, "传输方式: stdio、sse 或 http")
+	flag.StringVar(&cfg.Server.Host, "host", cfg.Server.Host, "HTTP 监听地址（sse/http 模式）")
+	flag.IntVar(&cfg.Server.Port, "port", cfg.Server.Port, "HTTP 监听端口（sse/http 模式）")
+	// 先解析命令行参数，-h 或参数错误时无需可用的LLM提供方配置
+	flag.Parse()
+	initLLMProviders(cfg)
+
 	// 创建 MCP 服务器
+	// 记录工具调用的请求ID，使客户端的取消通知能够中止对应的调用
+	hooks := &server.Hooks{}
+	hooks.AddBeforeCallTool(recordRequestID)
+
 	s := server.NewMCPServer(
 		"智能体锻造工具",
 		"1.0.0",
 		server.WithPromptCapabilities(true), // 启用 prompts 功能
+		server.WithResourceCapabilities(false, true), // 启用 resources 功能，资源列表变化时通知客户端
+		server.WithHooks(hooks),
+		server.WithToolHandlerMiddleware(toolContextMiddleware),
 	)
+	s.AddNotificationHandler(cancelledNotificationMethod, cancelledNotificationHandler)
 
 	// 添加创建专家提示词
 	generateExpertAgentPrompt := mcp.NewPrompt("generate_expert_agent",
@@ -239,15 +349,24 @@ func main() {
 	// 创建智能体工具
 	createTool := mcp.NewTool(
 		"expert_personality_generation",
-		mcp.WithDescription("创建新的智能体"),
-		mcp.WithString("agent_name",
-			mcp.Required(),
-			mcp.Description("智能体名称"),
-		),
-		mcp.WithString("core_traits",
-			mcp.Required(),
-			mcp.Description("核心特质"),
-		),
+		withSamplingOptions(
+			mcp.WithDescription("创建新的智能体"),
+			mcp.WithString("agent_name",
+				mcp.Required(),
+				mcp.Description("智能体名称"),
+			),
+			mcp.WithString("core_traits",
+				mcp.Required(),
+				mcp.Description("核心特质"),
+			),
+			mcp.WithArray("tags",
+				mcp.Description("标签列表，用于在 list_agents 中筛选"),
+				mcp.Items(map[string]interface{}{"type": "string"}),
+			),
+			mcp.WithBoolean("no_cache",
+				mcp.Description("跳过LLM响应缓存重新生成人格，新结果仍会写入缓存"),
+			),
+		)...,
 	)
 
 	// 模拟智能体回答工具
@@ -263,7 +382,8 @@ func main() {
   * 外部搜索或知识输入
 - planned_rounds: 预估需要进行的回答次数
 - current_round: 已回答次数
-- need_more_rounds: 是否需要新增回答次数,当主持人认为需要新增回答次数时，设置为true，否则设置为false`),
+- need_more_rounds: 是否需要新增回答次数,当主持人认为需要新增回答次数时，设置为true，否则设置为false
+- session_id / history: 可选的对话历史来源，提供时智能体能看到自己此前的回答和其他智能体的发言`),
 		mcp.WithString("agent_id",
 			mcp.Required(),
 			mcp.Description("智能体ID"),
@@ -280,6 +400,24 @@ func main() {
 		mcp.WithBoolean("need_more_rounds",
 			mcp.Description("是否需要新增回答次数"),
 		),
+		mcp.WithString("session_id",
+			mcp.Description("可选的讨论会话ID，提供时会话中的发言将作为对话历史，智能体自己的发言以 assistant 角色呈现"),
+		),
+		mcp.WithArray("history",
+			mcp.Description("可选的对话历史，按时间顺序排列，每项包含 role（user/assistant）、content 和可选的 name（发言者名称）"),
+			mcp.Items(map[string]interface{}{
+				"type": "object",
+				"properties": map[string]interface{}{
+					"role":    map[string]interface{}{"type": "string", "enum": []string{"user", "assistant"}},
+					"name":    map[string]interface{}{"type": "string"},
+					"content": map[string]interface{}{"type": "string"},
+				},
+				"required": []string{"role", "content"},
+			}),
+		),
+		mcp.WithBoolean("no_cache",
+			mcp.Description("跳过LLM响应缓存重新生成回答，新结果仍会写入缓存"),
+		),
 	)
 
 	// 获取智能体信息工具
@@ -295,7 +433,47 @@ func main() {
 	// 列出所有智能体工具
 	listTool := mcp.NewTool(
 		"list_agents",
-		mcp.WithDescription("列出所有智能体"),
+		mcp.WithDescription(`按条件查询智能体，结果顺序稳定并支持游标分页。
+参数说明:
+- name / trait: 名称或特质包含的关键字（不区分大小写）
+- tag: 必须包含的标签
+- created_after / created_before: 创建时间范围（RFC3339），包含起点不包含终点
+- sort / order: 排序字段 created_at（默认）或 name，顺序 asc（默认）或 desc
+- limit / cursor: 每页数量（默认50，最多200），以及上一页返回的 next_cursor
+- fields: 返回的字段，默认只返回摘要（同 ["summary"]），["all"] 返回包括人格描述在内的全部字段`),
+		mcp.WithString("name",
+			mcp.Description("名称包含的关键字"),
+		),
+		mcp.WithString("trait",
+			mcp.Description("核心特质或结构化人格特质包含的关键字"),
+		),
+		mcp.WithString("tag",
+			mcp.Description("必须包含的标签"),
+		),
+		mcp.WithString("created_after",
+			mcp.Description("只返回在该时间及之后创建的智能体（RFC3339）"),
+		),
+		mcp.WithString("created_before",
+			mcp.Description("只返回在该时间之前创建的智能体（RFC3339）"),
+		),
+		mcp.WithString("sort",
+			mcp.Description("排序字段"),
+			mcp.Enum(listSortCreatedAt, listSortName),
+		),
+		mcp.WithString("order",
+			mcp.Description("排序顺序"),
+			mcp.Enum(listOrderAsc, listOrderDesc),
+		),
+		mcp.WithNumber("limit",
+			mcp.Description("每页数量，默认50，最多200"),
+		),
+		mcp.WithString("cursor",
+			mcp.Description("上一页返回的 next_cursor"),
+		),
+		mcp.WithArray("fields",
+			mcp.Description("返回的字段，summary（默认）表示 id、name、core_traits、tags、created_at、version，all 表示全部字段"),
+			mcp.Items(map[string]interface{}{"type": "string"}),
+		),
 	)
 
 	// 删除智能体工具
@@ -309,18 +487,316 @@ func main() {
 	)
 
 	// 更新智能体工具
+	stringArraySchema := map[string]interface{}{"type": "array", "items": map[string]interface{}{"type": "string"}}
 	updateTool := mcp.NewTool(
 		"update_agent",
-		mcp.WithDescription("更新智能体信息"),
+		withSamplingOptions(
+			mcp.WithDescription(`更新智能体信息。
+参数说明:
+- core_traits: 新的核心特质，默认会重新生成人格
+- personality: 手写的人格描述，会取代结构化人格
+- persona: 结构化人格的局部修改，只修改提供的字段
+- regenerate: 是否调用LLM重新生成人格，修改核心特质且未提供 personality/persona 时默认为 true
+- expected_version: 期望的当前版本号（见智能体的 version 字段），不一致时拒绝修改`),
+			mcp.WithString("agent_id",
+				mcp.Required(),
+				mcp.Description("智能体ID"),
+			),
+			mcp.WithString("name",
+				mcp.Description("新的智能体名称"),
+			),
+			mcp.WithString("core_traits",
+				mcp.Description("新的核心特质"),
+			),
+			mcp.WithArray("tags",
+				mcp.Description("新的标签列表，会替换已有标签，传入空数组可清除标签"),
+				mcp.Items(map[string]interface{}{"type": "string"}),
+			),
+			mcp.WithString("personality",
+				mcp.Description("手写的人格描述，设置后清除结构化人格，不能与 persona 同时使用"),
+			),
+			mcp.WithObject("persona",
+				mcp.Description("结构化人格的局部修改，未提供的字段保持不变"),
+				mcp.Properties(map[string]interface{}{
+					"expertise_domains":    stringArraySchema,
+					"traits":               stringArraySchema,
+					"speaking_style":       map[string]interface{}{"type": "string"},
+					"values":               stringArraySchema,
+					"knowledge_boundaries": stringArraySchema,
+					"taboo_topics":         stringArraySchema,
+					"example_utterances":   stringArraySchema,
+				}),
+				mcp.AdditionalProperties(false),
+			),
+			mcp.WithBoolean("regenerate",
+				mcp.Description("是否调用LLM重新生成人格"),
+			),
+			mcp.WithNumber("expected_version",
+				mcp.Description("期望的当前版本号，用于乐观并发控制"),
+			),
+			mcp.WithBoolean("reset_sampling",
+				mcp.Description("是否清除已设置的模型与采样参数，恢复默认值（先清除再应用本次提供的参数）"),
+			),
+			mcp.WithString("reason",
+				mcp.Description("本次修改的原因，记录在版本历史中"),
+			),
+		)...,
+	)
+
+	// 服务端圆桌讨论工具
+	roundTableTool := mcp.NewTool(
+		"run_round_table",
+		mcp.WithDescription(`由服务端主持一场完整的探索流讨论并返回讨论记录和主持人报告。
+流程:
+- 表达: 每位智能体按顺序发言一次
+- 呼应: 进行 resonance_rounds 轮自由发言，智能体可以选择不发言
+- 看见: 每位智能体总结一次
+- 最后由主持人输出探索流报告
+任一发言或报告失败时讨论停止，结果标记为错误，但仍返回已完成的发言、用量以及 error 和 failed_at（中断的阶段与智能体）`),
+		mcp.WithString("topic",
+			mcp.Required(),
+			mcp.Description("探索主题"),
+		),
+		mcp.WithArray("agent_ids",
+			mcp.Required(),
+			mcp.Description("参与讨论的智能体ID列表，按发言顺序排列"),
+			mcp.Items(map[string]interface{}{"type": "string"}),
+		),
+		mcp.WithNumber("resonance_rounds",
+			mcp.Description("呼应阶段的轮数，默认1，最多5"),
+		),
+	)
+
+	// 创建讨论会话工具
+	createSessionTool := mcp.NewTool(
+		"create_session",
+		mcp.WithDescription(`创建一个讨论会话，服务端会记录每位智能体的发言，并在 session_turn 时自动构建上下文。
+参数说明:
+- topic: 讨论主题
+- agent_ids: 参与讨论的智能体ID列表
+- planned_rounds: 计划讨论轮数，每位参与者都发言一次计为一轮，默认1`),
+		mcp.WithString("topic",
+			mcp.Required(),
+			mcp.Description("讨论主题"),
+		),
+		mcp.WithArray("agent_ids",
+			mcp.Required(),
+			mcp.Description("参与讨论的智能体ID列表"),
+			mcp.Items(map[string]interface{}{"type": "string"}),
+		),
+		mcp.WithNumber("planned_rounds",
+			mcp.Description("计划讨论轮数，默认1"),
+		),
+	)
+
+	// 会话发言工具
+	sessionTurnTool := mcp.NewTool(
+		"session_turn",
+		mcp.WithDescription(`让会话中的一位智能体发言，发言会被记录到会话中。
+参数说明:
+- session_id: 会话ID
+- agent_id: 发言的智能体ID，必须是会话参与者
+- message: 可选的主持人发言或追问，会先记录到会话中再由智能体回应
+- need_more_rounds: 是否需要新增一轮讨论`),
+		mcp.WithString("session_id",
+			mcp.Required(),
+			mcp.Description("会话ID"),
+		),
+		mcp.WithString("agent_id",
+			mcp.Required(),
+			mcp.Description("发言的智能体ID"),
+		),
+		mcp.WithString("message",
+			mcp.Description("主持人发言或追问"),
+		),
+		mcp.WithBoolean("need_more_rounds",
+			mcp.Description("是否需要新增一轮讨论"),
+		),
+	)
+
+	// 获取会话记录工具
+	getSessionTranscriptTool := mcp.NewTool(
+		"get_session_transcript",
+		mcp.WithDescription("获取讨论会话的完整记录"),
+		mcp.WithString("session_id",
+			mcp.Required(),
+			mcp.Description("会话ID"),
+		),
+	)
+
+	// 关闭会话工具
+	closeSessionTool := mcp.NewTool(
+		"close_session",
+		mcp.WithDescription("关闭讨论会话，关闭后仍可获取记录但不再接受发言"),
+		mcp.WithString("session_id",
+			mcp.Required(),
+			mcp.Description("会话ID"),
+		),
+	)
+
+	// 导出智能体工具
+	exportTool := mcp.NewTool(
+		"export_agent",
+		mcp.WithDescription("将智能体导出为带版本号的人格文件（YAML 或 JSON），可通过 import_agent 在其他机器上导入"),
 		mcp.WithString("agent_id",
 			mcp.Required(),
 			mcp.Description("智能体ID"),
 		),
-		mcp.WithString("name",
-			mcp.Description("新的智能体名称"),
+		mcp.WithString("format",
+			mcp.Description("文件格式: yaml（默认）或 json"),
+			mcp.Enum(store.FormatYAML, store.FormatJSON),
+		),
+	)
+
+	// 导入智能体工具
+	importTool := mcp.NewTool(
+		"import_agent",
+		mcp.WithDescription(`从人格文件导入智能体。
+参数说明:
+- content: export_agent 导出的人格文件内容（YAML 或 JSON）
+- on_conflict: ID或名称与已有智能体冲突时的处理方式
+  * error: 放弃导入（默认）
+  * replace: 覆盖冲突的已有智能体，保留其ID
+  * copy: 作为新的智能体导入，使用新ID，名称重复时追加序号`),
+		mcp.WithString("content",
+			mcp.Required(),
+			mcp.Description("人格文件内容"),
+		),
+		mcp.WithString("on_conflict",
+			mcp.Description("冲突处理方式: error、replace 或 copy"),
+			mcp.Enum(string(store.ConflictError), string(store.ConflictReplace), string(store.ConflictCopy)),
+		),
+	)
+
+	// 智能体版本历史工具
+	listVersionsTool := mcp.NewTool(
+		"list_agent_versions",
+		mcp.WithDescription("列出智能体的版本历史，每次创建、更新、导入或回滚都会记录一个版本"),
+		mcp.WithString("agent_id",
+			mcp.Required(),
+			mcp.Description("智能体ID"),
+		),
+	)
+
+	diffVersionsTool := mcp.NewTool(
+		"diff_agent_versions",
+		mcp.WithDescription("比较智能体两个版本之间的差异，多行文本字段会给出逐行差异"),
+		mcp.WithString("agent_id",
+			mcp.Required(),
+			mcp.Description("智能体ID"),
 		),
-		mcp.WithString("core_traits",
-			mcp.Description("新的核心特质"),
+		mcp.WithNumber("from_version",
+			mcp.Required(),
+			mcp.Description("起始版本号"),
+		),
+		mcp.WithNumber("to_version",
+			mcp.Description("目标版本号，默认为当前版本"),
+		),
+	)
+
+	rollbackTool := mcp.NewTool(
+		"rollback_agent",
+		mcp.WithDescription("将智能体恢复为指定历史版本的内容，恢复结果会作为新版本记录，不会删除之后的历史"),
+		mcp.WithString("agent_id",
+			mcp.Required(),
+			mcp.Description("智能体ID"),
+		),
+		mcp.WithNumber("version",
+			mcp.Required(),
+			mcp.Description("要恢复的版本号"),
+		),
+		mcp.WithString("reason",
+			mcp.Description("回滚原因，记录在版本历史中"),
+		),
+	)
+
+	// 推荐智能体工具
+	recommendTool := mcp.NewTool(
+		"recommend_agents",
+		mcp.WithDescription(`根据主题从已有智能体中推荐最相关的专家，可用于在圆桌讨论前挑选参与者。
+配置了向量模型（providers[].embedding_model）时按语义相似度排序，否则使用本地 TF-IDF 检索。
+返回每个智能体的相关度分数和推荐理由；没有合适的智能体时再考虑创建新的智能体。`),
+		mcp.WithString("topic",
+			mcp.Required(),
+			mcp.Description("讨论主题或问题"),
+		),
+		mcp.WithNumber("top_k",
+			mcp.Description("最多返回的智能体数量，默认5，最多20"),
+		),
+		mcp.WithNumber("min_score",
+			mcp.Description("最低相关度分数（0-1），默认0"),
+		),
+	)
+
+	// 批量创建智能体工具
+	batchCreateTool := mcp.NewTool(
+		"batch_create_agents",
+		withSamplingOptions(
+			mcp.WithDescription(`一次创建多个智能体，并发生成人格，比逐个调用 expert_personality_generation 快得多。
+参数说明:
+- agents: 待创建的智能体列表，每项包含 agent_name、core_traits 和可选的 tags，同一批中的名称不能重复
+- atomic: 为 true 时任一智能体失败则全部不保存；默认 false，成功的智能体各自保存
+- concurrency: 同时生成人格的数量，默认且最多为服务端配置的 batch.concurrency
+返回每个智能体的创建结果（created、failed 或 discarded）`),
+			mcp.WithArray("agents",
+				mcp.Required(),
+				mcp.Description("待创建的智能体列表，名称不能重复"),
+				mcp.Items(map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"agent_name":  map[string]interface{}{"type": "string", "description": "智能体名称"},
+						"core_traits": map[string]interface{}{"type": "string", "description": "核心特质"},
+						"tags":        stringArraySchema,
+					},
+					"required":             []string{"agent_name", "core_traits"},
+					"additionalProperties": false,
+				}),
+			),
+			mcp.WithBoolean("atomic",
+				mcp.Description("任一智能体失败时是否全部不保存，默认 false"),
+			),
+			mcp.WithNumber("concurrency",
+				mcp.Description("同时生成人格的数量"),
+			),
+		)...,
+	)
+
+	// 创建专家组工具
+	forgePanelTool := mcp.NewTool(
+		"forge_panel",
+		withSamplingOptions(
+			mcp.WithDescription(`根据主题自动设计一组互补的专家角色并全部创建，适合在圆桌讨论前快速组建专家组。
+模型会为每个席位给出名称、核心特质和入选理由，角色之间避免重叠；任一成员创建失败时不会保留任何成员。
+model、temperature 和 seed 同时用于设计阵容，指定 seed 可以复现同一阵容；top_p 和 max_tokens 只用于成员作答。
+返回每个席位的智能体ID和入选理由，可直接用于 run_round_table 或 create_session。`),
+			mcp.WithString("topic",
+				mcp.Required(),
+				mcp.Description("讨论主题或问题"),
+			),
+			mcp.WithNumber("size",
+				mcp.Description(fmt.Sprintf("专家人数，默认%d，范围%d-%d", defaultPanelSize, minPanelSize, maxPanelSize)),
+			),
+			mcp.WithString("constraints",
+				mcp.Description("多样性要求，例如“至少一位反对者”“兼顾学界与业界”"),
+			),
+			mcp.WithArray("tags",
+				mcp.Description("为所有成员添加的标签"),
+				mcp.Items(map[string]interface{}{"type": "string"}),
+			),
+		)...,
+	)
+
+	// 用量报告工具
+	usageReportTool := mcp.NewTool(
+		"usage_report",
+		mcp.WithDescription(`查询自服务启动以来LLM调用消耗的 token 数和费用（按 usage.prices 配置的单价计算，缓存命中不计入）。
+统计只保存在内存中，服务重启后清零：重启前创建的智能体和讨论会话只统计重启后的用量。
+不带参数时返回总计以及按模型、智能体、讨论会话的统计；提供 agent_id 或 session_id 时只返回对应的统计。`),
+		mcp.WithString("agent_id",
+			mcp.Description("只查看该智能体的用量"),
+		),
+		mcp.WithString("session_id",
+			mcp.Description("只查看该讨论会话的用量"),
 		),
 	)
 
@@ -331,9 +807,48 @@ func main() {
 	s.AddTool(listTool, listAgentsHandler)
 	s.AddTool(deleteTool, deleteAgentHandler)
 	s.AddTool(updateTool, updateAgentHandler)
+	s.AddTool(roundTableTool, runRoundTableHandler)
+	s.AddTool(createSessionTool, createSessionHandler)
+	s.AddTool(sessionTurnTool, sessionTurnHandler)
+	s.AddTool(getSessionTranscriptTool, getSessionTranscriptHandler)
+	s.AddTool(closeSessionTool, closeSessionHandler)
+	s.AddTool(exportTool, exportAgentHandler)
+	s.AddTool(importTool, importAgentHandler)
+	s.AddTool(listVersionsTool, listAgentVersionsHandler)
+	s.AddTool(diffVersionsTool, diffAgentVersionsHandler)
+	s.AddTool(rollbackTool, rollbackAgentHandler)
+	s.AddTool(recommendTool, recommendAgentsHandler)
+	s.AddTool(batchCreateTool, batchCreateAgentsHandler)
+	s.AddTool(forgePanelTool, forgePanelHandler)
+	s.AddTool(usageReportTool, usageReportHandler)
+
+	// 将智能体发布为资源
+	if err := registerAgentResources(s); err != nil {
+		log.Fatal("注册智能体资源失败", zap.Error(err))
+	}
+
+	// 为每个智能体注册独立的提示词
+	if err := registerAgentPrompts(s); err != nil {
+		log.Fatal("注册智能体提示词失败", zap.Error(err))
+	}
+
+	// 从智能体库目录加载预置的智能体，资源与提示词会随注册表变更同步
+	if cfg.Library.Dir != "" {
+		library, err := loadAgentLibrary(cfg.Library.Dir)
+		if err != nil {
+			log.Fatal("加载智能体库失败", zap.Error(err))
+		}
+		if cfg.Library.Watch {
+			stopWatch, err := library.watch()
+			if err != nil {
+				log.Fatal("监听智能体库失败", zap.Error(err))
+			}
+			defer stopWatch()
+		}
+	}
 
 	// 启动服务器
-	if err := server.ServeStdio(s); err != nil {
+	if err := serve(s, cfg.Server); err != nil {
 		log.Fatal("服务启动失败", zap.Error(err))
 		os.Exit(1)
 	}
@@ -344,49 +859,59 @@ func createToolHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.C
 	log := logger.GetLogger()
 
 	// 提取参数
-	agentName, ok := request.Params.Arguments["agent_name"].(string)
+	agentName, ok := request.GetArguments()["agent_name"].(string)
 	if !ok || agentName == "" {
 		log.Error("无效的智能体名称")
 		return nil, errors.New("无效的智能体名称")
 	}
 
-	coreTraits, ok := request.Params.Arguments["core_traits"].(string)
+	coreTraits, ok := request.GetArguments()["core_traits"].(string)
 	if !ok || coreTraits == "" {
 		log.Error("无效的核心特征")
 		return nil, errors.New("无效的核心特征")
 	}
 
+	sampling, err := parseSamplingArgs(request.GetArguments())
+	if err != nil {
+		return nil, err
+	}
+	tags, err := stringSliceArg(request.GetArguments(), "tags")
+	if err != nil {
+		return nil, err
+	}
+	mode, err := parseCacheArg(request.GetArguments())
+	if err != nil {
+		return nil, err
+	}
+	ctx = withCacheMode(ctx, mode)
+	ctx, meter := withUsageMeter(ctx)
+
 	log.Info("创建智能体",
 		zap.String("name", agentName),
 		zap.String("traits", coreTraits))
 
-	systemPrompt := "你是一个专家人格生成工具，请根据智能体名称和核心特质生成一个专家人格的提示词。注意仅返回提示词，不要包含任何其他内容。"
-	question := fmt.Sprintf("请为名为[%s]的智能体生成一个人格描述，核心特质是：[%s]", agentName, coreTraits)
-
-	// 调用OpenAI
-	response, err := callOpenAI(ctx, systemPrompt, question, "")
+	// 调用OpenAI生成结构化人格
+	newAgent, resp, err := forgeAgent(ctx, agentName, coreTraits, tags, sampling)
 	if err != nil {
 		return nil, err
 	}
-
-	// 创建新的智能体实例
-	agentID := uuid.New().String()
-	newAgent := &Agent{
-		ID:          agentID,
-		Name:        agentName,
-		CoreTraits:  coreTraits,
-		Personality: response,
-		CreatedAt:   time.Now().Format(time.RFC3339),
-	}
+	agentID := newAgent.ID
 
 	// 存储智能体
-	agents[agentID] = newAgent
+	if err := agents.Create(newAgent); err != nil {
+		log.Error("保存智能体失败", zap.Error(err))
+		return nil, fmt.Errorf("save agent failed: %v", err)
+	}
 
-	// 返回处理结果，包含智能体ID
+	// 返回处理结果，包含智能体ID以及实际生成人格的提供方与模型
 	result := map[string]interface{}{
 		"status":   "success",
 		"message":  "智能体创建成功",
 		"agent_id": agentID,
+		"provider": resp.Provider,
+		"model":    resp.Model,
+		"cached":   resp.Cached,
+		"usage":    meter.snapshot(),
 	}
 
 	jsonResponse, err := json.Marshal(result)
@@ -398,34 +923,60 @@ func createToolHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.C
 	return mcp.NewToolResultText(string(jsonResponse)), nil
 }
 
-// 获取智能体处理函数
-func getAgentHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	agentID, ok := request.Params.Arguments["agent_id"].(string)
-	if !ok {
-		return nil, errors.New("agent_id must be a string")
+// forgeAgent 生成结构化人格并构建新的智能体，调用方负责保存；同时返回生成人格的调用结果
+func forgeAgent(ctx context.Context, name, coreTraits string, tags []string, sampling samplingPatch) (Agent, *llm.ChatResponse, error) {
+	// 先分配ID，生成人格的用量记到新智能体名下
+	id := uuid.New().String()
+	var draft Agent
+	sampling.apply(&draft)
+	persona, resp, err := generatePersona(withUsageAgent(ctx, id, name), name, coreTraits, personaSampling(agentSampling(draft)))
+	if err != nil {
+		return Agent{}, nil, err
 	}
 
-	agent, exists := agents[agentID]
-	if !exists {
-		return nil, fmt.Errorf("agent with ID %s not found", agentID)
+	agent := Agent{
+		ID:          id,
+		Name:        name,
+		CoreTraits:  coreTraits,
+		Personality: renderPersona(persona),
+		Persona:     persona,
+		Tags:        store.NormalizeTags(tags),
+		CreatedAt:   time.Now().Format(time.RFC3339),
 	}
+	sampling.apply(&agent)
+	return agent, resp, nil
+}
 
-	jsonResponse, err := json.Marshal(agent)
+// getStoredAgent 从注册表中读取智能体快照，并统一不存在时的错误信息
+func getStoredAgent(agentID string) (Agent, error) {
+	agent, err := agents.Get(agentID)
 	if err != nil {
-		return nil, fmt.Errorf("marshal response failed: %v", err)
+		return Agent{}, agentLookupError(agentID, err)
 	}
+	return agent, nil
+}
 
-	return mcp.NewToolResultText(string(jsonResponse)), nil
+// agentLookupError 将存储层错误转换为面向调用方的错误信息
+func agentLookupError(agentID string, err error) error {
+	if errors.Is(err, store.ErrAgentNotFound) {
+		return fmt.Errorf("agent with ID %s not found", agentID)
+	}
+	return fmt.Errorf("load agent failed: %v", err)
 }
 
-// 列出所有智能体处理函数
-func listAgentsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	agentList := make([]*Agent, 0, len(agents))
-	for _, agent := range agents {
-		agentList = append(agentList, agent)
+// 获取智能体处理函数
+func getAgentHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	agentID, ok := request.GetArguments()["agent_id"].(string)
+	if !ok {
+		return nil, errors.New("agent_id must be a string")
 	}
 
-	jsonResponse, err := json.Marshal(agentList)
+	agent, err := getStoredAgent(agentID)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonResponse, err := json.Marshal(agent)
 	if err != nil {
 		return nil, fmt.Errorf("marshal response failed: %v", err)
 	}
@@ -435,17 +986,18 @@ func listAgentsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.C
 
 // 删除智能体处理函数
 func deleteAgentHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	agentID, ok := request.Params.Arguments["agent_id"].(string)
+	agentID, ok := request.GetArguments()["agent_id"].(string)
 	if !ok {
 		return nil, errors.New("agent_id must be a string")
 	}
 
-	if _, exists := agents[agentID]; !exists {
-		return nil, fmt.Errorf("agent with ID %s not found", agentID)
+	if err := agents.Delete(agentID); err != nil {
+		if errors.Is(err, store.ErrAgentNotFound) {
+			return nil, fmt.Errorf("agent with ID %s not found", agentID)
+		}
+		return nil, fmt.Errorf("delete agent failed: %v", err)
 	}
 
-	delete(agents, agentID)
-
 	result := map[string]string{
 		"status":  "success",
 		"message": fmt.Sprintf("智能体 %s 已成功删除", agentID),
@@ -461,33 +1013,146 @@ func deleteAgentHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.
 
 // 更新智能体处理函数
 func updateAgentHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
-	agentID, ok := request.Params.Arguments["agent_id"].(string)
+	args := request.GetArguments()
+	agentID, ok := args["agent_id"].(string)
 	if !ok {
 		return nil, errors.New("agent_id must be a string")
 	}
 
-	agent, exists := agents[agentID]
-	if !exists {
-		return nil, fmt.Errorf("agent with ID %s not found", agentID)
+	current, err := getStoredAgent(agentID)
+	if err != nil {
+		return nil, err
 	}
 
-	// 更新名称（如果提供）
-	if newName, ok := request.Params.Arguments["name"].(string); ok && newName != "" {
-		agent.Name = newName
+	newName, _ := args["name"].(string)
+	newTraits, _ := args["core_traits"].(string)
+	resetSamplingParams, _ := args["reset_sampling"].(bool)
+	reason, _ := args["reason"].(string)
+	sampling, err := parseSamplingArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	newTags, err := stringSliceArg(args, "tags")
+	if err != nil {
+		return nil, err
+	}
+	_, hasTags := args["tags"]
+	if reason == "" {
+		reason = store.ReasonUpdated
+	}
+
+	// 手写的人格描述与结构化人格修改
+	newPersonality, hasPersonality := args["personality"].(string)
+	if _, ok := args["personality"]; ok && (!hasPersonality || strings.TrimSpace(newPersonality) == "") {
+		return nil, errors.New("personality must be a non-empty string")
+	}
+	patch, err := parsePersonaPatch(args, "persona")
+	if err != nil {
+		return nil, err
+	}
+	if hasPersonality && patch != nil {
+		return nil, errors.New("personality and persona cannot be updated at the same time")
+	}
+	manual := hasPersonality || patch != nil
+
+	// 是否重新生成人格：默认仅在修改核心特质且未手动提供人格时重新生成
+	regenerate := newTraits != "" && !manual
+	if v, ok := args["regenerate"]; ok {
+		explicit, ok := v.(bool)
+		if !ok {
+			return nil, errors.New("regenerate must be a boolean")
+		}
+		if explicit && manual {
+			return nil, errors.New("regenerate cannot be combined with personality or persona")
+		}
+		regenerate = explicit
 	}
 
-	// 更新核心特质（如果提供）
-	if newTraits, ok := request.Params.Arguments["core_traits"].(string); ok && newTraits != "" {
-		agent.CoreTraits = newTraits
-		// 重新生成人格描述
-		systemPrompt := "你是一个专家人格生成工具，请根据智能体名称和核心特质生成一个专家人格。"
-		question := fmt.Sprintf("请为名为[%s]的智能体生成一个人格描述，核心特质是：[%s]", agent.Name, newTraits)
+	// 乐观并发控制：提供 expected_version 时，仅在当前版本一致时才修改
+	expectedVersion, checkVersion, err := parseVersionArg(args, "expected_version")
+	if err != nil {
+		return nil, err
+	}
+	checkExpectedVersion := func(agent *Agent) error {
+		if checkVersion && agent.Version != expectedVersion {
+			return fmt.Errorf("%w: expected version %d, current version %d", store.ErrVersionConflict, expectedVersion, agent.Version)
+		}
+		return nil
+	}
+	// 先检查一次，避免版本已过期时仍调用LLM
+	if err := checkExpectedVersion(&current); err != nil {
+		return nil, fmt.Errorf("update agent failed: %v", err)
+	}
 
-		newPersonality, err := callOpenAI(ctx, systemPrompt, question, "")
+	// 重新生成人格描述
+	// LLM调用耗时较长，在注册表锁外基于快照完成，之后再原子地写回
+	var newPersona *Persona
+	var route llmRoute
+	if regenerate {
+		name, traits := current.Name, current.CoreTraits
+		if newName != "" {
+			name = newName
+		}
+		if newTraits != "" {
+			traits = newTraits
+		}
+		draft := current
+		if resetSamplingParams {
+			resetSampling(&draft)
+		}
+		sampling.apply(&draft)
+		var resp *llm.ChatResponse
+		newPersona, resp, err = generatePersona(withUsageAgent(ctx, agentID, name), name, traits, personaSampling(agentSampling(draft)))
 		if err != nil {
 			return nil, fmt.Errorf("generate new personality failed: %v", err)
 		}
-		agent.Personality = newPersonality
+		route = routeOf(resp)
+	}
+
+	agent, err := agents.UpdateWithReason(agentID, reason, func(agent *Agent) error {
+		if err := checkExpectedVersion(agent); err != nil {
+			return err
+		}
+		// 更新名称（如果提供）
+		if newName != "" {
+			agent.Name = newName
+		}
+		// 更新核心特质（如果提供）
+		if newTraits != "" {
+			agent.CoreTraits = newTraits
+		}
+		// 更新标签（如果提供）
+		if hasTags {
+			agent.Tags = store.NormalizeTags(newTags)
+		}
+		switch {
+		case regenerate:
+			agent.Persona = newPersona
+			agent.Personality = renderPersona(newPersona)
+		case hasPersonality:
+			// 手写的人格描述取代结构化人格，作答时直接使用该描述
+			agent.Persona = nil
+			agent.Personality = strings.TrimSpace(newPersonality)
+		case patch != nil:
+			persona, err := patch.apply(agent.Persona)
+			if err != nil {
+				return err
+			}
+			agent.Persona = persona
+			agent.Personality = renderPersona(persona)
+		}
+		// 更新模型与采样参数（如果提供）
+		if resetSamplingParams {
+			resetSampling(agent)
+		}
+		sampling.apply(agent)
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, store.ErrAgentNotFound) {
+			return nil, agentLookupError(agentID, err)
+		}
+		return nil, fmt.Errorf("update agent failed: %v", err)
 	}
 
 	result := map[string]interface{}{
@@ -495,6 +1160,11 @@ func updateAgentHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.
 		"message": "智能体更新成功",
 		"agent":   agent,
 	}
+	// 重新生成人格时返回实际生成人格的提供方与模型
+	if regenerate {
+		result["provider"] = route.Provider
+		result["model"] = route.Model
+	}
 
 	jsonResponse, err := json.Marshal(result)
 	if err != nil {
@@ -507,38 +1177,72 @@ func updateAgentHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.
 // 模拟智能体回答处理函数
 func answerToolHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 	// 获取参数
-	agentID, ok := request.Params.Arguments["agent_id"].(string)
+	agentID, ok := request.GetArguments()["agent_id"].(string)
 	if !ok {
 		return nil, errors.New("agent_id must be a string")
 	}
 
-	context, _ := request.Params.Arguments["context"].(string)
-	plannedRounds, _ := request.Params.Arguments["planned_rounds"].(float64)
-	currentRound, _ := request.Params.Arguments["current_round"].(float64)
-	needMoreRounds, _ := request.Params.Arguments["need_more_rounds"].(bool)
+	context, _ := request.GetArguments()["context"].(string)
+	plannedRounds, _ := request.GetArguments()["planned_rounds"].(float64)
+	currentRound, _ := request.GetArguments()["current_round"].(float64)
+	needMoreRounds, _ := request.GetArguments()["need_more_rounds"].(bool)
 
 	if currentRound > plannedRounds {
 		plannedRounds = currentRound
 	}
 
 	// 获取智能体
-	agent, exists := agents[agentID]
-	if !exists {
-		return nil, fmt.Errorf("agent with ID %s not found", agentID)
+	agent, err := getStoredAgent(agentID)
+	if err != nil {
+		return nil, err
+	}
+
+	// 收集已有的对话历史：会话中的发言在前，调用方提供的历史在后
+	// 回答的用量记到智能体名下，引用会话时同时记到会话名下
+	ctx = withUsageAgent(ctx, agent.ID, agent.Name)
+	var history []llm.Message
+	if sessionID, ok := request.GetArguments()["session_id"].(string); ok && sessionID != "" {
+		session, err := getStoredSession(sessionID)
+		if err != nil {
+			return nil, err
+		}
+		if !session.HasParticipant(agentID) {
+			return nil, fmt.Errorf("agent %s is not a participant of session %s", agentID, sessionID)
+		}
+		history = sessionHistory(session, agentID)
+		ctx = withUsageSession(ctx, sessionID)
+	}
+	extra, err := parseHistoryArg(request.GetArguments(), "history")
+	if err != nil {
+		return nil, err
+	}
+	history = append(history, extra...)
+
+	mode, err := parseCacheArg(request.GetArguments())
+	if err != nil {
+		return nil, err
 	}
+	ctx = withCacheMode(ctx, mode)
+	ctx, meter := withUsageMeter(ctx)
 
 	// 构建系统提示词
-	systemPrompt := fmt.Sprintf("你现在扮演一个%s。%s", agent.Name, agent.Personality)
+	systemPrompt := agentSystemPrompt(agent)
 
-	// 调用OpenAI生成回答
-	response, err := callOpenAI(ctx, systemPrompt, context, "")
+	// 调用OpenAI生成回答，有历史发言时使用多轮消息；
+	// 调用方提供 progressToken 时以流式方式生成，并通过进度通知转发增量内容
+	messages := historyMessages(systemPrompt, history, context)
+	response, err := callLLMStream(ctx, agentSampling(agent), messages, progressNotifier(ctx, request))
 	if err != nil {
 		return nil, err
 	}
 
-	// 创建包含所有信息的响应
+	// 创建包含所有信息的响应，provider 和 model 为实际生成回答的提供方与模型（可能来自故障转移）
 	result := map[string]interface{}{
-		"content":          response,
+		"content":          response.Content,
+		"provider":         response.Provider,
+		"model":            response.Model,
+		"cached":           response.Cached,
+		"usage":            meter.snapshot(),
 		"planned_rounds":   plannedRounds,
 		"current_round":    currentRound,
 		"need_more_rounds": needMoreRounds,
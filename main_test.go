@@ -2,16 +2,32 @@ package main
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"agent-forge/internal/store"
+
 	"github.com/google/uuid"
 	"github.com/mark3labs/mcp-go/mcp"
 	"github.com/mark3labs/mcp-go/server"
+	"github.com/sashabaranov/go-openai"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
+// TestMain 测试统一使用内存存储，避免写入配置中的数据文件
+func TestMain(m *testing.M) {
+	agents = store.NewRegistry(store.NewMemoryStore())
+	sessions = store.NewSessionRegistry(store.NewMemorySessionStore())
+	os.Exit(m.Run())
+}
+
 // MockAgent 用于测试的Agent结构体
 type mockAgent struct {
 	ID          string
@@ -88,7 +104,7 @@ func TestGetAgent(t *testing.T) {
 		Personality: "测试性格",
 		CreatedAt:   time.Now().Format(time.RFC3339),
 	}
-	agents[testAgent.ID] = testAgent
+	assert.NoError(t, agents.Create(*testAgent))
 
 	tests := []struct {
 		name        string
@@ -125,17 +141,13 @@ func TestGetAgent(t *testing.T) {
 }
 
 // 模拟获取Agent功能
-func getAgent(agentID string) (*Agent, error) {
-	agent, exists := agents[agentID]
-	if !exists {
-		return nil, fmt.Errorf("agent with ID %s not found", agentID)
-	}
-	return agent, nil
+func getAgent(agentID string) (Agent, error) {
+	return getStoredAgent(agentID)
 }
 
 func TestListAgents(t *testing.T) {
 	// 清空智能体列表
-	agents = make(map[string]*Agent)
+	agents = store.NewRegistry(store.NewMemoryStore())
 
 	// 添加测试用智能体
 	testAgents := []*Agent{
@@ -156,7 +168,7 @@ func TestListAgents(t *testing.T) {
 	}
 
 	for _, agent := range testAgents {
-		agents[agent.ID] = agent
+		assert.NoError(t, agents.Create(*agent))
 	}
 
 	// 直接测试列表功能
@@ -165,11 +177,8 @@ func TestListAgents(t *testing.T) {
 }
 
 // 模拟列出Agent功能
-func listAgents() []*Agent {
-	agentList := make([]*Agent, 0, len(agents))
-	for _, agent := range agents {
-		agentList = append(agentList, agent)
-	}
+func listAgents() []Agent {
+	agentList, _ := agents.List()
 	return agentList
 }
 
@@ -182,7 +191,7 @@ func TestDeleteAgent(t *testing.T) {
 		Personality: "测试性格",
 		CreatedAt:   time.Now().Format(time.RFC3339),
 	}
-	agents[testAgent.ID] = testAgent
+	assert.NoError(t, agents.Create(*testAgent))
 
 	tests := []struct {
 		name        string
@@ -214,18 +223,17 @@ func TestDeleteAgent(t *testing.T) {
 			assert.NoError(t, err)
 
 			// 验证智能体是否已被删除
-			_, exists := agents[tt.agentID]
-			assert.False(t, exists)
+			_, err = agents.Get(tt.agentID)
+			assert.ErrorIs(t, err, store.ErrAgentNotFound)
 		})
 	}
 }
 
 // 模拟删除Agent功能
 func deleteAgent(agentID string) error {
-	if _, exists := agents[agentID]; !exists {
+	if err := agents.Delete(agentID); err != nil {
 		return fmt.Errorf("agent with ID %s not found", agentID)
 	}
-	delete(agents, agentID)
 	return nil
 }
 
@@ -247,6 +255,343 @@ func createExpertPrompt(name, traits string) string {
 	return fmt.Sprintf("请为名为[%s]的智能体生成一个人格描述，核心特质是：[%s]", name, traits)
 }
 
+func TestAgentSamplingParameters(t *testing.T) {
+	requests := useFakeLLM(t, "回答")
+	agents = store.NewRegistry(store.NewMemoryStore())
+	ctx := context.Background()
+
+	_, err := createToolHandler(ctx, newToolRequest("expert_personality_generation", map[string]interface{}{
+		"agent_name":  "审计专家",
+		"core_traits": "严谨",
+		"top_p":       1.5,
+	}))
+	assert.Error(t, err, "top_p 超出范围应当报错")
+
+	result, err := createToolHandler(ctx, newToolRequest("expert_personality_generation", map[string]interface{}{
+		"agent_name":  "头脑风暴者",
+		"core_traits": "发散,创新",
+		"model":       "deepseek-reasoner",
+		"temperature": 1.3,
+		"max_tokens":  float64(512),
+		"seed":        float64(7),
+	}))
+	assert.NoError(t, err)
+	agentID := toolResultJSON(t, result)["agent_id"].(string)
+
+	// 生成人格时使用默认模型
+	assert.Equal(t, "deepseek-chat", requests.last().Model)
+
+	_, err = answerToolHandler(ctx, newToolRequest("agent_answer", map[string]interface{}{
+		"agent_id": agentID,
+		"context":  "给我十个点子",
+	}))
+	assert.NoError(t, err)
+	req := requests.last()
+	assert.Equal(t, "deepseek-reasoner", req.Model)
+	assert.InDelta(t, 1.3, req.Temperature, 1e-6)
+	assert.Equal(t, 512, req.MaxTokens)
+	if assert.NotNil(t, req.Seed) {
+		assert.Equal(t, 7, *req.Seed)
+	}
+
+	// 重置后恢复默认参数，同时应用新的 top_p
+	_, err = updateAgentHandler(ctx, newToolRequest("update_agent", map[string]interface{}{
+		"agent_id":       agentID,
+		"reset_sampling": true,
+		"top_p":          0.2,
+	}))
+	assert.NoError(t, err)
+	agent, err := getStoredAgent(agentID)
+	assert.NoError(t, err)
+	assert.Empty(t, agent.Model)
+	assert.Nil(t, agent.Temperature)
+	if assert.NotNil(t, agent.TopP) {
+		assert.InDelta(t, 0.2, *agent.TopP, 1e-9)
+	}
+}
+
+func TestRunRoundTable(t *testing.T) {
+	requests := useFakeLLM(t, "我的观点")
+	agents = store.NewRegistry(store.NewMemoryStore())
+	assert.NoError(t, agents.Create(Agent{ID: "a1", Name: "哲学家", Personality: "深思"}))
+	assert.NoError(t, agents.Create(Agent{ID: "a2", Name: "工程师", Personality: "务实"}))
+	ctx := context.Background()
+
+	_, err := runRoundTableHandler(ctx, newToolRequest("run_round_table", map[string]interface{}{
+		"topic":     "AI与教育",
+		"agent_ids": []interface{}{"a1", "missing"},
+	}))
+	assert.Error(t, err)
+
+	result, err := runRoundTableHandler(ctx, newToolRequest("run_round_table", map[string]interface{}{
+		"topic":            "AI与教育",
+		"agent_ids":        []interface{}{"a1", "a2", "a1"},
+		"resonance_rounds": float64(2),
+	}))
+	assert.NoError(t, err)
+
+	data := toolResultJSON(t, result)
+	transcript := data["transcript"].([]interface{})
+	// 表达2次 + 呼应2轮x2人 + 看见2次
+	assert.Len(t, transcript, 8)
+	assert.Equal(t, PhaseExpression, transcript[0].(map[string]interface{})["phase"])
+	assert.Equal(t, PhaseSeeing, transcript[7].(map[string]interface{})["phase"])
+	assert.Equal(t, "我的观点", data["report"])
+	// 8次发言 + 1次主持人报告
+	assert.Len(t, requests.requests, 9)
+}
+
+func TestRoundTableResonancePass(t *testing.T) {
+	useFakeLLMFunc(t, func(req openai.ChatCompletionRequest) string {
+		var system, instruction string
+		for _, m := range req.Messages {
+			if m.Role == openai.ChatMessageRoleSystem {
+				system = m.Content
+			}
+			instruction = m.Content
+		}
+		if !strings.Contains(instruction, "呼应") {
+			return "我的观点"
+		}
+		// 哲学家放弃发言，工程师在回应中提到了标记
+		if strings.Contains(system, "深思") {
+			return " [PASS]\n"
+		}
+		return "有人说可以直接回复 [PASS]，但我想回应\"务实\"这个词"
+	})
+	agents = store.NewRegistry(store.NewMemoryStore())
+	require.NoError(t, agents.Create(Agent{ID: "a1", Name: "哲学家", Personality: "深思"}))
+	require.NoError(t, agents.Create(Agent{ID: "a2", Name: "工程师", Personality: "务实"}))
+
+	result, err := runRoundTableHandler(context.Background(), newToolRequest("run_round_table", map[string]interface{}{
+		"topic":            "AI与教育",
+		"agent_ids":        []interface{}{"a1", "a2"},
+		"resonance_rounds": float64(1),
+	}))
+	require.NoError(t, err)
+
+	var resonance []map[string]interface{}
+	for _, turn := range toolResultJSON(t, result)["transcript"].([]interface{}) {
+		if turn := turn.(map[string]interface{}); turn["phase"] == PhaseResonance {
+			resonance = append(resonance, turn)
+		}
+	}
+	require.Len(t, resonance, 1)
+	assert.Equal(t, "a2", resonance[0]["agent_id"])
+	assert.Contains(t, resonance[0]["content"], "[PASS]")
+}
+
+func TestRoundTableReturnsPartialResultOnFailure(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req openai.ChatCompletionRequest
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		system, instruction := req.Messages[0].Content, req.Messages[len(req.Messages)-1].Content
+		// 工程师在呼应阶段的请求被拒绝，发言失败
+		if strings.Contains(system, "务实") && strings.Contains(instruction, "呼应") {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"error":{"message":"bad request","type":"invalid_request_error"}}`))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Model: "deepseek-chat",
+			Choices: []openai.ChatCompletionChoice{{
+				Message:      openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "我的观点"},
+				FinishReason: openai.FinishReasonStop,
+			}},
+			Usage: fakeUsage,
+		})
+	}))
+	t.Cleanup(srv.Close)
+	useFakeProvider(t, srv.URL)
+	agents = store.NewRegistry(store.NewMemoryStore())
+	require.NoError(t, agents.Create(Agent{ID: "a1", Name: "哲学家", Personality: "深思"}))
+	require.NoError(t, agents.Create(Agent{ID: "a2", Name: "工程师", Personality: "务实"}))
+
+	result, err := runRoundTableHandler(context.Background(), newToolRequest("run_round_table", map[string]interface{}{
+		"topic":            "AI与教育",
+		"agent_ids":        []interface{}{"a1", "a2"},
+		"resonance_rounds": float64(1),
+	}))
+	require.NoError(t, err)
+	assert.True(t, result.IsError)
+
+	// 中断前的发言和用量都会返回，并指明中断的位置
+	data := toolResultJSON(t, result)
+	assert.Len(t, data["transcript"].([]interface{}), 3)
+	assert.Empty(t, data["report"])
+	assert.Contains(t, data["error"], "工程师")
+	assert.Equal(t, map[string]interface{}{
+		"phase":      PhaseResonance,
+		"round":      float64(1),
+		"agent_id":   "a2",
+		"agent_name": "工程师",
+	}, data["failed_at"])
+	usage := data["usage"].(map[string]interface{})
+	assert.Equal(t, float64(3), usage["calls"])
+}
+
+func TestStructuredPersona(t *testing.T) {
+	requests := useFakeLLM(t, "回答")
+	agents = store.NewRegistry(store.NewMemoryStore())
+	ctx := context.Background()
+
+	result, err := createToolHandler(ctx, newToolRequest("expert_personality_generation", map[string]interface{}{
+		"agent_name":  "系统架构师",
+		"core_traits": "严谨，好奇",
+	}))
+	require.NoError(t, err)
+	// 人格通过 JSON 模式生成
+	require.NotNil(t, requests.last().ResponseFormat)
+	assert.Equal(t, openai.ChatCompletionResponseFormatTypeJSONObject, requests.last().ResponseFormat.Type)
+
+	agent, err := getStoredAgent(toolResultJSON(t, result)["agent_id"].(string))
+	require.NoError(t, err)
+	require.NotNil(t, agent.Persona)
+	assert.Equal(t, []string{"系统设计", "创新管理"}, agent.Persona.ExpertiseDomains)
+	assert.Equal(t, []string{"政治立场"}, agent.Persona.TabooTopics)
+
+	// 作答时的系统提示词由结构化人格渲染
+	_, err = answerToolHandler(ctx, newToolRequest("agent_answer", map[string]interface{}{
+		"agent_id": agent.ID,
+		"context":  "如何设计高可用系统？",
+	}))
+	require.NoError(t, err)
+	system := requests.last().Messages[0].Content
+	assert.Contains(t, system, "你现在扮演一个系统架构师。")
+	assert.Contains(t, system, "专业领域：系统设计、创新管理")
+	assert.Contains(t, system, "避免谈论的话题：政治立场")
+}
+
+func TestParsePersona(t *testing.T) {
+	persona, err := parsePersona(`{"expertise_domains":["经济学"," "],"speaking_style":"平实"}`, "理性,审慎")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"经济学"}, persona.ExpertiseDomains)
+	// 模型未返回特质时使用核心特质
+	assert.Equal(t, []string{"理性", "审慎"}, persona.Traits)
+
+	_, err = parsePersona(`不是JSON`, "理性")
+	assert.Error(t, err)
+	_, err = parsePersona(`{"traits":["理性"],"speaking_style":"平实"}`, "理性")
+	assert.Error(t, err)
+}
+
+func TestAnswerWithHistory(t *testing.T) {
+	requests := useFakeLLM(t, "回答")
+	agents = store.NewRegistry(store.NewMemoryStore())
+	assert.NoError(t, agents.Create(Agent{ID: "a1", Name: "哲学家", Personality: "深思"}))
+	ctx := context.Background()
+
+	_, err := answerToolHandler(ctx, newToolRequest("agent_answer", map[string]interface{}{
+		"agent_id": "a1",
+		"context":  "那你怎么看？",
+		"history": []interface{}{
+			map[string]interface{}{"role": "user", "content": "什么是自由？"},
+			map[string]interface{}{"role": "assistant", "content": "自由是选择。"},
+			map[string]interface{}{"role": "user", "name": "engineer", "content": "我不同意。"},
+		},
+	}))
+	assert.NoError(t, err)
+
+	messages := requests.last().Messages
+	assert.Len(t, messages, 5)
+	assert.Equal(t, "system", messages[0].Role)
+	assert.Equal(t, "assistant", messages[2].Role)
+	assert.Equal(t, "engineer", messages[3].Name)
+	assert.Equal(t, "engineer：我不同意。", messages[3].Content)
+	assert.Equal(t, "那你怎么看？", messages[4].Content)
+
+	_, err = answerToolHandler(ctx, newToolRequest("agent_answer", map[string]interface{}{
+		"agent_id": "a1",
+		"context":  "问题",
+		"history":  []interface{}{map[string]interface{}{"role": "system", "content": "x"}},
+	}))
+	assert.Error(t, err)
+}
+
+func TestDiscussionSession(t *testing.T) {
+	requests := useFakeLLM(t, "我的观点")
+	agents = store.NewRegistry(store.NewMemoryStore())
+	sessions = store.NewSessionRegistry(store.NewMemorySessionStore())
+	assert.NoError(t, agents.Create(Agent{ID: "a1", Name: "哲学家", Personality: "深思"}))
+	assert.NoError(t, agents.Create(Agent{ID: "a2", Name: "工程师", Personality: "务实"}))
+	assert.NoError(t, agents.Create(Agent{ID: "a3", Name: "旁观者"}))
+	ctx := context.Background()
+
+	result, err := createSessionHandler(ctx, newToolRequest("create_session", map[string]interface{}{
+		"topic":     "AI与教育",
+		"agent_ids": []interface{}{"a1", "a2"},
+	}))
+	assert.NoError(t, err)
+	sessionID := toolResultJSON(t, result)["id"].(string)
+
+	turn := func(agentID, message string) map[string]interface{} {
+		result, err := sessionTurnHandler(ctx, newToolRequest("session_turn", map[string]interface{}{
+			"session_id": sessionID,
+			"agent_id":   agentID,
+			"message":    message,
+		}))
+		assert.NoError(t, err)
+		return toolResultJSON(t, result)
+	}
+
+	first := turn("a1", "请先谈谈你的看法")
+	assert.Equal(t, float64(1), first["current_round"])
+	assert.Equal(t, false, first["finished"])
+
+	// 第二位发言时服务端应把之前的发言放进上下文
+	second := turn("a2", "")
+	assert.Equal(t, float64(2), second["current_round"])
+	assert.Equal(t, true, second["finished"])
+	last := requests.last()
+	assert.Len(t, last.Messages, 4)
+	assert.Equal(t, "主持人：请先谈谈你的看法", last.Messages[1].Content)
+	assert.Equal(t, "user", last.Messages[2].Role)
+	assert.Equal(t, "哲学家：我的观点", last.Messages[2].Content)
+
+	_, err = sessionTurnHandler(ctx, newToolRequest("session_turn", map[string]interface{}{
+		"session_id": sessionID,
+		"agent_id":   "a3",
+	}))
+	assert.Error(t, err)
+
+	// agent_answer 引用会话时，智能体自己的发言以 assistant 角色出现
+	_, err = answerToolHandler(ctx, newToolRequest("agent_answer", map[string]interface{}{
+		"agent_id":   "a1",
+		"context":    "请补充一点",
+		"session_id": sessionID,
+	}))
+	assert.NoError(t, err)
+	last = requests.last()
+	assert.Len(t, last.Messages, 5)
+	assert.Equal(t, "assistant", last.Messages[2].Role)
+	assert.Equal(t, "我的观点", last.Messages[2].Content)
+	assert.Equal(t, "工程师：我的观点", last.Messages[3].Content)
+	assert.Equal(t, "请补充一点", last.Messages[4].Content)
+
+	result, err = getSessionTranscriptHandler(ctx, newToolRequest("get_session_transcript", map[string]interface{}{
+		"session_id": sessionID,
+	}))
+	assert.NoError(t, err)
+	turns := toolResultJSON(t, result)["turns"].([]interface{})
+	// agent_answer 只读取会话，不追加发言
+	assert.Len(t, turns, 3)
+	assert.Equal(t, store.SpeakerModerator, turns[0].(map[string]interface{})["speaker"])
+
+	result, err = closeSessionHandler(ctx, newToolRequest("close_session", map[string]interface{}{
+		"session_id": sessionID,
+	}))
+	assert.NoError(t, err)
+	assert.Equal(t, store.SessionClosed, toolResultJSON(t, result)["status"])
+
+	_, err = sessionTurnHandler(ctx, newToolRequest("session_turn", map[string]interface{}{
+		"session_id": sessionID,
+		"agent_id":   "a1",
+	}))
+	assert.Error(t, err)
+}
+
 func setupTestServer() *server.MCPServer {
 	s := server.NewMCPServer(
 		"测试服务器",
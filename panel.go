@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"agent-forge/internal/llm"
+	"agent-forge/internal/logger"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.uber.org/zap"
+)
+
+// 专家组人数
+const (
+	defaultPanelSize = 4
+	minPanelSize     = 2
+	maxPanelSize     = 8
+)
+
+// maxCastingAttempts 专家组阵容无效时的最大尝试次数
+const maxCastingAttempts = 2
+
+// panelSystemPrompt 要求模型以 JSON 对象输出互补的专家组阵容
+const panelSystemPrompt = `你是一个圆桌讨论的选角顾问，请根据讨论主题设计一组互补的专家角色。
+要求：
+1. 每个角色代表不同的学科、立场或方法论，角色之间不要重叠；
+2. 阵容整体要覆盖主题的关键维度，并包含能够相互质疑的视角；
+3. 满足用户给出的人数和多样性要求。
+只输出一个 JSON 对象，不要包含任何其他内容，字段如下：
+{
+  "strategy": "整体选角思路",
+  "seats": [
+    {
+      "name": "角色名称",
+      "core_traits": "核心特质，用逗号分隔",
+      "rationale": "该角色在本组中的作用，以及与其他角色的区别"
+    }
+  ]
+}`
+
+// panelSeat 专家组中的一个席位
+type panelSeat struct {
+	Name       string `json:"name"`
+	CoreTraits string `json:"core_traits"`
+	Rationale  string `json:"rationale"`
+}
+
+// panelCast 模型给出的专家组阵容
+type panelCast struct {
+	Strategy string      `json:"strategy"`
+	Seats    []panelSeat `json:"seats"`
+}
+
+// panelMember 已创建的专家组成员
+type panelMember struct {
+	AgentID    string `json:"agent_id"`
+	Name       string `json:"name"`
+	CoreTraits string `json:"core_traits"`
+	Rationale  string `json:"rationale"`
+	llmRoute
+}
+
+// castPanel 通过 JSON 模式生成专家组阵容，结果无效时重试；同时返回生成阵容的提供方与模型
+// sampling 为调用方指定的模型与采样参数，指定种子或温度为 0 时阵容可以复现并被缓存
+func castPanel(ctx context.Context, topic string, size int, constraints string, sampling llm.Sampling) (*panelCast, llmRoute, error) {
+	prompt := fmt.Sprintf("讨论主题：[%s]\n请设计 %d 个专家角色。", topic, size)
+	if constraints != "" {
+		prompt += fmt.Sprintf("\n多样性要求：%s", constraints)
+	}
+	messages := []llm.Message{
+		{Role: llm.RoleSystem, Content: panelSystemPrompt},
+		{Role: llm.RoleUser, Content: prompt},
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= maxCastingAttempts; attempt++ {
+		// 缓存中的阵容无效时，重试跳过缓存并用新结果覆盖它
+		if attempt > 1 && cacheModeFromContext(ctx) == cacheReadWrite {
+			ctx = withCacheMode(ctx, cacheRefresh)
+		}
+		resp, err := chatLLM(ctx, llm.ChatRequest{Sampling: sampling, Messages: messages, JSONMode: true}, nil)
+		if err != nil {
+			return nil, llmRoute{}, err
+		}
+
+		cast, err := parsePanelCast(resp.Content, size)
+		if err == nil {
+			return cast, routeOf(resp), nil
+		}
+		lastErr = err
+		logger.Warn("生成的专家组阵容无效",
+			zap.String("topic", topic),
+			zap.Int("attempt", attempt),
+			zap.Error(err))
+	}
+	return nil, llmRoute{}, fmt.Errorf("cast panel failed: %v", lastErr)
+}
+
+// parsePanelCast 解析并校验专家组阵容：席位不少于要求的人数（多余的席位被舍弃），名称和核心特质不能重复
+func parsePanelCast(content string, size int) (*panelCast, error) {
+	var cast panelCast
+	if err := json.Unmarshal([]byte(strings.TrimSpace(content)), &cast); err != nil {
+		return nil, fmt.Errorf("invalid panel json: %v", err)
+	}
+	cast.Strategy = strings.TrimSpace(cast.Strategy)
+	if len(cast.Seats) < size {
+		return nil, fmt.Errorf("expected %d seats, got %d", size, len(cast.Seats))
+	}
+	cast.Seats = cast.Seats[:size]
+
+	names := make(map[string]bool, size)
+	traits := make(map[string]bool, size)
+	for i := range cast.Seats {
+		seat := &cast.Seats[i]
+		seat.Name = strings.TrimSpace(seat.Name)
+		seat.CoreTraits = strings.TrimSpace(seat.CoreTraits)
+		seat.Rationale = strings.TrimSpace(seat.Rationale)
+		if seat.Name == "" || seat.CoreTraits == "" {
+			return nil, fmt.Errorf("seat %d is missing name or core_traits", i+1)
+		}
+		if names[seat.Name] {
+			return nil, fmt.Errorf("duplicate seat name: %s", seat.Name)
+		}
+		if traits[seat.CoreTraits] {
+			return nil, fmt.Errorf("duplicate core_traits: %s", seat.CoreTraits)
+		}
+		names[seat.Name] = true
+		traits[seat.CoreTraits] = true
+	}
+	return &cast, nil
+}
+
+// 创建专家组处理函数
+func forgePanelHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	log := logger.GetLogger()
+	args := request.GetArguments()
+
+	topic, ok := args["topic"].(string)
+	topic = strings.TrimSpace(topic)
+	if !ok || topic == "" {
+		return nil, errors.New("topic must be a non-empty string")
+	}
+
+	size := defaultPanelSize
+	if v, ok := args["size"]; ok {
+		n, ok := v.(float64)
+		if !ok || n < minPanelSize || n > maxPanelSize || n != math.Trunc(n) {
+			return nil, fmt.Errorf("size must be an integer between %d and %d", minPanelSize, maxPanelSize)
+		}
+		size = int(n)
+	}
+
+	constraints, _ := args["constraints"].(string)
+	constraints = strings.TrimSpace(constraints)
+
+	sampling, err := parseSamplingArgs(args)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := stringSliceArg(args, "tags")
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, meter := withUsageMeter(ctx)
+
+	log.Info("创建专家组",
+		zap.String("topic", topic),
+		zap.Int("size", size))
+
+	cast, castRoute, err := castPanel(ctx, topic, size, constraints, castingSampling(sampling.sampling()))
+	if err != nil {
+		return nil, err
+	}
+
+	// 并发生成全部人格，任一失败时不保存任何智能体
+	specs := make([]agentSpec, 0, len(cast.Seats))
+	for _, seat := range cast.Seats {
+		specs = append(specs, agentSpec{Name: seat.Name, CoreTraits: seat.CoreTraits, Tags: tags})
+	}
+	forged, routes, errs := forgeAgents(ctx, specs, sampling, batchConcurrency(), true)
+	for i, err := range errs {
+		if err != nil && !errors.Is(err, errBatchAborted) {
+			return nil, fmt.Errorf("forge %s failed: %v", specs[i].Name, err)
+		}
+	}
+	if _, err := saveForgedAgents(forged); err != nil {
+		return nil, err
+	}
+
+	panel := make([]panelMember, 0, len(forged))
+	for i, agent := range forged {
+		panel = append(panel, panelMember{
+			AgentID:    agent.ID,
+			Name:       agent.Name,
+			CoreTraits: agent.CoreTraits,
+			Rationale:  cast.Seats[i].Rationale,
+			llmRoute:   routes[i],
+		})
+	}
+
+	result := map[string]interface{}{
+		"status":   "success",
+		"message":  fmt.Sprintf("已创建 %d 位专家", len(panel)),
+		"topic":    topic,
+		"strategy": cast.Strategy,
+		"panel":    panel,
+		// 生成阵容的提供方与模型，各成员的人格由谁生成见 panel 中的 provider 和 model
+		"provider": castRoute.Provider,
+		"model":    castRoute.Model,
+		"usage":    meter.snapshot(),
+	}
+
+	jsonResponse, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("marshal response failed: %v", err)
+	}
+
+	return mcp.NewToolResultText(string(jsonResponse)), nil
+}
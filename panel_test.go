@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"agent-forge/internal/store"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fakePanelJSON = `{
+	"strategy": "兼顾技术、商业与监管视角",
+	"seats": [
+		{"name": "芯片架构师", "core_traits": "严谨,务实", "rationale": "评估技术可行性"},
+		{"name": "风险投资人", "core_traits": "敏锐,逐利", "rationale": "判断商业回报"},
+		{"name": "监管顾问", "core_traits": "审慎,守规", "rationale": "提示合规风险"}
+	]
+}`
+
+// usePanelLLM 选角请求依次返回 castReplies 中的内容（用尽后重复最后一个），其余 JSON 请求返回 fakePersonaJSON
+func usePanelLLM(t *testing.T, castReplies ...string) *llmRequestLog {
+	t.Helper()
+	casts := 0
+	return useFakeLLMFunc(t, func(req openai.ChatCompletionRequest) string {
+		if len(req.Messages) > 0 && req.Messages[0].Content == panelSystemPrompt {
+			reply := castReplies[min(casts, len(castReplies)-1)]
+			casts++
+			return reply
+		}
+		return fakePersonaJSON
+	})
+}
+
+func TestForgePanel(t *testing.T) {
+	log := usePanelLLM(t, fakePanelJSON)
+	agents = store.NewRegistry(store.NewMemoryStore())
+
+	result, err := forgePanelHandler(context.Background(), newToolRequest("forge_panel", map[string]interface{}{
+		"topic":       "是否应该自研AI芯片",
+		"size":        float64(3),
+		"constraints": "至少一位持反对意见",
+		"tags":        []interface{}{"芯片"},
+	}))
+	require.NoError(t, err)
+	data := toolResultJSON(t, result)
+	assert.Equal(t, "兼顾技术、商业与监管视角", data["strategy"])
+	assert.Equal(t, "fake", data["provider"])
+	assert.Equal(t, "deepseek-chat", data["model"])
+
+	panel := data["panel"].([]interface{})
+	require.Len(t, panel, 3)
+	seat := panel[1].(map[string]interface{})
+	assert.Equal(t, "风险投资人", seat["name"])
+	assert.Equal(t, "判断商业回报", seat["rationale"])
+	assert.Equal(t, "fake", seat["provider"])
+
+	agent, err := agents.Get(seat["agent_id"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, "敏锐,逐利", agent.CoreTraits)
+	assert.Equal(t, []string{"芯片"}, agent.Tags)
+	require.NotNil(t, agent.Persona)
+
+	// 选角请求携带人数与多样性要求
+	log.mu.Lock()
+	castPrompt := log.requests[0].Messages[1].Content
+	log.mu.Unlock()
+	assert.Contains(t, castPrompt, "3 个专家角色")
+	assert.Contains(t, castPrompt, "至少一位持反对意见")
+
+	list, err := agents.List()
+	require.NoError(t, err)
+	assert.Len(t, list, 3)
+}
+
+func TestForgePanelCastingUsesSampling(t *testing.T) {
+	log := usePanelLLM(t, fakePanelJSON)
+	agents = store.NewRegistry(store.NewMemoryStore())
+
+	_, err := forgePanelHandler(context.Background(), newToolRequest("forge_panel", map[string]interface{}{
+		"topic":      "是否应该自研AI芯片",
+		"size":       float64(3),
+		"model":      "fake/deepseek-reasoner",
+		"seed":       float64(7),
+		"top_p":      0.5,
+		"max_tokens": float64(64),
+	}))
+	require.NoError(t, err)
+
+	// 选角请求沿用模型和种子，同一种子得到相同的阵容；top_p 和 max_tokens 只用于成员作答
+	log.mu.Lock()
+	cast := log.requests[0]
+	log.mu.Unlock()
+	require.Equal(t, panelSystemPrompt, cast.Messages[0].Content)
+	assert.Equal(t, "deepseek-reasoner", cast.Model)
+	require.NotNil(t, cast.Seed)
+	assert.Equal(t, 7, *cast.Seed)
+	assert.Zero(t, cast.TopP)
+	assert.Zero(t, cast.MaxTokens)
+}
+
+func TestForgePanelRetriesInvalidCast(t *testing.T) {
+	duplicate := `{"strategy": "", "seats": [
+		{"name": "经济学家", "core_traits": "理性", "rationale": "a"},
+		{"name": "经济学家", "core_traits": "感性", "rationale": "b"}
+	]}`
+	usePanelLLM(t, duplicate, fakePanelJSON)
+	agents = store.NewRegistry(store.NewMemoryStore())
+
+	// 多余的席位被舍弃
+	result, err := forgePanelHandler(context.Background(), newToolRequest("forge_panel", map[string]interface{}{
+		"topic": "是否应该自研AI芯片",
+		"size":  float64(2),
+	}))
+	require.NoError(t, err)
+	assert.Len(t, toolResultJSON(t, result)["panel"], 2)
+}
+
+func TestForgePanelRejectsInvalidArgs(t *testing.T) {
+	usePanelLLM(t, fakePanelJSON)
+	agents = store.NewRegistry(store.NewMemoryStore())
+
+	for _, args := range []map[string]interface{}{
+		{"topic": " "},
+		{"topic": "主题", "size": float64(1)},
+		{"topic": "主题", "size": float64(2.5)},
+		{"topic": "主题", "size": float64(maxPanelSize + 1)},
+	} {
+		_, err := forgePanelHandler(context.Background(), newToolRequest("forge_panel", args))
+		assert.Error(t, err, "%v", args)
+	}
+
+	// 阵容人数不足时不创建任何智能体
+	_, err := forgePanelHandler(context.Background(), newToolRequest("forge_panel", map[string]interface{}{
+		"topic": "主题",
+		"size":  float64(5),
+	}))
+	assert.Error(t, err)
+	list, err := agents.List()
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
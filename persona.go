@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"agent-forge/internal/llm"
+	"agent-forge/internal/logger"
+	"agent-forge/internal/store"
+
+	"go.uber.org/zap"
+)
+
+// Persona 结构化人格定义
+type Persona = store.Persona
+
+// maxPersonaAttempts 人格生成结果无效时的最大尝试次数
+const maxPersonaAttempts = 2
+
+// personaSystemPrompt 要求模型以 JSON 对象输出结构化人格
+const personaSystemPrompt = `你是一个专家人格生成工具，请根据智能体名称和核心特质生成一个结构化的专家人格。
+只输出一个 JSON 对象，不要包含任何其他内容，字段如下：
+{
+  "expertise_domains": ["擅长的专业领域"],
+  "traits": ["性格特质"],
+  "speaking_style": "说话风格的描述",
+  "values": ["坚持的价值观"],
+  "knowledge_boundaries": ["知识边界，即不了解或不应回答的领域"],
+  "taboo_topics": ["避免谈论的话题"],
+  "example_utterances": ["体现其风格的代表性发言"]
+}
+其中 expertise_domains、traits 和 speaking_style 不能为空。`
+
+// generatePersona 通过 JSON 模式生成并校验结构化人格，结果无效时重试
+// 同时返回生成有效人格的那次调用结果，其中记录了实际使用的提供方与模型
+func generatePersona(ctx context.Context, name, coreTraits string, sampling llm.Sampling) (*Persona, *llm.ChatResponse, error) {
+	messages := []llm.Message{
+		{Role: llm.RoleSystem, Content: personaSystemPrompt},
+		{Role: llm.RoleUser, Content: fmt.Sprintf("请为名为[%s]的智能体生成人格，核心特质是：[%s]", name, coreTraits)},
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= maxPersonaAttempts; attempt++ {
+		// 缓存中的人格无效时，重试跳过缓存并用新结果覆盖它
+		if attempt > 1 && cacheModeFromContext(ctx) == cacheReadWrite {
+			ctx = withCacheMode(ctx, cacheRefresh)
+		}
+		resp, err := chatLLM(ctx, llm.ChatRequest{Sampling: sampling, Messages: messages, JSONMode: true}, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		persona, err := parsePersona(resp.Content, coreTraits)
+		if err == nil {
+			return persona, resp, nil
+		}
+		lastErr = err
+		logger.Warn("生成的人格无效",
+			zap.String("name", name),
+			zap.Int("attempt", attempt),
+			zap.Error(err))
+	}
+	return nil, nil, fmt.Errorf("generate persona failed: %v", lastErr)
+}
+
+// parsePersona 解析模型输出的人格 JSON，缺少特质时使用核心特质补全
+func parsePersona(content, coreTraits string) (*Persona, error) {
+	var persona Persona
+	if err := json.Unmarshal([]byte(strings.TrimSpace(content)), &persona); err != nil {
+		return nil, fmt.Errorf("invalid persona json: %v", err)
+	}
+	persona.Normalize()
+	if len(persona.Traits) == 0 {
+		persona.Traits = store.SplitTraits(coreTraits)
+	}
+	if err := persona.Validate(); err != nil {
+		return nil, err
+	}
+	return &persona, nil
+}
+
+// renderPersona 将结构化人格渲染为系统提示词中的人格描述
+func renderPersona(p *Persona) string {
+	var b strings.Builder
+	section := func(title string, items []string) {
+		if len(items) == 0 {
+			return
+		}
+		fmt.Fprintf(&b, "%s：%s\n", title, strings.Join(items, "、"))
+	}
+
+	section("专业领域", p.ExpertiseDomains)
+	section("性格特质", p.Traits)
+	fmt.Fprintf(&b, "说话风格：%s\n", p.SpeakingStyle)
+	section("价值观", p.Values)
+	section("知识边界（超出范围时坦诚说明）", p.KnowledgeBoundaries)
+	section("避免谈论的话题", p.TabooTopics)
+	if len(p.ExampleUtterances) > 0 {
+		b.WriteString("代表性发言：\n")
+		for _, u := range p.ExampleUtterances {
+			fmt.Fprintf(&b, "- %s\n", u)
+		}
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// agentSystemPrompt 构建智能体作答时的系统提示词，优先使用结构化人格
+func agentSystemPrompt(agent Agent) string {
+	if agent.Persona != nil {
+		return fmt.Sprintf("你现在扮演一个%s。\n%s", agent.Name, renderPersona(agent.Persona))
+	}
+	return fmt.Sprintf("你现在扮演一个%s。%s", agent.Name, agent.Personality)
+}
+
+// personaPatch 工具参数中对结构化人格的局部修改，nil 表示不修改该字段
+type personaPatch struct {
+	ExpertiseDomains    *[]string `json:"expertise_domains"`
+	Traits              *[]string `json:"traits"`
+	SpeakingStyle       *string   `json:"speaking_style"`
+	Values              *[]string `json:"values"`
+	KnowledgeBoundaries *[]string `json:"knowledge_boundaries"`
+	TabooTopics         *[]string `json:"taboo_topics"`
+	ExampleUtterances   *[]string `json:"example_utterances"`
+}
+
+// parsePersonaPatch 解析工具参数中的人格修改，拒绝未知字段
+func parsePersonaPatch(args map[string]interface{}, key string) (*personaPatch, error) {
+	v, ok := args[key]
+	if !ok || v == nil {
+		return nil, nil
+	}
+	if _, ok := v.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("%s must be an object", key)
+	}
+
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", key, err)
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var patch personaPatch
+	if err := dec.Decode(&patch); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", key, err)
+	}
+	return &patch, nil
+}
+
+// apply 在已有人格（可以为 nil）的基础上应用修改，返回校验通过的新人格
+func (p *personaPatch) apply(base *Persona) (*Persona, error) {
+	persona := base.Clone()
+	if persona == nil {
+		persona = &Persona{}
+	}
+
+	setList := func(dst *[]string, src *[]string) {
+		if src != nil {
+			*dst = *src
+		}
+	}
+	setList(&persona.ExpertiseDomains, p.ExpertiseDomains)
+	setList(&persona.Traits, p.Traits)
+	if p.SpeakingStyle != nil {
+		persona.SpeakingStyle = *p.SpeakingStyle
+	}
+	setList(&persona.Values, p.Values)
+	setList(&persona.KnowledgeBoundaries, p.KnowledgeBoundaries)
+	setList(&persona.TabooTopics, p.TabooTopics)
+	setList(&persona.ExampleUtterances, p.ExampleUtterances)
+
+	persona.Normalize()
+	if err := persona.Validate(); err != nil {
+		return nil, err
+	}
+	return persona, nil
+}
@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"agent-forge/internal/logger"
+	"agent-forge/internal/store"
+
+	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.uber.org/zap"
+)
+
+// exportAgent 将智能体序列化为人格文件
+func exportAgent(agentID, format string) ([]byte, error) {
+	if format != "" && format != store.FormatYAML && format != store.FormatJSON {
+		return nil, fmt.Errorf("format must be %s or %s", store.FormatYAML, store.FormatJSON)
+	}
+
+	agent, err := getStoredAgent(agentID)
+	if err != nil {
+		return nil, err
+	}
+	return store.MarshalPersonaFile(agent, format)
+}
+
+// importAgent 解析人格文件并按冲突处理方式导入，返回导入后的智能体以及是否覆盖了已有智能体
+func importAgent(data []byte, onConflict string) (Agent, bool, error) {
+	policy, err := store.ParseConflictPolicy(onConflict)
+	if err != nil {
+		return Agent{}, false, err
+	}
+
+	agent, err := store.UnmarshalPersonaFile(data)
+	if err != nil {
+		return Agent{}, false, err
+	}
+	if agent.CreatedAt == "" {
+		agent.CreatedAt = time.Now().Format(time.RFC3339)
+	}
+
+	return agents.Import(*agent, policy, func() string { return uuid.New().String() })
+}
+
+// 导出智能体处理函数
+func exportAgentHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	agentID, ok := request.GetArguments()["agent_id"].(string)
+	if !ok {
+		return nil, errors.New("agent_id must be a string")
+	}
+	format, _ := request.GetArguments()["format"].(string)
+
+	data, err := exportAgent(agentID, format)
+	if err != nil {
+		return nil, err
+	}
+
+	return mcp.NewToolResultText(string(data)), nil
+}
+
+// 导入智能体处理函数
+func importAgentHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	log := logger.GetLogger()
+
+	content, ok := request.GetArguments()["content"].(string)
+	if !ok || content == "" {
+		return nil, errors.New("content must be a non-empty string")
+	}
+	onConflict, _ := request.GetArguments()["on_conflict"].(string)
+
+	agent, replaced, err := importAgent([]byte(content), onConflict)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Info("导入智能体",
+		zap.String("agent_id", agent.ID),
+		zap.String("name", agent.Name),
+		zap.Bool("replaced", replaced))
+
+	result := map[string]interface{}{
+		"status":   "success",
+		"message":  "智能体导入成功",
+		"agent_id": agent.ID,
+		"name":     agent.Name,
+		"replaced": replaced,
+	}
+
+	jsonResponse, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("marshal response failed: %v", err)
+	}
+
+	return mcp.NewToolResultText(string(jsonResponse)), nil
+}
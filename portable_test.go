@@ -0,0 +1,97 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"agent-forge/internal/config"
+	"agent-forge/internal/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImportAgentTools(t *testing.T) {
+	agents = store.NewRegistry(store.NewMemoryStore())
+	require.NoError(t, agents.Create(Agent{ID: "a1", Name: "经济学家", CoreTraits: "理性", Personality: "审慎"}))
+	ctx := context.Background()
+
+	result, err := exportAgentHandler(ctx, newToolRequest("export_agent", map[string]interface{}{
+		"agent_id": "a1",
+	}))
+	require.NoError(t, err)
+	content := toolResultText(t, result)
+	assert.Contains(t, content, "kind: agent-forge/persona")
+
+	// 同一ID已存在时默认拒绝导入
+	_, err = importAgentHandler(ctx, newToolRequest("import_agent", map[string]interface{}{
+		"content": content,
+	}))
+	assert.Error(t, err)
+
+	result, err = importAgentHandler(ctx, newToolRequest("import_agent", map[string]interface{}{
+		"content":     content,
+		"on_conflict": "copy",
+	}))
+	require.NoError(t, err)
+	data := toolResultJSON(t, result)
+	assert.Equal(t, "经济学家 (2)", data["name"])
+	assert.Equal(t, false, data["replaced"])
+	assert.NotEqual(t, "a1", data["agent_id"])
+
+	copied, err := getStoredAgent(data["agent_id"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, "审慎", copied.Personality)
+}
+
+func TestExportImportSubcommands(t *testing.T) {
+	agents = store.NewRegistry(store.NewMemoryStore())
+	require.NoError(t, agents.Create(Agent{ID: "a1", Name: "经济学家", CoreTraits: "理性"}))
+	path := filepath.Join(t.TempDir(), "economist.json")
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, runSubcommand(cmdExport, []string{"-o", path, "a1"}, &stdout, &stderr))
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Contains(t, string(data), `"kind": "agent-forge/persona"`)
+
+	// 导入到一个新的存储中
+	agents = store.NewRegistry(store.NewMemoryStore())
+	stdout.Reset()
+	assert.Equal(t, 0, runSubcommand(cmdImport, []string{path}, &stdout, &stderr))
+	assert.Contains(t, stdout.String(), "经济学家")
+	agent, err := getStoredAgent("a1")
+	require.NoError(t, err)
+	assert.Equal(t, "理性", agent.CoreTraits)
+
+	// 冲突时返回非零退出码
+	stderr.Reset()
+	assert.Equal(t, 1, runSubcommand(cmdImport, []string{path}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "conflict")
+
+	assert.Equal(t, 0, runSubcommand(cmdImport, []string{"-on-conflict", "replace", path}, &stdout, &stderr))
+	assert.Equal(t, 1, runSubcommand(cmdExport, []string{"missing"}, &stdout, &stderr))
+}
+
+func TestImportSubcommandRejectsMemoryStore(t *testing.T) {
+	agents = store.NewRegistry(store.NewMemoryStore())
+	path := filepath.Join(t.TempDir(), "economist.json")
+	require.NoError(t, os.WriteFile(path, []byte(`{"kind":"agent-forge/persona","version":1,"agent":{"name":"经济学家","personality":"审慎"}}`), 0o644))
+
+	cfg := config.GetConfig()
+	prev := cfg.Store.Backend
+	cfg.Store.Backend = "memory"
+	t.Cleanup(func() { cfg.Store.Backend = prev })
+
+	// 导入到内存存储不会生效，直接失败而不是报告成功
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 1, runSubcommand(cmdImport, []string{path}, &stdout, &stderr))
+	assert.Contains(t, stderr.String(), "store.backend")
+	assert.Empty(t, stdout.String())
+	list, err := agents.List()
+	require.NoError(t, err)
+	assert.Empty(t, list)
+}
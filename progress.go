@@ -0,0 +1,42 @@
+package main
+
+import (
+	"context"
+	"unicode/utf8"
+
+	"agent-forge/internal/logger"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"go.uber.org/zap"
+)
+
+// progressNotificationMethod MCP 进度通知的方法名
+const progressNotificationMethod = "notifications/progress"
+
+// progressNotifier 返回一个将流式增量内容转发为 MCP 进度通知的回调。
+// 调用方未提供 progressToken 或上下文中没有 MCP 服务时返回 nil，此时不使用流式输出。
+func progressNotifier(ctx context.Context, request mcp.CallToolRequest) func(delta string) {
+	if request.Params.Meta == nil || request.Params.Meta.ProgressToken == nil {
+		return nil
+	}
+	srv := server.ServerFromContext(ctx)
+	if srv == nil {
+		return nil
+	}
+
+	token := request.Params.Meta.ProgressToken
+	progress := 0
+	return func(delta string) {
+		// progress 为已生成的字符数，保证每次通知单调递增
+		progress += utf8.RuneCountInString(delta)
+		err := srv.SendNotificationToClient(ctx, progressNotificationMethod, map[string]any{
+			"progressToken": token,
+			"progress":      progress,
+			"message":       delta,
+		})
+		if err != nil {
+			logger.Debug("发送进度通知失败", zap.Error(err))
+		}
+	}
+}
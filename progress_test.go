@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"agent-forge/internal/store"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeClientSession 收集服务端发给客户端的通知
+type fakeClientSession struct {
+	notifications chan mcp.JSONRPCNotification
+}
+
+func (s *fakeClientSession) Initialize()       {}
+func (s *fakeClientSession) Initialized() bool { return true }
+func (s *fakeClientSession) SessionID() string { return "test-session" }
+func (s *fakeClientSession) NotificationChannel() chan<- mcp.JSONRPCNotification {
+	return s.notifications
+}
+
+func TestAnswerStreamsProgress(t *testing.T) {
+	requests := useFakeLLM(t, "流式回答")
+	agents = store.NewRegistry(store.NewMemoryStore())
+	require.NoError(t, agents.Create(Agent{ID: "a1", Name: "哲学家", Personality: "深思"}))
+
+	srv := server.NewMCPServer("测试服务器", "1.0.0", server.WithToolCapabilities(true))
+	srv.AddTool(mcp.NewTool("agent_answer"), answerToolHandler)
+
+	session := &fakeClientSession{notifications: make(chan mcp.JSONRPCNotification, 16)}
+	require.NoError(t, srv.RegisterSession(context.Background(), session))
+	ctx := srv.WithContext(context.Background(), session)
+
+	message := srv.HandleMessage(ctx, []byte(`{
+		"jsonrpc": "2.0",
+		"id": 1,
+		"method": "tools/call",
+		"params": {
+			"name": "agent_answer",
+			"arguments": {"agent_id": "a1", "context": "什么是自由？"},
+			"_meta": {"progressToken": "answer-1"}
+		}
+	}`))
+
+	response, ok := message.(mcp.JSONRPCResponse)
+	require.True(t, ok, "unexpected response: %#v", message)
+	result, ok := response.Result.(mcp.CallToolResult)
+	require.True(t, ok)
+	data := toolResultJSON(t, &result)
+	assert.Equal(t, "流式回答", data["content"])
+	assert.True(t, requests.last().Stream)
+
+	// 每个字符对应一条进度通知，progress 单调递增
+	close(session.notifications)
+	var deltas string
+	progress := 0.0
+	for n := range session.notifications {
+		assert.Equal(t, progressNotificationMethod, n.Method)
+		raw, err := json.Marshal(n.Params.AdditionalFields)
+		require.NoError(t, err)
+		var params mcp.ProgressNotificationParams
+		require.NoError(t, json.Unmarshal(raw, &params))
+		assert.Equal(t, "answer-1", params.ProgressToken)
+		assert.Greater(t, params.Progress, progress)
+		progress = params.Progress
+		deltas += params.Message
+	}
+	assert.Equal(t, "流式回答", deltas)
+}
+
+func TestAnswerWithoutProgressToken(t *testing.T) {
+	requests := useFakeLLM(t, "普通回答")
+	agents = store.NewRegistry(store.NewMemoryStore())
+	require.NoError(t, agents.Create(Agent{ID: "a1", Name: "哲学家"}))
+
+	result, err := answerToolHandler(context.Background(), newToolRequest("agent_answer", map[string]interface{}{
+		"agent_id": "a1",
+		"context":  "问题",
+	}))
+	require.NoError(t, err)
+	assert.Equal(t, "普通回答", toolResultJSON(t, result)["content"])
+	assert.False(t, requests.last().Stream)
+}
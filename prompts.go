@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"agent-forge/internal/store"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// agentPromptPrefix 智能体提示词名称的前缀
+const agentPromptPrefix = "agent/"
+
+// agentPrompts 为每个智能体维护一个同名的 MCP 提示词，随智能体的创建、更新和删除同步
+type agentPrompts struct {
+	mu     sync.Mutex
+	server *server.MCPServer
+	names  map[string]string // 智能体ID -> 提示词名称
+	owners map[string]string // 提示词名称 -> 智能体ID
+}
+
+// registerAgentPrompts 将已有智能体注册为提示词，并订阅注册表变更
+func registerAgentPrompts(s *server.MCPServer) error {
+	p := &agentPrompts{
+		server: s,
+		names:  make(map[string]string),
+		owners: make(map[string]string),
+	}
+
+	// 先订阅再加载已有智能体，避免遗漏启动期间的变更
+	agents.Subscribe(p.handleChange)
+
+	list, err := agents.List()
+	if err != nil {
+		return fmt.Errorf("load agents failed: %v", err)
+	}
+	for _, agent := range list {
+		p.put(agent)
+	}
+	return nil
+}
+
+// handleChange 根据注册表变更增删提示词
+func (p *agentPrompts) handleChange(event store.ChangeEvent) {
+	switch event.Type {
+	case store.AgentCreated, store.AgentUpdated:
+		p.put(event.Agent)
+	case store.AgentDeleted:
+		p.remove(event.Agent.ID)
+	}
+}
+
+// put 注册或更新智能体的提示词，名称变化时移除旧提示词
+func (p *agentPrompts) put(agent Agent) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	name := agentPromptPrefix + agent.Name
+	// 名称已被其他智能体占用时，追加ID前缀区分
+	if owner, ok := p.owners[name]; ok && owner != agent.ID {
+		name = fmt.Sprintf("%s-%s", name, shortID(agent.ID))
+	}
+
+	if old, ok := p.names[agent.ID]; ok && old != name {
+		p.server.DeletePrompts(old)
+		delete(p.owners, old)
+	}
+	p.names[agent.ID] = name
+	p.owners[name] = agent.ID
+
+	prompt := mcp.NewPrompt(name,
+		mcp.WithPromptDescription(fmt.Sprintf("扮演智能体[%s]回答问题，核心特质：%s", agent.Name, agent.CoreTraits)),
+		mcp.WithArgument("question",
+			mcp.ArgumentDescription("要向该智能体提出的问题"),
+			mcp.RequiredArgument(),
+		),
+	)
+	p.server.AddPrompt(prompt, agentPromptHandler(agent.ID))
+}
+
+// remove 移除智能体的提示词
+func (p *agentPrompts) remove(agentID string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	name, ok := p.names[agentID]
+	if !ok {
+		return
+	}
+	p.server.DeletePrompts(name)
+	delete(p.names, agentID)
+	delete(p.owners, name)
+}
+
+// agentPromptHandler 返回智能体提示词的处理函数，每次调用时读取智能体的最新定义
+func agentPromptHandler(agentID string) server.PromptHandlerFunc {
+	return func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		question, ok := request.Params.Arguments["question"]
+		if !ok || question == "" {
+			return nil, fmt.Errorf("missing question")
+		}
+
+		agent, err := getStoredAgent(agentID)
+		if err != nil {
+			return nil, err
+		}
+
+		messages := []mcp.PromptMessage{
+			mcp.NewPromptMessage(
+				RoleSystem,
+				mcp.NewTextContent(agentSystemPrompt(agent)),
+			),
+			mcp.NewPromptMessage(
+				RoleUser,
+				mcp.NewTextContent(question),
+			),
+		}
+
+		return mcp.NewGetPromptResult(
+			agent.Name,
+			messages,
+		), nil
+	}
+}
+
+// shortID 返回ID的前8位，用于区分同名智能体
+func shortID(id string) string {
+	if len(id) > 8 {
+		return id[:8]
+	}
+	return id
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"agent-forge/internal/store"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// listPromptNames 通过 MCP 服务列出所有提示词名称
+func listPromptNames(t *testing.T, srv *server.MCPServer) []string {
+	t.Helper()
+	response, ok := srv.HandleMessage(context.Background(), []byte(`{"jsonrpc":"2.0","id":1,"method":"prompts/list"}`)).(mcp.JSONRPCResponse)
+	require.True(t, ok)
+	result, ok := response.Result.(mcp.ListPromptsResult)
+	require.True(t, ok)
+	names := make([]string, 0, len(result.Prompts))
+	for _, prompt := range result.Prompts {
+		names = append(names, prompt.Name)
+	}
+	return names
+}
+
+func TestAgentPrompts(t *testing.T) {
+	agents = store.NewRegistry(store.NewMemoryStore())
+	require.NoError(t, agents.Create(Agent{ID: "a1", Name: "哲学家", Personality: "深思"}))
+
+	srv := server.NewMCPServer("测试服务器", "1.0.0", server.WithPromptCapabilities(true))
+	require.NoError(t, registerAgentPrompts(srv))
+	assert.ElementsMatch(t, []string{"agent/哲学家"}, listPromptNames(t, srv))
+
+	// 新建同名智能体时使用ID前缀区分
+	require.NoError(t, agents.Create(Agent{ID: "b2c3d4e5f6", Name: "哲学家"}))
+	assert.ElementsMatch(t, []string{"agent/哲学家", "agent/哲学家-b2c3d4e5"}, listPromptNames(t, srv))
+
+	// 提示词返回智能体的系统提示词和问题
+	request, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      2,
+		"method":  "prompts/get",
+		"params": map[string]interface{}{
+			"name":      "agent/哲学家",
+			"arguments": map[string]string{"question": "什么是自由？"},
+		},
+	})
+	require.NoError(t, err)
+	response, ok := srv.HandleMessage(context.Background(), request).(mcp.JSONRPCResponse)
+	require.True(t, ok)
+	result, ok := response.Result.(mcp.GetPromptResult)
+	require.True(t, ok)
+	require.Len(t, result.Messages, 2)
+	assert.Equal(t, "你现在扮演一个哲学家。深思", result.Messages[0].Content.(mcp.TextContent).Text)
+	assert.Equal(t, "什么是自由？", result.Messages[1].Content.(mcp.TextContent).Text)
+
+	// 改名后旧提示词被替换，删除后提示词被移除
+	_, err = agents.Update("a1", func(agent *Agent) error {
+		agent.Name = "思想家"
+		return nil
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"agent/思想家", "agent/哲学家-b2c3d4e5"}, listPromptNames(t, srv))
+
+	require.NoError(t, agents.Delete("b2c3d4e5f6"))
+	assert.ElementsMatch(t, []string{"agent/思想家"}, listPromptNames(t, srv))
+}
@@ -0,0 +1,456 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+
+	"agent-forge/internal/llm"
+	"agent-forge/internal/logger"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.uber.org/zap"
+)
+
+// 推荐使用的相关度计算方式
+const (
+	recommendByEmbedding = "embedding"
+	recommendByTFIDF     = "tfidf"
+)
+
+// 推荐数量
+const (
+	defaultRecommendTopK = 5
+	maxRecommendTopK     = 20
+)
+
+// maxReasonKeywords 推荐理由中最多列出的关键词数量
+const maxReasonKeywords = 5
+
+// 单次 embeddings 请求的输入上限，提供方通常限制每次请求的条数和总 token 数
+const (
+	maxEmbeddingBatchSize  = 64    // 每批最多的文本条数
+	maxEmbeddingBatchChars = 16000 // 每批文本的总字符数上限，单条超出时单独成批
+)
+
+// agentRecommendation 单个推荐结果
+type agentRecommendation struct {
+	ID         string   `json:"id"`
+	Name       string   `json:"name"`
+	CoreTraits string   `json:"core_traits"`
+	Score      float64  `json:"score"`
+	Reasons    []string `json:"reasons"`
+}
+
+// embeddingCache 按智能体ID缓存文档向量，人格未变化时无需重复计算
+// 条目记录计算时的向量模型与文本摘要，二者之一变化时视为失效并原地替换
+var embeddingCache = struct {
+	sync.Mutex
+	entries map[string]embeddingEntry
+}{entries: make(map[string]embeddingEntry)}
+
+// embeddingEntry 单个智能体的缓存向量
+type embeddingEntry struct {
+	key    string // 提供方、向量模型与文档摘要
+	vector []float32
+}
+
+// agentDocument 拼接用于检索的智能体文本
+func agentDocument(agent Agent) string {
+	parts := []string{agent.Name, agent.CoreTraits}
+	if agent.Persona != nil {
+		parts = append(parts, agent.Persona.ExpertiseDomains...)
+		parts = append(parts, agent.Persona.Traits...)
+		parts = append(parts, agent.Persona.Values...)
+		parts = append(parts, agent.Persona.SpeakingStyle)
+	}
+	parts = append(parts, agent.Tags...)
+	parts = append(parts, agent.Personality)
+	return strings.Join(parts, "\n")
+}
+
+// tokenize 将文本切分为检索词：英文和数字按单词切分，中文使用单字与相邻二字组合
+func tokenize(text string) []string {
+	var tokens []string
+	var word []rune
+	var han []rune
+
+	flushWord := func() {
+		if len(word) > 0 {
+			tokens = append(tokens, string(word))
+			word = word[:0]
+		}
+	}
+	flushHan := func() {
+		for i := range han {
+			tokens = append(tokens, string(han[i]))
+			if i+1 < len(han) {
+				tokens = append(tokens, string(han[i:i+2]))
+			}
+		}
+		han = han[:0]
+	}
+
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			flushWord()
+			han = append(han, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			flushHan()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushHan()
+		}
+	}
+	flushWord()
+	flushHan()
+	return tokens
+}
+
+// termFrequencies 统计检索词出现的次数
+func termFrequencies(tokens []string) map[string]float64 {
+	tf := make(map[string]float64, len(tokens))
+	for _, t := range tokens {
+		tf[t]++
+	}
+	return tf
+}
+
+// tfidfScores 计算主题与每个文档的 TF-IDF 余弦相似度，同时返回逆文档频率供生成推荐理由
+func tfidfScores(topic string, docs []string) ([]float64, map[string]float64) {
+	docTF := make([]map[string]float64, len(docs))
+	df := make(map[string]float64)
+	for i, doc := range docs {
+		docTF[i] = termFrequencies(tokenize(doc))
+		for t := range docTF[i] {
+			df[t]++
+		}
+	}
+
+	n := float64(len(docs))
+	idf := make(map[string]float64, len(df))
+	for t, count := range df {
+		idf[t] = math.Log((n+1)/(count+1)) + 1
+	}
+
+	weigh := func(tf map[string]float64) map[string]float64 {
+		v := make(map[string]float64, len(tf))
+		for t, count := range tf {
+			if w, ok := idf[t]; ok {
+				v[t] = (1 + math.Log(count)) * w
+			}
+		}
+		return v
+	}
+
+	query := weigh(termFrequencies(tokenize(topic)))
+	scores := make([]float64, len(docs))
+	for i := range docs {
+		scores[i] = sparseCosine(query, weigh(docTF[i]))
+	}
+	return scores, idf
+}
+
+// sparseCosine 计算稀疏向量的余弦相似度
+func sparseCosine(a, b map[string]float64) float64 {
+	var dot, normA, normB float64
+	for t, w := range a {
+		normA += w * w
+		dot += w * b[t]
+	}
+	for _, w := range b {
+		normB += w * w
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// cosine 计算稠密向量的余弦相似度
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// embeddingProvider 返回配置了向量模型的提供方
+func embeddingProvider() (llm.EmbeddingProvider, bool) {
+	if llmProviders == nil {
+		return nil, false
+	}
+	return llmProviders.Embedder()
+}
+
+// embeddingScores 通过提供方的 embeddings 接口计算主题与每个文档的相似度，ids 为文档对应的智能体ID
+// 文档向量按智能体缓存，只为新增或变化的文档请求接口；缓存只逐条更新，并清理已不存在的智能体，
+// 并发的推荐请求不会互相清空对方计算的向量
+func embeddingScores(ctx context.Context, topic string, ids, docs []string) ([]float64, error) {
+	embedder, ok := embeddingProvider()
+	if !ok {
+		return nil, errors.New("no provider with an embedding model configured")
+	}
+
+	keys := make([]string, len(docs))
+	vectors := make([][]float32, len(docs))
+	var missing []string
+	var missingIdx []int
+
+	embeddingCache.Lock()
+	for i, doc := range docs {
+		sum := sha256.Sum256([]byte(doc))
+		keys[i] = embedder.Name() + "/" + embedder.EmbeddingModel() + "/" + hex.EncodeToString(sum[:])
+		if entry, ok := embeddingCache.entries[ids[i]]; ok && entry.key == keys[i] {
+			vectors[i] = entry.vector
+		} else {
+			missing = append(missing, doc)
+			missingIdx = append(missingIdx, i)
+		}
+	}
+	embeddingCache.Unlock()
+
+	// 智能体较多或缓存为空时分批请求，避免超出提供方的输入限制
+	texts := append([]string{topic}, missing...)
+	result := make([][]float32, 0, len(texts))
+	for _, batch := range embeddingBatches(texts) {
+		vectors, p, usage, err := llmProviders.Embed(ctx, batch)
+		if err != nil {
+			return nil, err
+		}
+		recordEmbeddingUsage(ctx, p, usage)
+		result = append(result, vectors...)
+	}
+	topicVector := result[0]
+
+	current := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		current[id] = true
+	}
+	embeddingCache.Lock()
+	for j, i := range missingIdx {
+		vectors[i] = result[j+1]
+		embeddingCache.entries[ids[i]] = embeddingEntry{key: keys[i], vector: vectors[i]}
+	}
+	for id := range embeddingCache.entries {
+		if !current[id] {
+			delete(embeddingCache.entries, id)
+		}
+	}
+	embeddingCache.Unlock()
+
+	scores := make([]float64, len(docs))
+	for i := range docs {
+		scores[i] = cosine(topicVector, vectors[i])
+	}
+	return scores, nil
+}
+
+// embeddingBatches 按条数和总字符数将文本分批，保持原有顺序
+func embeddingBatches(texts []string) [][]string {
+	var batches [][]string
+	var batch []string
+	chars := 0
+	for _, text := range texts {
+		n := utf8.RuneCountInString(text)
+		if len(batch) > 0 && (len(batch) >= maxEmbeddingBatchSize || chars+n > maxEmbeddingBatchChars) {
+			batches = append(batches, batch)
+			batch, chars = nil, 0
+		}
+		batch = append(batch, text)
+		chars += n
+	}
+	if len(batch) > 0 {
+		batches = append(batches, batch)
+	}
+	return batches
+}
+
+// recommendReasons 生成推荐理由：列出与主题相关的人格字段，其次是重要的共同关键词
+func recommendReasons(agent Agent, topic string, idf map[string]float64, method string, score float64) []string {
+	topicTokens := make(map[string]bool)
+	for _, t := range tokenize(topic) {
+		topicTokens[t] = true
+	}
+	related := func(item string) bool {
+		for _, t := range tokenize(item) {
+			// 单个汉字区分度太低，只用二字组合和单词判断相关
+			if topicTokens[t] && (len([]rune(t)) > 1 || !unicode.Is(unicode.Han, []rune(t)[0])) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var reasons []string
+	section := func(title string, items []string) {
+		var matched []string
+		for _, item := range items {
+			if related(item) {
+				matched = append(matched, item)
+			}
+		}
+		if len(matched) > 0 {
+			reasons = append(reasons, fmt.Sprintf("%s与主题相关：%s", title, strings.Join(matched, "、")))
+		}
+	}
+	if agent.Persona != nil {
+		section("专业领域", agent.Persona.ExpertiseDomains)
+		section("性格特质", agent.Persona.Traits)
+		section("价值观", agent.Persona.Values)
+	}
+	section("核心特质", []string{agent.CoreTraits})
+	section("标签", agent.Tags)
+
+	if len(reasons) == 0 && idf != nil {
+		docTokens := make(map[string]bool)
+		for _, t := range tokenize(agentDocument(agent)) {
+			docTokens[t] = true
+		}
+		var shared []string
+		for t := range topicTokens {
+			if docTokens[t] && len([]rune(t)) > 1 {
+				shared = append(shared, t)
+			}
+		}
+		sort.Slice(shared, func(i, j int) bool {
+			if idf[shared[i]] != idf[shared[j]] {
+				return idf[shared[i]] > idf[shared[j]]
+			}
+			return shared[i] < shared[j]
+		})
+		if len(shared) > maxReasonKeywords {
+			shared = shared[:maxReasonKeywords]
+		}
+		if len(shared) > 0 {
+			reasons = append(reasons, fmt.Sprintf("人格描述中包含主题关键词：%s", strings.Join(shared, "、")))
+		}
+	}
+
+	if method == recommendByEmbedding {
+		reasons = append(reasons, fmt.Sprintf("人格与主题的语义相似度为 %.2f", score))
+	}
+	return reasons
+}
+
+// recommendAgents 返回与主题最相关的 topK 个智能体
+// 配置了向量模型时使用 embeddings 计算语义相似度，否则（或接口调用失败时）使用本地 TF-IDF
+func recommendAgents(ctx context.Context, topic string, topK int, minScore float64) ([]agentRecommendation, string, error) {
+	list, err := agents.List()
+	if err != nil {
+		return nil, "", fmt.Errorf("list agents failed: %v", err)
+	}
+	if len(list) == 0 {
+		return []agentRecommendation{}, recommendByTFIDF, nil
+	}
+
+	ids := make([]string, len(list))
+	docs := make([]string, len(list))
+	for i, agent := range list {
+		ids[i] = agent.ID
+		docs[i] = agentDocument(agent)
+	}
+
+	method := recommendByTFIDF
+	var scores []float64
+	if _, ok := embeddingProvider(); ok {
+		scores, err = embeddingScores(ctx, topic, ids, docs)
+		if err != nil {
+			logger.Warn("计算向量失败，改用 TF-IDF", zap.Error(err))
+		} else {
+			method = recommendByEmbedding
+		}
+	}
+	// 推荐理由中的关键词排序使用 TF-IDF 的逆文档频率
+	tfidf, idf := tfidfScores(topic, docs)
+	if method == recommendByTFIDF {
+		scores = tfidf
+	}
+
+	recommendations := make([]agentRecommendation, 0, len(list))
+	for i, agent := range list {
+		if scores[i] <= 0 || scores[i] < minScore {
+			continue
+		}
+		recommendations = append(recommendations, agentRecommendation{
+			ID:         agent.ID,
+			Name:       agent.Name,
+			CoreTraits: agent.CoreTraits,
+			Score:      math.Round(scores[i]*1e4) / 1e4,
+			Reasons:    recommendReasons(agent, topic, idf, method, scores[i]),
+		})
+	}
+	sort.SliceStable(recommendations, func(i, j int) bool {
+		return recommendations[i].Score > recommendations[j].Score
+	})
+	if len(recommendations) > topK {
+		recommendations = recommendations[:topK]
+	}
+	return recommendations, method, nil
+}
+
+// 推荐智能体处理函数
+func recommendAgentsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+	topic, ok := args["topic"].(string)
+	if !ok || strings.TrimSpace(topic) == "" {
+		return nil, errors.New("topic must be a non-empty string")
+	}
+
+	topK := defaultRecommendTopK
+	if v, ok := args["top_k"]; ok {
+		n, ok := v.(float64)
+		if !ok || n < 1 || n > maxRecommendTopK || n != math.Trunc(n) {
+			return nil, fmt.Errorf("top_k must be an integer between 1 and %d", maxRecommendTopK)
+		}
+		topK = int(n)
+	}
+	var minScore float64
+	if v, ok := args["min_score"]; ok {
+		n, ok := v.(float64)
+		if !ok || n < 0 || n > 1 {
+			return nil, errors.New("min_score must be a number between 0 and 1")
+		}
+		minScore = n
+	}
+
+	ctx, meter := withUsageMeter(ctx)
+	recommendations, method, err := recommendAgents(ctx, topic, topK, minScore)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]interface{}{
+		"topic":  topic,
+		"method": method,
+		"agents": recommendations,
+		"usage":  meter.snapshot(),
+	}
+
+	jsonResponse, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("marshal response failed: %v", err)
+	}
+
+	return mcp.NewToolResultText(string(jsonResponse)), nil
+}
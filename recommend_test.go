@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"agent-forge/internal/config"
+	"agent-forge/internal/llm"
+	"agent-forge/internal/store"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// recommendFixture 注册用于推荐测试的智能体
+func recommendFixture(t *testing.T) {
+	t.Helper()
+	agents = store.NewRegistry(store.NewMemoryStore())
+	for _, agent := range []Agent{
+		{ID: "economist", Name: "经济学家", CoreTraits: "理性、数据驱动", Personality: "研究货币政策与通货膨胀",
+			Persona: &Persona{ExpertiseDomains: []string{"宏观经济", "货币政策"}, Traits: []string{"理性"}, SpeakingStyle: "平实"}},
+		{ID: "historian", Name: "历史学家", CoreTraits: "博学", Personality: "熟悉王朝兴衰与制度变迁"},
+		{ID: "engineer", Name: "工程师", CoreTraits: "务实", Personality: "擅长分布式系统设计", Tags: []string{"software"}},
+	} {
+		require.NoError(t, agents.Create(agent))
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	assert.Equal(t, []string{"ai", "经", "经济", "济"}, tokenize("AI 经济"))
+	assert.Equal(t, []string{"go", "1", "24"}, tokenize("Go-1.24"))
+}
+
+func TestRecommendAgentsTFIDF(t *testing.T) {
+	recommendFixture(t)
+	prev := llmProviders
+	llmProviders = nil
+	t.Cleanup(func() { llmProviders = prev })
+
+	result, err := recommendAgentsHandler(context.Background(), newToolRequest("recommend_agents", map[string]interface{}{
+		"topic": "央行的货币政策如何影响通货膨胀",
+		"top_k": float64(2),
+	}))
+	require.NoError(t, err)
+	data := toolResultJSON(t, result)
+	assert.Equal(t, recommendByTFIDF, data["method"])
+
+	list := data["agents"].([]interface{})
+	require.NotEmpty(t, list)
+	assert.LessOrEqual(t, len(list), 2)
+	top := list[0].(map[string]interface{})
+	assert.Equal(t, "economist", top["id"])
+	assert.Greater(t, top["score"], float64(0))
+	assert.Contains(t, top["reasons"], "专业领域与主题相关：货币政策")
+
+	// 与任何智能体都无关的主题不返回结果
+	result, err = recommendAgentsHandler(context.Background(), newToolRequest("recommend_agents", map[string]interface{}{
+		"topic": "quantum chromodynamics",
+	}))
+	require.NoError(t, err)
+	assert.Empty(t, toolResultJSON(t, result)["agents"])
+
+	_, err = recommendAgentsHandler(context.Background(), newToolRequest("recommend_agents", map[string]interface{}{
+		"topic": "经济",
+		"top_k": float64(0),
+	}))
+	assert.Error(t, err)
+}
+
+// keywordEmbedding 模拟向量模型：每个维度表示文本是否包含对应的关键词
+func keywordEmbedding(text string) []float32 {
+	keywords := []string{"经济", "历史", "系统"}
+	v := make([]float32, len(keywords)+1)
+	v[len(keywords)] = 0.1
+	for i, k := range keywords {
+		if strings.Contains(text, k) {
+			v[i] = 1
+		}
+	}
+	return v
+}
+
+// useFakeEmbedder 将LLM提供方指向按关键词计算向量的模拟 embeddings 服务，返回每次请求的输入
+func useFakeEmbedder(t *testing.T) *[][]string {
+	t.Helper()
+	var inputs [][]string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.True(t, strings.HasSuffix(r.URL.Path, "/embeddings"))
+		var req struct {
+			Input []string `json:"input"`
+			Model string   `json:"model"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "test-embedding", req.Model)
+		inputs = append(inputs, req.Input)
+
+		resp := openai.EmbeddingResponse{
+			Object: "list",
+			Model:  openai.EmbeddingModel(req.Model),
+			Usage:  openai.Usage{PromptTokens: 10 * len(req.Input), TotalTokens: 10 * len(req.Input)},
+		}
+		for i, text := range req.Input {
+			resp.Data = append(resp.Data, openai.Embedding{Object: "embedding", Index: i, Embedding: keywordEmbedding(text)})
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(srv.Close)
+
+	provider, err := llm.NewOpenAICompatible(config.ProviderConfig{
+		Name:           "fake",
+		BaseURL:        srv.URL,
+		APIKey:         "test-key",
+		Model:          "deepseek-chat",
+		EmbeddingModel: "test-embedding",
+	})
+	require.NoError(t, err)
+	registry, err := llm.NewRegistry("fake", provider)
+	require.NoError(t, err)
+	prev := llmProviders
+	llmProviders = registry
+	t.Cleanup(func() { llmProviders = prev })
+	return &inputs
+}
+
+func TestRecommendAgentsEmbedding(t *testing.T) {
+	recommendFixture(t)
+	useUsagePrices(t)
+	requests := useFakeEmbedder(t)
+
+	recommendations, method, err := recommendAgents(context.Background(), "历史上的制度", 1, 0)
+	require.NoError(t, err)
+	assert.Equal(t, recommendByEmbedding, method)
+	require.Len(t, recommendations, 1)
+	assert.Equal(t, "historian", recommendations[0].ID)
+	assert.NotEmpty(t, recommendations[0].Reasons)
+
+	// 智能体的向量被缓存，第二次只需计算主题的向量
+	_, _, err = recommendAgents(context.Background(), "经济走势", 3, 0)
+	require.NoError(t, err)
+	inputs := *requests
+	require.Len(t, inputs, 2)
+	assert.Len(t, inputs[0], 4)
+	assert.Equal(t, []string{"经济走势"}, inputs[1])
+
+	// embeddings 调用同样计入用量统计
+	report := buildUsageReport("", "")
+	require.Len(t, report.ByModel, 1)
+	assert.Equal(t, "fake/test-embedding", report.ByModel[0].Model)
+	assert.Equal(t, 2, report.ByModel[0].Calls)
+	assert.Equal(t, 50, report.ByModel[0].PromptTokens)
+}
+
+func TestEmbeddingCacheKeyedByAgent(t *testing.T) {
+	recommendFixture(t)
+	requests := useFakeEmbedder(t)
+
+	_, _, err := recommendAgents(context.Background(), "经济走势", 3, 0)
+	require.NoError(t, err)
+
+	// 修改一个智能体、删除另一个后，只重新计算变化的文档，已删除智能体的向量被清理
+	_, err = agents.Update("engineer", func(agent *Agent) error {
+		agent.Personality = "擅长数据库调优"
+		return nil
+	})
+	require.NoError(t, err)
+	require.NoError(t, agents.Delete("historian"))
+	_, _, err = recommendAgents(context.Background(), "经济走势", 3, 0)
+	require.NoError(t, err)
+
+	inputs := *requests
+	require.Len(t, inputs, 2)
+	require.Len(t, inputs[1], 2)
+	assert.Contains(t, inputs[1][1], "擅长数据库调优")
+
+	embeddingCache.Lock()
+	defer embeddingCache.Unlock()
+	assert.Len(t, embeddingCache.entries, 2)
+	assert.NotContains(t, embeddingCache.entries, "historian")
+}
+
+func TestRecommendAgentsEmbeddingBatches(t *testing.T) {
+	agents = store.NewRegistry(store.NewMemoryStore())
+	for i := range 150 {
+		require.NoError(t, agents.Create(Agent{ID: fmt.Sprintf("a%03d", i), Name: fmt.Sprintf("专家%d", i), Personality: "经济"}))
+	}
+	requests := useFakeEmbedder(t)
+
+	_, method, err := recommendAgents(context.Background(), "经济", 3, 0)
+	require.NoError(t, err)
+	assert.Equal(t, recommendByEmbedding, method)
+
+	// 主题与 150 个文档分批请求，每批不超过上限
+	inputs := *requests
+	require.Len(t, inputs, 3)
+	total := 0
+	for _, batch := range inputs {
+		assert.LessOrEqual(t, len(batch), maxEmbeddingBatchSize)
+		total += len(batch)
+	}
+	assert.Equal(t, 151, total)
+	assert.Equal(t, "经济", inputs[0][0])
+}
+
+func TestEmbeddingBatches(t *testing.T) {
+	long := strings.Repeat("长", maxEmbeddingBatchChars)
+	batches := embeddingBatches([]string{"a", "b", long, "c"})
+	assert.Equal(t, [][]string{{"a", "b"}, {long}, {"c"}}, batches)
+	assert.Empty(t, embeddingBatches(nil))
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"agent-forge/internal/store"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// 智能体资源的URI
+const (
+	agentResourcePrefix   = "agent://"
+	agentResourceTemplate = "agent://{id}"
+	agentsResourceURI     = "agents://"
+	resourceMIMEType      = "application/json"
+)
+
+// agentResourceURI 返回智能体资源的URI
+func agentResourceURI(agentID string) string {
+	return agentResourcePrefix + agentID
+}
+
+// agentResource 构建智能体资源的描述
+func agentResource(agent Agent) mcp.Resource {
+	return mcp.NewResource(agentResourceURI(agent.ID), agent.Name,
+		mcp.WithResourceDescription(fmt.Sprintf("智能体[%s]的完整定义，核心特质：%s", agent.Name, agent.CoreTraits)),
+		mcp.WithMIMEType(resourceMIMEType),
+	)
+}
+
+// registerAgentResources 将智能体发布为 MCP 资源，并在注册表变更时同步资源列表、通知客户端列表已变化
+func registerAgentResources(s *server.MCPServer) error {
+	s.AddResource(
+		mcp.NewResource(agentsResourceURI, "智能体列表",
+			mcp.WithResourceDescription("所有已创建的智能体"),
+			mcp.WithMIMEType(resourceMIMEType),
+		),
+		readAgentsResourceHandler,
+	)
+	s.AddResourceTemplate(
+		mcp.NewResourceTemplate(agentResourceTemplate, "智能体",
+			mcp.WithTemplateDescription("根据智能体ID读取智能体的完整定义"),
+			mcp.WithTemplateMIMEType(resourceMIMEType),
+		),
+		readAgentResourceHandler,
+	)
+
+	// 先订阅再加载已有智能体，避免遗漏启动期间的变更
+	// 服务端不支持资源订阅，不发送 resources/updated；AddResource 与 RemoveResource 会发送 list_changed，
+	// 客户端据此重新读取资源列表和内容
+	agents.Subscribe(func(event store.ChangeEvent) {
+		switch event.Type {
+		case store.AgentCreated, store.AgentUpdated:
+			s.AddResource(agentResource(event.Agent), readAgentResourceHandler)
+		case store.AgentDeleted:
+			s.RemoveResource(agentResourceURI(event.Agent.ID))
+		}
+	})
+
+	list, err := agents.List()
+	if err != nil {
+		return fmt.Errorf("load agents failed: %v", err)
+	}
+	for _, agent := range list {
+		s.AddResource(agentResource(agent), readAgentResourceHandler)
+	}
+	return nil
+}
+
+// readAgentResourceHandler 读取单个智能体资源
+func readAgentResourceHandler(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	uri := request.Params.URI
+	agentID := strings.TrimPrefix(uri, agentResourcePrefix)
+	if agentID == "" || agentID == uri {
+		return nil, fmt.Errorf("invalid agent resource uri: %s", uri)
+	}
+
+	agent, err := getStoredAgent(agentID)
+	if err != nil {
+		return nil, err
+	}
+	return jsonResourceContents(uri, agent)
+}
+
+// readAgentsResourceHandler 读取智能体列表资源
+func readAgentsResourceHandler(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+	list, err := agents.List()
+	if err != nil {
+		return nil, fmt.Errorf("list agents failed: %v", err)
+	}
+	return jsonResourceContents(request.Params.URI, map[string]interface{}{"agents": list})
+}
+
+// jsonResourceContents 将数据序列化为 JSON 文本资源内容
+func jsonResourceContents(uri string, v interface{}) ([]mcp.ResourceContents, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("marshal resource failed: %v", err)
+	}
+	return []mcp.ResourceContents{
+		mcp.TextResourceContents{
+			URI:      uri,
+			MIMEType: resourceMIMEType,
+			Text:     string(data),
+		},
+	}, nil
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"agent-forge/internal/store"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// readResource 通过 MCP 服务读取资源，返回文本内容
+func readResource(t *testing.T, srv *server.MCPServer, ctx context.Context, uri string) (string, bool) {
+	t.Helper()
+	request, err := json.Marshal(map[string]interface{}{
+		"jsonrpc": "2.0",
+		"id":      1,
+		"method":  "resources/read",
+		"params":  map[string]interface{}{"uri": uri},
+	})
+	require.NoError(t, err)
+
+	response, ok := srv.HandleMessage(ctx, request).(mcp.JSONRPCResponse)
+	if !ok {
+		return "", false
+	}
+	result, ok := response.Result.(mcp.ReadResourceResult)
+	require.True(t, ok)
+	require.Len(t, result.Contents, 1)
+	text, ok := result.Contents[0].(mcp.TextResourceContents)
+	require.True(t, ok)
+	return text.Text, true
+}
+
+// drainMethods 取出当前已发送的通知方法名
+func drainMethods(ch chan mcp.JSONRPCNotification) []string {
+	var methods []string
+	for {
+		select {
+		case n := <-ch:
+			methods = append(methods, n.Method)
+		default:
+			return methods
+		}
+	}
+}
+
+func TestAgentResources(t *testing.T) {
+	agents = store.NewRegistry(store.NewMemoryStore())
+	require.NoError(t, agents.Create(Agent{ID: "a1", Name: "哲学家", CoreTraits: "深思"}))
+
+	srv := server.NewMCPServer("测试服务器", "1.0.0", server.WithResourceCapabilities(false, true))
+	require.NoError(t, registerAgentResources(srv))
+
+	session := &fakeClientSession{notifications: make(chan mcp.JSONRPCNotification, 32)}
+	require.NoError(t, srv.RegisterSession(context.Background(), session))
+	ctx := srv.WithContext(context.Background(), session)
+
+	// 已有智能体在注册时发布为资源
+	text, ok := readResource(t, srv, ctx, "agent://a1")
+	require.True(t, ok)
+	assert.Contains(t, text, `"name":"哲学家"`)
+
+	// 新建智能体后资源列表变化；服务端未启用订阅，不发送 resources/updated
+	require.NoError(t, agents.Create(Agent{ID: "a2", Name: "工程师"}))
+	assert.Equal(t, []string{mcp.MethodNotificationResourcesListChanged}, drainMethods(session.notifications))
+	text, ok = readResource(t, srv, ctx, agentsResourceURI)
+	require.True(t, ok)
+	assert.Contains(t, text, `"id":"a2"`)
+
+	// 更新智能体时同样通过 list_changed 通知客户端重新读取
+	_, err := agents.Update("a2", func(agent *Agent) error {
+		agent.Name = "架构师"
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{mcp.MethodNotificationResourcesListChanged}, drainMethods(session.notifications))
+	text, ok = readResource(t, srv, ctx, "agent://a2")
+	require.True(t, ok)
+	assert.Contains(t, text, `"name":"架构师"`)
+
+	// 删除后资源不可再读取
+	require.NoError(t, agents.Delete("a2"))
+	assert.Equal(t, []string{mcp.MethodNotificationResourcesListChanged}, drainMethods(session.notifications))
+	_, ok = readResource(t, srv, ctx, "agent://a2")
+	assert.False(t, ok)
+}
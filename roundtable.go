@@ -0,0 +1,273 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"agent-forge/internal/llm"
+	"agent-forge/internal/logger"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.uber.org/zap"
+)
+
+// 探索流的三个阶段
+const (
+	PhaseExpression = "表达"
+	PhaseResonance  = "呼应"
+	PhaseSeeing     = "看见"
+)
+
+// passMarker 呼应阶段智能体选择不发言时返回的标记
+const passMarker = "[PASS]"
+
+// 呼应阶段轮数的默认值与上限
+const (
+	defaultResonanceRounds = 1
+	maxResonanceRounds     = 5
+)
+
+// roundTableTurn 圆桌讨论中的一次发言，附带实际生成发言的提供方与模型
+type roundTableTurn struct {
+	Phase     string `json:"phase"`
+	Round     int    `json:"round"`
+	AgentID   string `json:"agent_id"`
+	AgentName string `json:"agent_name"`
+	Content   string `json:"content"`
+	llmRoute
+}
+
+// reportPhase 主持人报告生成失败时 failed_at 中的阶段
+const reportPhase = "报告"
+
+// roundTableResult 圆桌讨论的完整结果，讨论中断时为中断前的部分结果
+type roundTableResult struct {
+	Topic      string           `json:"topic"`
+	Agents     []string         `json:"agent_ids"`
+	Transcript []roundTableTurn `json:"transcript"`
+	Report     string           `json:"report"`
+	// ReportProvider 和 ReportModel 为实际生成主持人报告的提供方与模型
+	ReportProvider string      `json:"report_provider"`
+	ReportModel    string      `json:"report_model"`
+	Usage          usageTotals `json:"usage"` // 整场讨论（包含主持人报告）的用量，讨论中断时为中断前的用量
+	// Error 和 FailedAt 为讨论中断的原因与位置，讨论完成时为空
+	Error    string             `json:"error,omitempty"`
+	FailedAt *roundTableFailure `json:"failed_at,omitempty"`
+}
+
+// roundTableFailure 讨论中断的位置：发言失败时为该次发言，主持人报告失败时阶段为 reportPhase
+type roundTableFailure struct {
+	Phase     string `json:"phase"`
+	Round     int    `json:"round,omitempty"`
+	AgentID   string `json:"agent_id,omitempty"`
+	AgentName string `json:"agent_name,omitempty"`
+}
+
+// roundTable 一场由服务端驱动的探索流讨论
+type roundTable struct {
+	topic        string
+	participants []Agent
+	transcript   []roundTableTurn
+}
+
+// run 依次执行表达、呼应、看见三个阶段，最后由主持人输出报告
+// 任一发言或主持人报告失败时停止讨论，返回错误以及包含已完成发言和中断位置的部分结果
+func (rt *roundTable) run(ctx context.Context, resonanceRounds int) (*roundTableResult, error) {
+	ids := make([]string, 0, len(rt.participants))
+	for _, agent := range rt.participants {
+		ids = append(ids, agent.ID)
+	}
+	result := &roundTableResult{Topic: rt.topic, Agents: ids}
+	fail := func(at roundTableFailure, err error) (*roundTableResult, error) {
+		result.Transcript = rt.transcript
+		result.Error = err.Error()
+		result.FailedAt = &at
+		return result, err
+	}
+	turn := func(agent Agent, phase string, round int) roundTableFailure {
+		return roundTableFailure{Phase: phase, Round: round, AgentID: agent.ID, AgentName: agent.Name}
+	}
+
+	// 表达：每人发言一次
+	for _, agent := range rt.participants {
+		if err := rt.speak(ctx, agent, PhaseExpression, 1,
+			"现在是\"表达\"阶段，请围绕主题分享你的想法和内容物，不要评判他人。"); err != nil {
+			return fail(turn(agent, PhaseExpression, 1), err)
+		}
+	}
+
+	// 呼应：自由发言，没有触动时可以保持沉默
+	for round := 1; round <= resonanceRounds; round++ {
+		for _, agent := range rt.participants {
+			if err := rt.speak(ctx, agent, PhaseResonance, round,
+				fmt.Sprintf("现在是\"呼应\"阶段第%d轮，请针对触动你的关键词进行回应，不要评判、建议或反馈。如果没有想回应的内容，请只回复 %s。", round, passMarker)); err != nil {
+				return fail(turn(agent, PhaseResonance, round), err)
+			}
+		}
+	}
+
+	// 看见：每人总结一次
+	for _, agent := range rt.participants {
+		if err := rt.speak(ctx, agent, PhaseSeeing, 1,
+			"现在是\"看见\"阶段，请识别讨论中关键词之间的关系，总结你看见的结构与觉察。"); err != nil {
+			return fail(turn(agent, PhaseSeeing, 1), err)
+		}
+	}
+
+	report, err := rt.moderatorReport(ctx)
+	if err != nil {
+		return fail(roundTableFailure{Phase: reportPhase}, err)
+	}
+
+	result.Transcript = rt.transcript
+	result.Report = report.Content
+	result.ReportProvider = report.Provider
+	result.ReportModel = report.Model
+	return result, nil
+}
+
+// speak 让智能体在指定阶段发言，并记录到讨论记录中
+func (rt *roundTable) speak(ctx context.Context, agent Agent, phase string, round int, instruction string) error {
+	systemPrompt := fmt.Sprintf("%s\n你正在参加一场主题为[%s]的探索流讨论。", agentSystemPrompt(agent), rt.topic)
+
+	resp, err := callOpenAI(withUsageAgent(ctx, agent.ID, agent.Name), agentSampling(agent), systemPrompt, instruction, rt.transcriptText())
+	if err != nil {
+		return fmt.Errorf("%s在%s阶段发言失败: %v", agent.Name, phase, err)
+	}
+	content := resp.Content
+
+	// 只有整条回复就是标记时才视为放弃发言，引用或提到标记的回应照常记录
+	if phase == PhaseResonance && strings.TrimSpace(content) == passMarker {
+		return nil
+	}
+
+	rt.transcript = append(rt.transcript, roundTableTurn{
+		Phase:     phase,
+		Round:     round,
+		AgentID:   agent.ID,
+		AgentName: agent.Name,
+		Content:   content,
+		llmRoute:  routeOf(resp),
+	})
+	return nil
+}
+
+// moderatorReport 主持人根据完整讨论记录输出探索流报告
+func (rt *roundTable) moderatorReport(ctx context.Context) (*llm.ChatResponse, error) {
+	systemPrompt := "你是探索流的主持人。探索流的规则如下：\n" + explorationFlowRules
+	question := fmt.Sprintf("讨论已经结束，请你作为主持人对主题[%s]进行最终的收敛总结，输出一篇探索流报告。", rt.topic)
+
+	report, err := callOpenAI(ctx, llm.Sampling{}, systemPrompt, question, rt.transcriptText())
+	if err != nil {
+		return nil, fmt.Errorf("生成探索流报告失败: %v", err)
+	}
+	return report, nil
+}
+
+// transcriptText 将讨论记录整理为上下文文本
+func (rt *roundTable) transcriptText() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "讨论主题：%s\n", rt.topic)
+	if len(rt.transcript) == 0 {
+		b.WriteString("目前还没有人发言。")
+		return b.String()
+	}
+	b.WriteString("已有发言：\n")
+	for _, turn := range rt.transcript {
+		fmt.Fprintf(&b, "[%s] %s：%s\n", turn.Phase, turn.AgentName, turn.Content)
+	}
+	return b.String()
+}
+
+// stringSliceArg 读取字符串数组参数，忽略空字符串与重复项
+func stringSliceArg(args map[string]interface{}, key string) ([]string, error) {
+	raw, ok := args[key]
+	if !ok {
+		return nil, nil
+	}
+	items, ok := raw.([]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%s must be an array of strings", key)
+	}
+
+	seen := make(map[string]bool, len(items))
+	values := make([]string, 0, len(items))
+	for _, item := range items {
+		value, ok := item.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s must be an array of strings", key)
+		}
+		if value == "" || seen[value] {
+			continue
+		}
+		seen[value] = true
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// 服务端圆桌讨论处理函数
+func runRoundTableHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	log := logger.GetLogger()
+
+	topic, ok := request.GetArguments()["topic"].(string)
+	if !ok || topic == "" {
+		return nil, errors.New("topic must be a non-empty string")
+	}
+
+	agentIDs, err := stringSliceArg(request.GetArguments(), "agent_ids")
+	if err != nil {
+		return nil, err
+	}
+	if len(agentIDs) == 0 {
+		return nil, errors.New("agent_ids must contain at least one agent")
+	}
+
+	resonanceRounds := defaultResonanceRounds
+	if v, ok := request.GetArguments()["resonance_rounds"].(float64); ok {
+		resonanceRounds = int(v)
+	}
+	if resonanceRounds < 0 || resonanceRounds > maxResonanceRounds {
+		return nil, fmt.Errorf("resonance_rounds must be between 0 and %d", maxResonanceRounds)
+	}
+
+	// 讨论开始前取得所有参与者的快照，讨论期间的修改不影响本场讨论
+	participants := make([]Agent, 0, len(agentIDs))
+	for _, id := range agentIDs {
+		agent, err := getStoredAgent(id)
+		if err != nil {
+			return nil, err
+		}
+		participants = append(participants, agent)
+	}
+
+	log.Info("开始圆桌讨论",
+		zap.String("topic", topic),
+		zap.Strings("agent_ids", agentIDs),
+		zap.Int("resonance_rounds", resonanceRounds))
+
+	rt := &roundTable{topic: topic, participants: participants}
+	ctx, meter := withUsageMeter(ctx)
+	result, runErr := rt.run(ctx, resonanceRounds)
+	if runErr != nil {
+		log.Error("圆桌讨论失败",
+			zap.String("phase", result.FailedAt.Phase),
+			zap.String("agent_id", result.FailedAt.AgentID),
+			zap.Int("turns", len(result.Transcript)),
+			zap.Error(runErr))
+	}
+	// 讨论中断时同样返回已完成的发言和已消耗的用量，并将结果标记为错误
+	result.Usage = meter.snapshot()
+
+	jsonResponse, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("marshal response failed: %v", err)
+	}
+
+	toolResult := mcp.NewToolResultText(string(jsonResponse))
+	toolResult.IsError = runErr != nil
+	return toolResult, nil
+}
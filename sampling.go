@@ -0,0 +1,147 @@
+package main
+
+import (
+	"fmt"
+	"math"
+
+	"agent-forge/internal/llm"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// samplingPatch 工具参数中提供的模型与采样参数，nil 表示未提供
+type samplingPatch struct {
+	Model       *string
+	Temperature *float64
+	TopP        *float64
+	MaxTokens   *int
+	Seed        *int
+}
+
+// parseSamplingArgs 解析并校验工具参数中的模型与采样参数
+func parseSamplingArgs(args map[string]interface{}) (samplingPatch, error) {
+	var patch samplingPatch
+
+	if v, ok := args["model"]; ok {
+		model, ok := v.(string)
+		if !ok {
+			return patch, fmt.Errorf("model must be a string")
+		}
+		patch.Model = &model
+	}
+
+	if v, ok := args["temperature"]; ok {
+		temperature, ok := v.(float64)
+		if !ok || temperature < 0 || temperature > 2 {
+			return patch, fmt.Errorf("temperature must be a number between 0 and 2")
+		}
+		patch.Temperature = &temperature
+	}
+
+	if v, ok := args["top_p"]; ok {
+		topP, ok := v.(float64)
+		if !ok || topP <= 0 || topP > 1 {
+			return patch, fmt.Errorf("top_p must be a number in (0, 1]")
+		}
+		patch.TopP = &topP
+	}
+
+	if v, ok := args["max_tokens"]; ok {
+		maxTokens, ok := v.(float64)
+		if !ok || maxTokens < 0 || maxTokens != math.Trunc(maxTokens) {
+			return patch, fmt.Errorf("max_tokens must be a non-negative integer")
+		}
+		n := int(maxTokens)
+		patch.MaxTokens = &n
+	}
+
+	if v, ok := args["seed"]; ok {
+		seed, ok := v.(float64)
+		if !ok || seed != math.Trunc(seed) {
+			return patch, fmt.Errorf("seed must be an integer")
+		}
+		n := int(seed)
+		patch.Seed = &n
+	}
+
+	return patch, nil
+}
+
+// sampling 返回提供的模型与采样参数，未提供的参数使用提供方默认值
+func (p samplingPatch) sampling() llm.Sampling {
+	var agent Agent
+	p.apply(&agent)
+	return agentSampling(agent)
+}
+
+// apply 将提供的参数写入智能体
+func (p samplingPatch) apply(agent *Agent) {
+	if p.Model != nil {
+		agent.Model = *p.Model
+	}
+	if p.Temperature != nil {
+		agent.Temperature = p.Temperature
+	}
+	if p.TopP != nil {
+		agent.TopP = p.TopP
+	}
+	if p.MaxTokens != nil {
+		agent.MaxTokens = *p.MaxTokens
+	}
+	if p.Seed != nil {
+		agent.Seed = p.Seed
+	}
+}
+
+// resetSampling 清除智能体的模型与采样参数，恢复使用提供方默认值
+func resetSampling(agent *Agent) {
+	agent.Model = ""
+	agent.Temperature = nil
+	agent.TopP = nil
+	agent.MaxTokens = 0
+	agent.Seed = nil
+}
+
+// agentSampling 返回智能体作答时使用的模型与采样参数
+func agentSampling(agent Agent) llm.Sampling {
+	return llm.Sampling{
+		Model:       agent.Model,
+		Temperature: agent.Temperature,
+		TopP:        agent.TopP,
+		MaxTokens:   agent.MaxTokens,
+		Seed:        agent.Seed,
+	}
+}
+
+// personaSampling 返回生成人格时使用的采样参数：只沿用温度和种子，指定种子或温度为 0 时人格可以复现并被缓存
+// 模型和 max_tokens 等参数只影响作答，人格仍由默认模型完整生成
+func personaSampling(s llm.Sampling) llm.Sampling {
+	return llm.Sampling{Temperature: s.Temperature, Seed: s.Seed}
+}
+
+// castingSampling 返回设计专家组阵容时使用的参数：沿用模型、温度和种子，指定种子时每次得到相同的阵容
+// top_p 和 max_tokens 只影响成员作答，不用于生成阵容，避免阵容 JSON 被截断
+func castingSampling(s llm.Sampling) llm.Sampling {
+	return llm.Sampling{Model: s.Model, Temperature: s.Temperature, Seed: s.Seed}
+}
+
+// withSamplingOptions 在工具定义后追加创建和更新智能体共用的采样参数
+func withSamplingOptions(opts ...mcp.ToolOption) []mcp.ToolOption {
+	return append(opts,
+		mcp.WithString("model",
+			mcp.Description("作答使用的模型，可以是提供方名称、\"提供方/模型\" 或模型名称，为空表示使用默认模型"),
+		),
+		mcp.WithNumber("temperature",
+			mcp.Description("采样温度，范围 0~2"),
+		),
+		mcp.WithNumber("top_p",
+			mcp.Description("核采样概率，范围 (0, 1]"),
+		),
+		mcp.WithNumber("max_tokens",
+			mcp.Description("单次作答的最大token数"),
+		),
+		mcp.WithNumber("seed",
+			mcp.Description("随机种子，便于复现作答"),
+		),
+	)
+}
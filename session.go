@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"agent-forge/internal/logger"
+	"agent-forge/internal/store"
+
+	"github.com/google/uuid"
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.uber.org/zap"
+)
+
+// Session 讨论会话定义
+type Session = store.Session
+
+// 存储所有讨论会话，所有处理函数均通过并发安全的注册表访问
+var sessions = store.NewSessionRegistry(store.NewMemorySessionStore())
+
+// moderatorName 会话记录中主持人发言的署名
+const moderatorName = "主持人"
+
+// defaultSessionQuestion 未提供主持人发言时给智能体的提示
+const defaultSessionQuestion = "请结合讨论主题和已有发言，继续发表你的观点。"
+
+// sessionTurnResult 一次会话发言的返回结果
+type sessionTurnResult struct {
+	SessionID     string      `json:"session_id"`
+	Turn          store.Turn  `json:"turn"`
+	PlannedRounds int         `json:"planned_rounds"`
+	CurrentRound  int         `json:"current_round"`
+	Finished      bool        `json:"finished"`
+	Provider      string      `json:"provider"` // 实际生成发言的提供方，可能来自故障转移
+	Model         string      `json:"model"`
+	Usage         usageTotals `json:"usage"`
+}
+
+// getStoredSession 从注册表中读取会话快照，并统一不存在时的错误信息
+func getStoredSession(sessionID string) (Session, error) {
+	session, err := sessions.Get(sessionID)
+	if err != nil {
+		return Session{}, sessionLookupError(sessionID, err)
+	}
+	return session, nil
+}
+
+// sessionLookupError 将存储层错误转换为面向调用方的错误信息
+func sessionLookupError(sessionID string, err error) error {
+	if errors.Is(err, store.ErrSessionNotFound) {
+		return fmt.Errorf("session with ID %s not found", sessionID)
+	}
+	return fmt.Errorf("load session failed: %v", err)
+}
+
+// appendTurn 追加一次发言，并在所有参与者都完成本轮发言后推进轮次
+func appendTurn(session *Session, turn store.Turn) store.Turn {
+	turn.Index = len(session.Turns) + 1
+	turn.Round = session.CurrentRound
+	session.Turns = append(session.Turns, turn)
+
+	if turn.Speaker == store.SpeakerAgent && roundComplete(*session, session.CurrentRound) {
+		session.CurrentRound++
+	}
+	return turn
+}
+
+// roundComplete 判断指定轮次中是否所有参与者都已发言
+func roundComplete(session Session, round int) bool {
+	spoken := make(map[string]bool, len(session.AgentIDs))
+	for _, turn := range session.Turns {
+		if turn.Round == round && turn.Speaker == store.SpeakerAgent {
+			spoken[turn.AgentID] = true
+		}
+	}
+	for _, id := range session.AgentIDs {
+		if !spoken[id] {
+			return false
+		}
+	}
+	return true
+}
+
+// 创建讨论会话处理函数
+func createSessionHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	log := logger.GetLogger()
+
+	topic, ok := request.GetArguments()["topic"].(string)
+	if !ok || topic == "" {
+		return nil, errors.New("topic must be a non-empty string")
+	}
+
+	agentIDs, err := stringSliceArg(request.GetArguments(), "agent_ids")
+	if err != nil {
+		return nil, err
+	}
+	if len(agentIDs) == 0 {
+		return nil, errors.New("agent_ids must contain at least one agent")
+	}
+	for _, id := range agentIDs {
+		if _, err := getStoredAgent(id); err != nil {
+			return nil, err
+		}
+	}
+
+	plannedRounds := 1
+	if v, ok := request.GetArguments()["planned_rounds"]; ok {
+		n, ok := v.(float64)
+		if !ok || n < 1 || n != math.Trunc(n) {
+			return nil, errors.New("planned_rounds must be a positive integer")
+		}
+		plannedRounds = int(n)
+	}
+
+	now := time.Now().Format(time.RFC3339)
+	session := Session{
+		ID:            uuid.New().String(),
+		Topic:         topic,
+		AgentIDs:      agentIDs,
+		Turns:         []store.Turn{},
+		PlannedRounds: plannedRounds,
+		CurrentRound:  1,
+		Status:        store.SessionOpen,
+		CreatedAt:     now,
+		UpdatedAt:     now,
+	}
+	if err := sessions.Create(session); err != nil {
+		return nil, fmt.Errorf("save session failed: %v", err)
+	}
+
+	log.Info("创建讨论会话",
+		zap.String("session_id", session.ID),
+		zap.String("topic", topic),
+		zap.Strings("agent_ids", agentIDs))
+
+	jsonResponse, err := json.Marshal(session)
+	if err != nil {
+		return nil, fmt.Errorf("marshal response failed: %v", err)
+	}
+
+	return mcp.NewToolResultText(string(jsonResponse)), nil
+}
+
+// 会话发言处理函数，服务端根据会话记录为智能体构建上下文
+func sessionTurnHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sessionID, ok := request.GetArguments()["session_id"].(string)
+	if !ok {
+		return nil, errors.New("session_id must be a string")
+	}
+	agentID, ok := request.GetArguments()["agent_id"].(string)
+	if !ok {
+		return nil, errors.New("agent_id must be a string")
+	}
+	message, _ := request.GetArguments()["message"].(string)
+	needMoreRounds, _ := request.GetArguments()["need_more_rounds"].(bool)
+
+	session, err := getStoredSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+	if session.Status != store.SessionOpen {
+		return nil, fmt.Errorf("session %s is closed", sessionID)
+	}
+	if !session.HasParticipant(agentID) {
+		return nil, fmt.Errorf("agent %s is not a participant of session %s", agentID, sessionID)
+	}
+
+	agent, err := getStoredAgent(agentID)
+	if err != nil {
+		return nil, err
+	}
+
+	// LLM 调用在注册表锁之外进行，只在写回时持锁
+	question := defaultSessionQuestion
+	if message != "" {
+		question = speakerContent(moderatorName, message)
+	}
+	systemPrompt := fmt.Sprintf("%s\n你正在参加一场主题为[%s]的讨论。", agentSystemPrompt(agent), session.Topic)
+
+	messages := historyMessages(systemPrompt, sessionHistory(session, agent.ID), question)
+	ctx, meter := withUsageMeter(withUsageSession(withUsageAgent(ctx, agent.ID, agent.Name), sessionID))
+	resp, err := callLLMStream(ctx, agentSampling(agent), messages, progressNotifier(ctx, request))
+	if err != nil {
+		return nil, err
+	}
+
+	var turn store.Turn
+	updated, err := sessions.Update(sessionID, func(s *Session) error {
+		if s.Status != store.SessionOpen {
+			return fmt.Errorf("session %s is closed", sessionID)
+		}
+		now := time.Now().Format(time.RFC3339)
+		if message != "" {
+			appendTurn(s, store.Turn{
+				Speaker:   store.SpeakerModerator,
+				Name:      moderatorName,
+				Content:   message,
+				CreatedAt: now,
+			})
+		}
+		turn = appendTurn(s, store.Turn{
+			Speaker:   store.SpeakerAgent,
+			AgentID:   agent.ID,
+			Name:      agent.Name,
+			Content:   resp.Content,
+			CreatedAt: now,
+		})
+		if needMoreRounds {
+			s.PlannedRounds++
+		}
+		s.UpdatedAt = now
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, store.ErrSessionNotFound) {
+			return nil, sessionLookupError(sessionID, err)
+		}
+		return nil, err
+	}
+
+	result := sessionTurnResult{
+		SessionID:     updated.ID,
+		Turn:          turn,
+		PlannedRounds: updated.PlannedRounds,
+		CurrentRound:  updated.CurrentRound,
+		Finished:      updated.CurrentRound > updated.PlannedRounds,
+		Provider:      resp.Provider,
+		Model:         resp.Model,
+		Usage:         meter.snapshot(),
+	}
+
+	jsonResponse, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("marshal response failed: %v", err)
+	}
+
+	return mcp.NewToolResultText(string(jsonResponse)), nil
+}
+
+// 获取会话记录处理函数
+func getSessionTranscriptHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	sessionID, ok := request.GetArguments()["session_id"].(string)
+	if !ok {
+		return nil, errors.New("session_id must be a string")
+	}
+
+	session, err := getStoredSession(sessionID)
+	if err != nil {
+		return nil, err
+	}
+
+	jsonResponse, err := json.Marshal(session)
+	if err != nil {
+		return nil, fmt.Errorf("marshal response failed: %v", err)
+	}
+
+	return mcp.NewToolResultText(string(jsonResponse)), nil
+}
+
+// 关闭会话处理函数，关闭后的会话仍可查询但不再接受发言
+func closeSessionHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	log := logger.GetLogger()
+
+	sessionID, ok := request.GetArguments()["session_id"].(string)
+	if !ok {
+		return nil, errors.New("session_id must be a string")
+	}
+
+	session, err := sessions.Update(sessionID, func(s *Session) error {
+		if s.Status == store.SessionClosed {
+			return fmt.Errorf("session %s is already closed", sessionID)
+		}
+		now := time.Now().Format(time.RFC3339)
+		s.Status = store.SessionClosed
+		s.ClosedAt = now
+		s.UpdatedAt = now
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, store.ErrSessionNotFound) {
+			return nil, sessionLookupError(sessionID, err)
+		}
+		return nil, err
+	}
+
+	log.Info("关闭讨论会话",
+		zap.String("session_id", sessionID),
+		zap.Int("turns", len(session.Turns)))
+
+	jsonResponse, err := json.Marshal(session)
+	if err != nil {
+		return nil, fmt.Errorf("marshal response failed: %v", err)
+	}
+
+	return mcp.NewToolResultText(string(jsonResponse)), nil
+}
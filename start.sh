@@ -6,4 +6,4 @@ echo "应用文件权限检查:" >&2
 ls -la /app/agent-forge >&2
 
 # 直接执行agent-forge，不产生额外输出
-exec /app/agent-forge
+exec /app/agent-forge "$@"
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+	"time"
+
+	"agent-forge/internal/config"
+	"agent-forge/internal/logger"
+
+	"github.com/mark3labs/mcp-go/server"
+	"go.uber.org/zap"
+)
+
+// 支持的传输方式
+const (
+	TransportStdio = "stdio"
+	TransportSSE   = "sse"
+	TransportHTTP  = "http"
+)
+
+// 服务启动时间，用于健康检查
+var startedAt = time.Now()
+
+// serve 按配置的传输方式启动 MCP 服务，阻塞直到收到退出信号或服务出错
+func serve(s *server.MCPServer, cfg config.ServerConfig) error {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
+	defer stop()
+
+	switch cfg.Transport {
+	case "", TransportStdio:
+		return serveStdio(ctx, s)
+	case TransportSSE, TransportHTTP:
+		addr := net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port))
+		ln, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fmt.Errorf("监听 %s 失败: %v", addr, err)
+		}
+		return serveHTTP(ctx, s, cfg, ln)
+	default:
+		return fmt.Errorf("不支持的传输方式: %s", cfg.Transport)
+	}
+}
+
+// serveStdio 通过标准输入输出提供服务，ctx 取消后停止
+// 与 server.ServeStdio 相同，但在工具执行期间也能处理客户端的取消通知
+func serveStdio(ctx context.Context, s *server.MCPServer) error {
+	return server.NewStdioServer(s).Listen(ctx, interceptCancellations(os.Stdin), os.Stdout)
+}
+
+// httpTransport 抽象 SSE 与 streamable HTTP 两种服务的公共行为
+type httpTransport interface {
+	Shutdown(ctx context.Context) error
+}
+
+// serveHTTP 在 ln 上启动基于 HTTP 的传输（SSE 或 streamable HTTP），ctx 取消（收到退出信号）后优雅关闭
+func serveHTTP(ctx context.Context, s *server.MCPServer, cfg config.ServerConfig, ln net.Listener) error {
+	log := logger.GetLogger()
+
+	mux := http.NewServeMux()
+	httpServer := &http.Server{
+		Addr:    ln.Addr().String(),
+		Handler: mux,
+	}
+
+	var transport httpTransport
+	switch cfg.Transport {
+	case TransportSSE:
+		sseServer := server.NewSSEServer(s,
+			server.WithBaseURL(cfg.BaseURL),
+			server.WithHTTPServer(httpServer),
+			server.WithKeepAlive(true),
+		)
+		mux.Handle(sseServer.CompleteSsePath(), sseServer.SSEHandler())
+		mux.Handle(sseServer.CompleteMessagePath(), sseServer.MessageHandler())
+		transport = sseServer
+	case TransportHTTP:
+		httpMCPServer := server.NewStreamableHTTPServer(s,
+			server.WithStreamableHTTPServer(httpServer),
+		)
+		mux.Handle("/mcp", httpMCPServer)
+		transport = httpMCPServer
+	default:
+		ln.Close()
+		return fmt.Errorf("不支持的传输方式: %s", cfg.Transport)
+	}
+	mux.HandleFunc("/health", healthHandler(cfg.Transport))
+
+	errCh := make(chan error, 1)
+	go func() {
+		log.Info("HTTP服务启动", zap.String("transport", cfg.Transport), zap.String("addr", httpServer.Addr))
+		if err := httpServer.Serve(ln); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			errCh <- err
+		}
+		close(errCh)
+	}()
+
+	select {
+	case err, ok := <-errCh:
+		if ok {
+			return err
+		}
+		return nil
+	case <-ctx.Done():
+		log.Info("收到退出信号，开始优雅关闭")
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.ShutdownTimeout)*time.Second)
+	defer cancel()
+
+	if err := transport.Shutdown(shutdownCtx); err != nil {
+		return fmt.Errorf("优雅关闭失败: %v", err)
+	}
+	log.Info("HTTP服务已关闭")
+	return nil
+}
+
+// healthHandler 健康检查接口，存储不可用时返回 503，同时报告各LLM提供方的熔断状态
+func healthHandler(transport string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		status := http.StatusOK
+		result := map[string]interface{}{
+			"status":    "ok",
+			"transport": transport,
+			"uptime":    time.Since(startedAt).Round(time.Second).String(),
+		}
+
+		agentList, err := agents.List()
+		if err != nil {
+			status = http.StatusServiceUnavailable
+			result["status"] = "unavailable"
+			result["error"] = err.Error()
+		} else {
+			result["agents"] = len(agentList)
+		}
+		// 各LLM提供方的熔断器状态，open 表示该提供方当前被跳过
+		if llmProviders != nil {
+			result["providers"] = llmProviders.BreakerStates()
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(result)
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"agent-forge/internal/config"
+	"agent-forge/internal/store"
+
+	"github.com/mark3labs/mcp-go/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHealthHandler(t *testing.T) {
+	agents = store.NewRegistry(store.NewMemoryStore())
+	require.NoError(t, agents.Create(Agent{ID: "a1", Name: "经济学家"}))
+
+	srv := httptest.NewServer(healthHandler(TransportHTTP))
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+
+	var body map[string]interface{}
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	assert.Equal(t, "ok", body["status"])
+	assert.Equal(t, TransportHTTP, body["transport"])
+	assert.Equal(t, float64(1), body["agents"])
+}
+
+func TestServeHTTPShutsDownOnCancel(t *testing.T) {
+	agents = store.NewRegistry(store.NewMemoryStore())
+	// 不复用连接，避免客户端预先建立的空闲连接拖慢优雅关闭
+	client := &http.Client{Transport: &http.Transport{DisableKeepAlives: true}}
+
+	for _, tt := range []struct {
+		transport string
+		endpoint  string // MCP 端点，确认已注册（不是 404）
+	}{
+		{TransportHTTP, "/mcp"},
+		{TransportSSE, "/message"},
+	} {
+		t.Run(tt.transport, func(t *testing.T) {
+			ln, err := net.Listen("tcp", "127.0.0.1:0")
+			require.NoError(t, err)
+			baseURL := "http://" + ln.Addr().String()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			done := make(chan error, 1)
+			cfg := config.ServerConfig{Transport: tt.transport, BaseURL: baseURL, ShutdownTimeout: 5}
+			go func() { done <- serveHTTP(ctx, server.NewMCPServer("test", "1.0.0"), cfg, ln) }()
+
+			resp, err := client.Get(baseURL + "/health")
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+			resp, err = client.Post(baseURL+tt.endpoint, "application/json", strings.NewReader(`{}`))
+			require.NoError(t, err)
+			resp.Body.Close()
+			assert.NotEqual(t, http.StatusNotFound, resp.StatusCode)
+
+			// 取消后服务优雅关闭并返回，不再接受连接
+			cancel()
+			select {
+			case err := <-done:
+				assert.NoError(t, err)
+			case <-time.After(5 * time.Second):
+				t.Fatal("serveHTTP did not return after cancel")
+			}
+			_, err = client.Get(baseURL + "/health")
+			assert.Error(t, err)
+		})
+	}
+}
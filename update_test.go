@@ -0,0 +1,125 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"agent-forge/internal/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// llmRequestCount 返回模拟服务器收到的请求数
+func llmRequestCount(log *llmRequestLog) int {
+	log.mu.Lock()
+	defer log.mu.Unlock()
+	return len(log.requests)
+}
+
+func TestUpdateAgentManualPersonality(t *testing.T) {
+	log := useFakeLLM(t, "回答")
+	agents = store.NewRegistry(store.NewMemoryStore())
+	require.NoError(t, agents.Create(Agent{
+		ID:          "a1",
+		Name:        "经济学家",
+		CoreTraits:  "理性",
+		Personality: "旧人格",
+		Persona:     &Persona{ExpertiseDomains: []string{"宏观经济"}, Traits: []string{"理性"}, SpeakingStyle: "平实"},
+	}))
+	ctx := context.Background()
+
+	// 局部修改结构化人格，未提供的字段保持不变
+	_, err := updateAgentHandler(ctx, newToolRequest("update_agent", map[string]interface{}{
+		"agent_id": "a1",
+		"persona":  map[string]interface{}{"speaking_style": "幽默", "values": []interface{}{"实事求是"}},
+	}))
+	require.NoError(t, err)
+	agent, err := getStoredAgent("a1")
+	require.NoError(t, err)
+	require.NotNil(t, agent.Persona)
+	assert.Equal(t, "幽默", agent.Persona.SpeakingStyle)
+	assert.Equal(t, []string{"宏观经济"}, agent.Persona.ExpertiseDomains)
+	assert.Equal(t, []string{"实事求是"}, agent.Persona.Values)
+	assert.Contains(t, agent.Personality, "说话风格：幽默")
+
+	// 修改核心特质并手写人格描述时不重新生成
+	_, err = updateAgentHandler(ctx, newToolRequest("update_agent", map[string]interface{}{
+		"agent_id":    "a1",
+		"core_traits": "激进",
+		"personality": "一位敢于下判断的经济学家",
+	}))
+	require.NoError(t, err)
+	agent, err = getStoredAgent("a1")
+	require.NoError(t, err)
+	assert.Equal(t, "激进", agent.CoreTraits)
+	assert.Equal(t, "一位敢于下判断的经济学家", agent.Personality)
+	assert.Nil(t, agent.Persona)
+	assert.Equal(t, "你现在扮演一个经济学家。一位敢于下判断的经济学家", agentSystemPrompt(agent))
+
+	// 显式关闭重新生成时只修改核心特质
+	_, err = updateAgentHandler(ctx, newToolRequest("update_agent", map[string]interface{}{
+		"agent_id":    "a1",
+		"core_traits": "保守",
+		"regenerate":  false,
+	}))
+	require.NoError(t, err)
+	agent, err = getStoredAgent("a1")
+	require.NoError(t, err)
+	assert.Equal(t, "保守", agent.CoreTraits)
+	assert.Equal(t, "一位敢于下判断的经济学家", agent.Personality)
+	assert.Equal(t, 0, llmRequestCount(log))
+
+	// 不修改核心特质也可以要求重新生成
+	_, err = updateAgentHandler(ctx, newToolRequest("update_agent", map[string]interface{}{
+		"agent_id":   "a1",
+		"regenerate": true,
+	}))
+	require.NoError(t, err)
+	agent, err = getStoredAgent("a1")
+	require.NoError(t, err)
+	require.NotNil(t, agent.Persona)
+	assert.Equal(t, "简洁直接，善用类比", agent.Persona.SpeakingStyle)
+	assert.Equal(t, 1, llmRequestCount(log))
+
+	invalid := []map[string]interface{}{
+		{"agent_id": "a1", "personality": "   "},
+		{"agent_id": "a1", "personality": "描述", "persona": map[string]interface{}{"speaking_style": "幽默"}},
+		{"agent_id": "a1", "personality": "描述", "regenerate": true},
+		{"agent_id": "a1", "persona": map[string]interface{}{"style": "幽默"}},
+		{"agent_id": "a1", "persona": map[string]interface{}{"traits": []interface{}{}}},
+	}
+	for _, args := range invalid {
+		_, err := updateAgentHandler(ctx, newToolRequest("update_agent", args))
+		assert.Error(t, err, args)
+	}
+}
+
+func TestUpdateAgentExpectedVersion(t *testing.T) {
+	useFakeLLM(t, "回答")
+	agents = store.NewRegistry(store.NewMemoryStore())
+	require.NoError(t, agents.Create(Agent{ID: "a1", Name: "经济学家", CoreTraits: "理性", Personality: "旧人格"}))
+	ctx := context.Background()
+
+	result, err := updateAgentHandler(ctx, newToolRequest("update_agent", map[string]interface{}{
+		"agent_id":         "a1",
+		"personality":      "新人格",
+		"expected_version": float64(1),
+	}))
+	require.NoError(t, err)
+	data := toolResultJSON(t, result)
+	assert.Equal(t, float64(2), data["agent"].(map[string]interface{})["version"])
+
+	// 基于过期版本的修改被拒绝
+	_, err = updateAgentHandler(ctx, newToolRequest("update_agent", map[string]interface{}{
+		"agent_id":         "a1",
+		"personality":      "过期的修改",
+		"expected_version": float64(1),
+	}))
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "current version 2")
+
+	agent, err := getStoredAgent("a1")
+	require.NoError(t, err)
+	assert.Equal(t, "新人格", agent.Personality)
+}
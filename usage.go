@@ -0,0 +1,291 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"agent-forge/internal/config"
+	"agent-forge/internal/llm"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// usageTotals 一组LLM调用的 token 用量与费用，缓存命中不计入
+type usageTotals struct {
+	Calls            int     `json:"calls"`
+	PromptTokens     int     `json:"prompt_tokens"`
+	CompletionTokens int     `json:"completion_tokens"`
+	TotalTokens      int     `json:"total_tokens"`
+	Cost             float64 `json:"cost"`
+}
+
+// add 计入一次调用
+func (u *usageTotals) add(usage llm.Usage, cost float64) {
+	u.Calls++
+	u.PromptTokens += usage.PromptTokens
+	u.CompletionTokens += usage.CompletionTokens
+	u.TotalTokens += usage.TotalTokens
+	u.Cost += cost
+}
+
+// agentUsage 单个智能体的用量
+type agentUsage struct {
+	AgentID string `json:"agent_id"`
+	Name    string `json:"name"`
+	usageTotals
+}
+
+// sessionUsage 单个讨论会话的用量
+type sessionUsage struct {
+	SessionID string `json:"session_id"`
+	usageTotals
+}
+
+// modelUsage 单个模型的用量，模型以 "提供方/模型" 表示
+type modelUsage struct {
+	Model string `json:"model"`
+	usageTotals
+}
+
+// usageLedger 自服务启动以来的用量统计，保存在内存中，重启后清零
+var usageLedger = struct {
+	sync.Mutex
+	since     time.Time
+	total     usageTotals
+	byModel   map[string]*modelUsage
+	byAgent   map[string]*agentUsage
+	bySession map[string]*sessionUsage
+}{
+	since:     time.Now(),
+	byModel:   make(map[string]*modelUsage),
+	byAgent:   make(map[string]*agentUsage),
+	bySession: make(map[string]*sessionUsage),
+}
+
+// usageScopeKey 上下文中用量归属的键
+type usageScopeKey struct{}
+
+// usageScope LLM调用用量的归属，为空的字段不统计
+type usageScope struct {
+	agentID   string
+	agentName string
+	sessionID string
+}
+
+// scopeFromContext 返回上下文中的用量归属
+func scopeFromContext(ctx context.Context) usageScope {
+	if ctx == nil {
+		return usageScope{}
+	}
+	scope, _ := ctx.Value(usageScopeKey{}).(usageScope)
+	return scope
+}
+
+// withUsageAgent 返回将之后的LLM调用用量记到该智能体名下的上下文
+func withUsageAgent(ctx context.Context, agentID, name string) context.Context {
+	scope := scopeFromContext(ctx)
+	scope.agentID, scope.agentName = agentID, name
+	return context.WithValue(ctx, usageScopeKey{}, scope)
+}
+
+// withUsageSession 返回将之后的LLM调用用量记到该讨论会话名下的上下文
+func withUsageSession(ctx context.Context, sessionID string) context.Context {
+	scope := scopeFromContext(ctx)
+	scope.sessionID = sessionID
+	return context.WithValue(ctx, usageScopeKey{}, scope)
+}
+
+// usageMeterKey 上下文中用量计数器的键
+type usageMeterKey struct{}
+
+// usageMeter 累计一次工具调用中所有LLM调用的用量，用于在工具结果中报告
+type usageMeter struct {
+	mu     sync.Mutex
+	totals usageTotals
+}
+
+// withUsageMeter 返回带有新计数器的上下文
+func withUsageMeter(ctx context.Context) (context.Context, *usageMeter) {
+	meter := &usageMeter{}
+	return context.WithValue(ctx, usageMeterKey{}, meter), meter
+}
+
+// snapshot 返回当前累计的用量
+func (m *usageMeter) snapshot() usageTotals {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.totals
+}
+
+// usagePrice 返回模型的单价，先按 "提供方/模型" 匹配，再按模型名称匹配
+func usagePrice(provider, model string) (config.ModelPrice, bool) {
+	cfg := config.GetConfig()
+	if cfg == nil {
+		return config.ModelPrice{}, false
+	}
+	var byModel *config.ModelPrice
+	for i, price := range cfg.Usage.Prices {
+		if price.Model == provider+"/"+model {
+			return price, true
+		}
+		if price.Model == model && byModel == nil {
+			byModel = &cfg.Usage.Prices[i]
+		}
+	}
+	if byModel != nil {
+		return *byModel, true
+	}
+	return config.ModelPrice{}, false
+}
+
+// usageCost 按配置的单价计算费用，未配置价格的模型费用为 0
+func usageCost(provider, model string, usage llm.Usage) float64 {
+	price, ok := usagePrice(provider, model)
+	if !ok {
+		return 0
+	}
+	return (float64(usage.PromptTokens)*price.Prompt + float64(usage.CompletionTokens)*price.Completion) / 1e6
+}
+
+// recordUsage 记录一次LLM调用的用量，缓存命中不计入
+// 按请求的模型计价与汇总：接口返回的模型名称常是带日期的快照（如 gpt-4o-2024-08-06），与配置的价格对不上
+func recordUsage(ctx context.Context, resp *llm.ChatResponse) {
+	if resp == nil || resp.Cached {
+		return
+	}
+	model := resp.RequestedModel
+	if model == "" {
+		model = resp.Model
+	}
+	recordCall(ctx, resp.Provider, model, resp.Usage)
+}
+
+// recordEmbeddingUsage 记录一次 embeddings 调用的用量
+func recordEmbeddingUsage(ctx context.Context, p llm.EmbeddingProvider, usage llm.Usage) {
+	recordCall(ctx, p.Name(), p.EmbeddingModel(), usage)
+}
+
+// recordCall 计入全局统计、上下文中的智能体与会话，以及本次工具调用的计数器
+func recordCall(ctx context.Context, provider, model string, usage llm.Usage) {
+	cost := usageCost(provider, model, usage)
+	scope := scopeFromContext(ctx)
+
+	usageLedger.Lock()
+	usageLedger.total.add(usage, cost)
+	modelKey := provider + "/" + model
+	if usageLedger.byModel[modelKey] == nil {
+		usageLedger.byModel[modelKey] = &modelUsage{Model: modelKey}
+	}
+	usageLedger.byModel[modelKey].add(usage, cost)
+	if scope.agentID != "" {
+		if usageLedger.byAgent[scope.agentID] == nil {
+			usageLedger.byAgent[scope.agentID] = &agentUsage{AgentID: scope.agentID}
+		}
+		entry := usageLedger.byAgent[scope.agentID]
+		entry.Name = scope.agentName
+		entry.add(usage, cost)
+	}
+	if scope.sessionID != "" {
+		if usageLedger.bySession[scope.sessionID] == nil {
+			usageLedger.bySession[scope.sessionID] = &sessionUsage{SessionID: scope.sessionID}
+		}
+		usageLedger.bySession[scope.sessionID].add(usage, cost)
+	}
+	usageLedger.Unlock()
+
+	if ctx == nil {
+		return
+	}
+	if meter, ok := ctx.Value(usageMeterKey{}).(*usageMeter); ok {
+		meter.mu.Lock()
+		meter.totals.add(usage, cost)
+		meter.mu.Unlock()
+	}
+}
+
+// usageResetNote usage_report 结果中说明统计范围的提示
+const usageResetNote = "统计自 since 起累计，只保存在内存中，服务重启后清零；重启前创建的智能体和讨论会话只包含重启后的用量"
+
+// usageReport usage_report 工具的结果，按智能体或会话筛选时只包含对应的统计
+type usageReport struct {
+	Since     string         `json:"since"`
+	Note      string         `json:"note"`
+	Currency  string         `json:"currency"`
+	Total     *usageTotals   `json:"total,omitempty"`
+	ByModel   []modelUsage   `json:"by_model,omitempty"`
+	ByAgent   []agentUsage   `json:"by_agent"`
+	BySession []sessionUsage `json:"by_session"`
+}
+
+// buildUsageReport 汇总用量统计，agentID 或 sessionID 不为空时只返回对应的条目，列表按 token 数从多到少排列
+func buildUsageReport(agentID, sessionID string) usageReport {
+	report := usageReport{Note: usageResetNote, ByAgent: []agentUsage{}, BySession: []sessionUsage{}}
+	if cfg := config.GetConfig(); cfg != nil {
+		report.Currency = cfg.Usage.Currency
+	}
+
+	usageLedger.Lock()
+	defer usageLedger.Unlock()
+
+	report.Since = usageLedger.since.Format(time.RFC3339)
+	filtered := agentID != "" || sessionID != ""
+	if !filtered {
+		total := usageLedger.total
+		report.Total = &total
+		for _, u := range usageLedger.byModel {
+			report.ByModel = append(report.ByModel, *u)
+		}
+		sort.Slice(report.ByModel, func(i, j int) bool {
+			return moreUsage(report.ByModel[i].usageTotals, report.ByModel[j].usageTotals, report.ByModel[i].Model < report.ByModel[j].Model)
+		})
+	}
+	for id, u := range usageLedger.byAgent {
+		if !filtered || id == agentID {
+			report.ByAgent = append(report.ByAgent, *u)
+		}
+	}
+	sort.Slice(report.ByAgent, func(i, j int) bool {
+		return moreUsage(report.ByAgent[i].usageTotals, report.ByAgent[j].usageTotals, report.ByAgent[i].AgentID < report.ByAgent[j].AgentID)
+	})
+	for id, u := range usageLedger.bySession {
+		if !filtered || id == sessionID {
+			report.BySession = append(report.BySession, *u)
+		}
+	}
+	sort.Slice(report.BySession, func(i, j int) bool {
+		return moreUsage(report.BySession[i].usageTotals, report.BySession[j].usageTotals, report.BySession[i].SessionID < report.BySession[j].SessionID)
+	})
+	return report
+}
+
+// moreUsage 排序比较：token 数多的在前，相同时按 tie 决定
+func moreUsage(a, b usageTotals, tie bool) bool {
+	if a.TotalTokens != b.TotalTokens {
+		return a.TotalTokens > b.TotalTokens
+	}
+	return tie
+}
+
+// usageReportHandler 返回自服务启动以来的 token 用量与费用，可按智能体或讨论会话筛选
+func usageReportHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	args := request.GetArguments()
+	agentID, ok := args["agent_id"].(string)
+	if v, exists := args["agent_id"]; exists && v != nil && !ok {
+		return nil, errors.New("agent_id must be a string")
+	}
+	sessionID, ok := args["session_id"].(string)
+	if v, exists := args["session_id"]; exists && v != nil && !ok {
+		return nil, errors.New("session_id must be a string")
+	}
+
+	jsonResponse, err := json.Marshal(buildUsageReport(agentID, sessionID))
+	if err != nil {
+		return nil, fmt.Errorf("marshal response failed: %v", err)
+	}
+	return mcp.NewToolResultText(string(jsonResponse)), nil
+}
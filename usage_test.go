@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"agent-forge/internal/config"
+	"agent-forge/internal/llm"
+	"agent-forge/internal/store"
+
+	"github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// useUsagePrices 清空用量统计并配置 deepseek-chat 的单价（每百万 token 输入 1、输出 2），测试结束后恢复价格配置
+func useUsagePrices(t *testing.T) {
+	t.Helper()
+	usageLedger.Lock()
+	usageLedger.since = time.Now()
+	usageLedger.total = usageTotals{}
+	usageLedger.byModel = make(map[string]*modelUsage)
+	usageLedger.byAgent = make(map[string]*agentUsage)
+	usageLedger.bySession = make(map[string]*sessionUsage)
+	usageLedger.Unlock()
+
+	cfg := config.GetConfig()
+	prev := cfg.Usage
+	cfg.Usage = config.UsageConfig{
+		Currency: "USD",
+		Prices:   []config.ModelPrice{{Model: "deepseek-chat", Prompt: 1, Completion: 2}},
+	}
+	t.Cleanup(func() { cfg.Usage = prev })
+}
+
+// fakeCallCost fakeUsage 一次调用按 useUsagePrices 单价计算的费用
+const fakeCallCost = (100*1 + 20*2) / 1e6
+
+func TestUsageReportedAndAggregated(t *testing.T) {
+	useFakeLLM(t, "回答")
+	useUsagePrices(t)
+	agents = store.NewRegistry(store.NewMemoryStore())
+	sessions = store.NewSessionRegistry(store.NewMemorySessionStore())
+	ctx := context.Background()
+
+	result, err := createToolHandler(ctx, newToolRequest("expert_personality_generation", map[string]interface{}{
+		"agent_name":  "财务专家",
+		"core_traits": "精打细算",
+	}))
+	require.NoError(t, err)
+	created := toolResultJSON(t, result)
+	agentID := created["agent_id"].(string)
+	usage := created["usage"].(map[string]interface{})
+	assert.Equal(t, float64(1), usage["calls"])
+	assert.Equal(t, float64(100), usage["prompt_tokens"])
+	assert.Equal(t, float64(20), usage["completion_tokens"])
+	assert.InDelta(t, fakeCallCost, usage["cost"], 1e-12)
+
+	result, err = answerToolHandler(ctx, newToolRequest("agent_answer", map[string]interface{}{
+		"agent_id": agentID,
+		"context":  "预算怎么做",
+	}))
+	require.NoError(t, err)
+	usage = toolResultJSON(t, result)["usage"].(map[string]interface{})
+	assert.Equal(t, float64(120), usage["total_tokens"])
+
+	result, err = createSessionHandler(ctx, newToolRequest("create_session", map[string]interface{}{
+		"topic":     "年度预算",
+		"agent_ids": []interface{}{agentID},
+	}))
+	require.NoError(t, err)
+	sessionID := toolResultJSON(t, result)["id"].(string)
+	result, err = sessionTurnHandler(ctx, newToolRequest("session_turn", map[string]interface{}{
+		"session_id": sessionID,
+		"agent_id":   agentID,
+	}))
+	require.NoError(t, err)
+	usage = toolResultJSON(t, result)["usage"].(map[string]interface{})
+	assert.Equal(t, float64(1), usage["calls"])
+
+	// 一轮表达、一轮看见和主持人报告
+	result, err = runRoundTableHandler(ctx, newToolRequest("run_round_table", map[string]interface{}{
+		"topic":            "开源节流",
+		"agent_ids":        []interface{}{agentID},
+		"resonance_rounds": float64(0),
+	}))
+	require.NoError(t, err)
+	usage = toolResultJSON(t, result)["usage"].(map[string]interface{})
+	assert.Equal(t, float64(3), usage["calls"])
+
+	result, err = usageReportHandler(ctx, newToolRequest("usage_report", nil))
+	require.NoError(t, err)
+	report := toolResultJSON(t, result)
+	assert.Equal(t, "USD", report["currency"])
+	assert.Contains(t, report["note"], "重启后清零")
+	total := report["total"].(map[string]interface{})
+	assert.Equal(t, float64(6), total["calls"])
+	assert.InDelta(t, 6*fakeCallCost, total["cost"], 1e-12)
+
+	byModel := report["by_model"].([]interface{})
+	require.Len(t, byModel, 1)
+	assert.Equal(t, "fake/deepseek-chat", byModel[0].(map[string]interface{})["model"])
+
+	// 主持人报告不属于任何智能体
+	byAgent := report["by_agent"].([]interface{})
+	require.Len(t, byAgent, 1)
+	assert.Equal(t, "财务专家", byAgent[0].(map[string]interface{})["name"])
+	assert.Equal(t, float64(5), byAgent[0].(map[string]interface{})["calls"])
+
+	bySession := report["by_session"].([]interface{})
+	require.Len(t, bySession, 1)
+	assert.Equal(t, sessionID, bySession[0].(map[string]interface{})["session_id"])
+	assert.Equal(t, float64(1), bySession[0].(map[string]interface{})["calls"])
+
+	result, err = usageReportHandler(ctx, newToolRequest("usage_report", map[string]interface{}{"session_id": sessionID}))
+	require.NoError(t, err)
+	filtered := toolResultJSON(t, result)
+	assert.Nil(t, filtered["total"])
+	assert.Empty(t, filtered["by_agent"])
+	assert.Len(t, filtered["by_session"], 1)
+}
+
+func TestUsageReportedForBatchAndPanel(t *testing.T) {
+	usePanelLLM(t, fakePanelJSON)
+	useUsagePrices(t)
+	agents = store.NewRegistry(store.NewMemoryStore())
+	ctx := context.Background()
+
+	result, err := batchCreateAgentsHandler(ctx, newToolRequest("batch_create_agents", map[string]interface{}{
+		"agents": []interface{}{
+			map[string]interface{}{"agent_name": "经济学家", "core_traits": "理性"},
+			map[string]interface{}{"agent_name": "历史学家", "core_traits": "博学"},
+		},
+	}))
+	require.NoError(t, err)
+	usage := toolResultJSON(t, result)["usage"].(map[string]interface{})
+	assert.Equal(t, float64(2), usage["calls"])
+
+	// 一次选角和三位成员的人格
+	result, err = forgePanelHandler(ctx, newToolRequest("forge_panel", map[string]interface{}{
+		"topic": "是否应该自研AI芯片",
+		"size":  float64(3),
+	}))
+	require.NoError(t, err)
+	usage = toolResultJSON(t, result)["usage"].(map[string]interface{})
+	assert.Equal(t, float64(4), usage["calls"])
+}
+
+func TestUsageSkipsCachedResponses(t *testing.T) {
+	useFakeLLM(t, "回答")
+	useLLMCache(t)
+	useUsagePrices(t)
+	agents = store.NewRegistry(store.NewMemoryStore())
+	ctx := context.Background()
+
+	var usages []map[string]interface{}
+	for range 2 {
+		result, err := createToolHandler(ctx, newToolRequest("expert_personality_generation", map[string]interface{}{
+			"agent_name":  "缓存专家",
+			"core_traits": "节俭",
+			"seed":        float64(7),
+		}))
+		require.NoError(t, err)
+		usages = append(usages, toolResultJSON(t, result)["usage"].(map[string]interface{}))
+	}
+	assert.Equal(t, float64(1), usages[0]["calls"])
+	assert.Equal(t, float64(0), usages[1]["calls"])
+
+	report := buildUsageReport("", "")
+	assert.Equal(t, 1, report.Total.Calls)
+}
+
+func TestUsagePricedByRequestedModel(t *testing.T) {
+	// 接口返回带日期的快照名称，仍按请求的模型计价
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(openai.ChatCompletionResponse{
+			Model:   "deepseek-chat-2025-05-28",
+			Choices: []openai.ChatCompletionChoice{{Message: openai.ChatCompletionMessage{Role: openai.ChatMessageRoleAssistant, Content: "好"}}},
+			Usage:   fakeUsage,
+		})
+	}))
+	t.Cleanup(srv.Close)
+	useFakeProvider(t, srv.URL)
+	useUsagePrices(t)
+
+	resp, err := chatLLM(context.Background(), llm.ChatRequest{Messages: []llm.Message{{Role: llm.RoleUser, Content: "你好"}}}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "deepseek-chat-2025-05-28", resp.Model)
+
+	report := buildUsageReport("", "")
+	assert.InDelta(t, fakeCallCost, report.Total.Cost, 1e-12)
+	require.Len(t, report.ByModel, 1)
+	assert.Equal(t, "fake/deepseek-chat", report.ByModel[0].Model)
+}
+
+func TestUsagePrice(t *testing.T) {
+	cfg := config.GetConfig()
+	prev := cfg.Usage
+	cfg.Usage.Prices = []config.ModelPrice{
+		{Model: "gpt-4.1", Prompt: 2, Completion: 8},
+		{Model: "azure/gpt-4.1", Prompt: 3, Completion: 9},
+	}
+	t.Cleanup(func() { cfg.Usage = prev })
+
+	usage := llm.Usage{PromptTokens: 1_000_000, CompletionTokens: 500_000}
+	assert.InDelta(t, 6, usageCost("openai", "gpt-4.1", usage), 1e-9)
+	assert.InDelta(t, 7.5, usageCost("azure", "gpt-4.1", usage), 1e-9, "提供方/模型 优先匹配")
+	assert.Zero(t, usageCost("ollama", "qwen2.5", usage))
+}
@@ -0,0 +1,310 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"agent-forge/internal/logger"
+	"agent-forge/internal/store"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"go.uber.org/zap"
+)
+
+// versionSummary 版本列表中的单个版本
+type versionSummary struct {
+	Version     int    `json:"version"`
+	Reason      string `json:"reason"`
+	CreatedAt   string `json:"created_at"`
+	Name        string `json:"name"`
+	CoreTraits  string `json:"core_traits"`
+	Personality string `json:"personality"`
+}
+
+// fieldChange 两个版本之间单个字段的差异
+type fieldChange struct {
+	Field string   `json:"field"`
+	From  string   `json:"from"`
+	To    string   `json:"to"`
+	Diff  []string `json:"diff,omitempty"` // 多行文本的逐行差异，"-" 为删除，"+" 为新增
+}
+
+// versionFields 参与版本比较的字段，列表字段按行拼接
+var versionFields = []struct {
+	name  string
+	value func(agent Agent) string
+}{
+	{"name", func(a Agent) string { return a.Name }},
+	{"core_traits", func(a Agent) string { return a.CoreTraits }},
+	{"personality", func(a Agent) string { return a.Personality }},
+	{"tags", func(a Agent) string { return strings.Join(a.Tags, "\n") }},
+	{"persona.expertise_domains", personaField(func(p *Persona) []string { return p.ExpertiseDomains })},
+	{"persona.traits", personaField(func(p *Persona) []string { return p.Traits })},
+	{"persona.speaking_style", personaField(func(p *Persona) []string { return []string{p.SpeakingStyle} })},
+	{"persona.values", personaField(func(p *Persona) []string { return p.Values })},
+	{"persona.knowledge_boundaries", personaField(func(p *Persona) []string { return p.KnowledgeBoundaries })},
+	{"persona.taboo_topics", personaField(func(p *Persona) []string { return p.TabooTopics })},
+	{"persona.example_utterances", personaField(func(p *Persona) []string { return p.ExampleUtterances })},
+	{"model", func(a Agent) string { return a.Model }},
+	{"temperature", func(a Agent) string { return formatFloatPtr(a.Temperature) }},
+	{"top_p", func(a Agent) string { return formatFloatPtr(a.TopP) }},
+	{"max_tokens", func(a Agent) string { return formatInt(a.MaxTokens) }},
+	{"seed", func(a Agent) string {
+		if a.Seed == nil {
+			return ""
+		}
+		return strconv.Itoa(*a.Seed)
+	}},
+}
+
+// personaField 读取结构化人格中的字段，没有结构化人格时为空
+func personaField(get func(p *Persona) []string) func(agent Agent) string {
+	return func(a Agent) string {
+		if a.Persona == nil {
+			return ""
+		}
+		return strings.Join(get(a.Persona), "\n")
+	}
+}
+
+// formatFloatPtr 格式化可选的浮点数，未设置时为空
+func formatFloatPtr(v *float64) string {
+	if v == nil {
+		return ""
+	}
+	return strconv.FormatFloat(*v, 'f', -1, 64)
+}
+
+// formatInt 格式化整数，零值表示未设置
+func formatInt(v int) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.Itoa(v)
+}
+
+// diffAgents 比较两个版本的智能体，返回发生变化的字段
+func diffAgents(from, to Agent) []fieldChange {
+	changes := make([]fieldChange, 0)
+	for _, field := range versionFields {
+		a, b := field.value(from), field.value(to)
+		if a == b {
+			continue
+		}
+		change := fieldChange{Field: field.name, From: a, To: b}
+		if strings.Contains(a, "\n") || strings.Contains(b, "\n") {
+			change.Diff = lineDiff(a, b)
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+// lineDiff 基于最长公共子序列计算逐行差异
+func lineDiff(a, b string) []string {
+	x, y := strings.Split(a, "\n"), strings.Split(b, "\n")
+
+	// lcs[i][j] 为 x[i:] 与 y[j:] 的最长公共子序列长度
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	diff := make([]string, 0, len(x)+len(y))
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			diff = append(diff, "  "+x[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, "- "+x[i])
+			i++
+		default:
+			diff = append(diff, "+ "+y[j])
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		diff = append(diff, "- "+x[i])
+	}
+	for ; j < len(y); j++ {
+		diff = append(diff, "+ "+y[j])
+	}
+	return diff
+}
+
+// parseVersionArg 解析工具参数中的版本号
+func parseVersionArg(args map[string]interface{}, key string) (int, bool, error) {
+	v, ok := args[key]
+	if !ok {
+		return 0, false, nil
+	}
+	n, ok := v.(float64)
+	if !ok || n < 1 || n != math.Trunc(n) {
+		return 0, false, fmt.Errorf("%s must be a positive integer", key)
+	}
+	return int(n), true, nil
+}
+
+// getAgentVersion 读取智能体的指定版本，并统一不存在时的错误信息
+func getAgentVersion(agentID string, version int) (Agent, error) {
+	v, err := agents.Version(agentID, version)
+	if err != nil {
+		if errors.Is(err, store.ErrVersionNotFound) {
+			return Agent{}, fmt.Errorf("version %d of agent %s not found", version, agentID)
+		}
+		return Agent{}, agentLookupError(agentID, err)
+	}
+	return v.Agent, nil
+}
+
+// 列出智能体版本历史处理函数
+func listAgentVersionsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	agentID, ok := request.GetArguments()["agent_id"].(string)
+	if !ok {
+		return nil, errors.New("agent_id must be a string")
+	}
+
+	agent, err := getStoredAgent(agentID)
+	if err != nil {
+		return nil, err
+	}
+	versions, err := agents.Versions(agentID)
+	if err != nil {
+		return nil, agentLookupError(agentID, err)
+	}
+
+	summaries := make([]versionSummary, 0, len(versions))
+	for _, v := range versions {
+		summaries = append(summaries, versionSummary{
+			Version:     v.Version,
+			Reason:      v.Reason,
+			CreatedAt:   v.CreatedAt,
+			Name:        v.Agent.Name,
+			CoreTraits:  v.Agent.CoreTraits,
+			Personality: v.Agent.Personality,
+		})
+	}
+
+	result := map[string]interface{}{
+		"agent_id":        agentID,
+		"current_version": agent.Version,
+		"versions":        summaries,
+	}
+
+	jsonResponse, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("marshal response failed: %v", err)
+	}
+
+	return mcp.NewToolResultText(string(jsonResponse)), nil
+}
+
+// 比较智能体版本处理函数
+func diffAgentVersionsHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	agentID, ok := request.GetArguments()["agent_id"].(string)
+	if !ok {
+		return nil, errors.New("agent_id must be a string")
+	}
+	fromVersion, ok, err := parseVersionArg(request.GetArguments(), "from_version")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("from_version is required")
+	}
+	toVersion, ok, err := parseVersionArg(request.GetArguments(), "to_version")
+	if err != nil {
+		return nil, err
+	}
+
+	// 未指定目标版本时与当前版本比较
+	var to Agent
+	if ok {
+		to, err = getAgentVersion(agentID, toVersion)
+	} else {
+		to, err = getStoredAgent(agentID)
+		toVersion = to.Version
+	}
+	if err != nil {
+		return nil, err
+	}
+	from, err := getAgentVersion(agentID, fromVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]interface{}{
+		"agent_id":     agentID,
+		"from_version": fromVersion,
+		"to_version":   toVersion,
+		"changes":      diffAgents(from, to),
+	}
+
+	jsonResponse, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("marshal response failed: %v", err)
+	}
+
+	return mcp.NewToolResultText(string(jsonResponse)), nil
+}
+
+// 回滚智能体处理函数
+func rollbackAgentHandler(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	log := logger.GetLogger()
+
+	agentID, ok := request.GetArguments()["agent_id"].(string)
+	if !ok {
+		return nil, errors.New("agent_id must be a string")
+	}
+	version, ok, err := parseVersionArg(request.GetArguments(), "version")
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errors.New("version is required")
+	}
+	reason, _ := request.GetArguments()["reason"].(string)
+
+	agent, err := agents.Rollback(agentID, version, reason)
+	if err != nil {
+		if errors.Is(err, store.ErrVersionNotFound) {
+			return nil, fmt.Errorf("version %d of agent %s not found", version, agentID)
+		}
+		return nil, agentLookupError(agentID, err)
+	}
+
+	log.Info("回滚智能体",
+		zap.String("agent_id", agentID),
+		zap.Int("to_version", version),
+		zap.Int("new_version", agent.Version))
+
+	result := map[string]interface{}{
+		"status":  "success",
+		"message": fmt.Sprintf("智能体已回滚到版本 %d", version),
+		"agent":   agent,
+	}
+
+	jsonResponse, err := json.Marshal(result)
+	if err != nil {
+		return nil, fmt.Errorf("marshal response failed: %v", err)
+	}
+
+	return mcp.NewToolResultText(string(jsonResponse)), nil
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"agent-forge/internal/store"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgentVersionTools(t *testing.T) {
+	agents = store.NewRegistry(store.NewMemoryStore())
+	require.NoError(t, agents.Create(Agent{ID: "a1", Name: "经济学家", CoreTraits: "理性", Personality: "第一行\n第二行"}))
+	_, err := agents.UpdateWithReason("a1", "重新生成", func(agent *Agent) error {
+		agent.CoreTraits = "激进"
+		agent.Personality = "第一行\n新的第二行"
+		return nil
+	})
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	result, err := listAgentVersionsHandler(ctx, newToolRequest("list_agent_versions", map[string]interface{}{
+		"agent_id": "a1",
+	}))
+	require.NoError(t, err)
+	data := toolResultJSON(t, result)
+	assert.Equal(t, float64(2), data["current_version"])
+	versions := data["versions"].([]interface{})
+	require.Len(t, versions, 2)
+	assert.Equal(t, store.ReasonCreated, versions[0].(map[string]interface{})["reason"])
+	assert.Equal(t, "理性", versions[0].(map[string]interface{})["core_traits"])
+
+	result, err = diffAgentVersionsHandler(ctx, newToolRequest("diff_agent_versions", map[string]interface{}{
+		"agent_id":     "a1",
+		"from_version": float64(1),
+	}))
+	require.NoError(t, err)
+	data = toolResultJSON(t, result)
+	assert.Equal(t, float64(2), data["to_version"])
+	changes := data["changes"].([]interface{})
+	require.Len(t, changes, 2)
+	traits := changes[0].(map[string]interface{})
+	assert.Equal(t, "core_traits", traits["field"])
+	assert.Equal(t, "理性", traits["from"])
+	assert.Equal(t, "激进", traits["to"])
+	personality := changes[1].(map[string]interface{})
+	assert.Equal(t, []interface{}{"  第一行", "- 第二行", "+ 新的第二行"}, personality["diff"])
+
+	result, err = rollbackAgentHandler(ctx, newToolRequest("rollback_agent", map[string]interface{}{
+		"agent_id": "a1",
+		"version":  float64(1),
+	}))
+	require.NoError(t, err)
+	data = toolResultJSON(t, result)
+	agent := data["agent"].(map[string]interface{})
+	assert.Equal(t, "理性", agent["core_traits"])
+	assert.Equal(t, float64(3), agent["version"])
+
+	_, err = rollbackAgentHandler(ctx, newToolRequest("rollback_agent", map[string]interface{}{
+		"agent_id": "a1",
+		"version":  float64(7),
+	}))
+	assert.Error(t, err)
+}
+
+func TestLineDiff(t *testing.T) {
+	assert.Equal(t, []string{"  a", "- b", "+ c", "  d", "+ e"}, lineDiff("a\nb\nd", "a\nc\nd\ne"))
+	assert.Equal(t, []string{"  a"}, lineDiff("a", "a"))
+}